@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// errNoQuorum возвращается, если интервалы большинства серверов не пересекаются.
+var errNoQuorum = errors.New("нет согласия большинства серверов")
+
+// consensus — согласованное смещение часов по ответам нескольких серверов.
+type consensus struct {
+	// Offset — середина пересечения интервалов согласных серверов.
+	Offset time.Duration
+	// Low и High — границы пересечения: истинное смещение лежит в них,
+	// если согласные серверы не ошибаются.
+	Low, High time.Duration
+	// Truechimers — индексы серверов, чьи интервалы содержат пересечение.
+	Truechimers []int
+	// Falsetickers — индексы корректно ответивших серверов вне пересечения.
+	Falsetickers []int
+}
+
+// interval возвращает интервал смещения, в котором по ответу сервера лежит
+// истинное смещение: смещение ± расстояние до эталонных часов.
+func interval(r result) (low, high time.Duration) {
+	distance := r.Response.RootDistance
+	if distance <= 0 {
+		distance = r.Response.RTT / 2
+	}
+	return r.Response.ClockOffset - distance, r.Response.ClockOffset + distance
+}
+
+// selectConsensus отбирает серверы алгоритмом Марзулло: находит отрезок,
+// покрытый интервалами наибольшего числа корректных ответов. Согласными
+// считаются серверы, интервалы которых содержат этот отрезок; их должно быть
+// больше половины опрошенных серверов.
+func selectConsensus(results []result) (consensus, error) {
+	type edge struct {
+		at    time.Duration
+		start bool
+	}
+	var edges []edge
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		low, high := interval(r)
+		edges = append(edges, edge{at: low, start: true}, edge{at: high})
+	}
+	// При совпадении границ начало обрабатывается раньше конца, чтобы
+	// касающиеся интервалы считались пересекающимися.
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at != edges[j].at {
+			return edges[i].at < edges[j].at
+		}
+		return edges[i].start && !edges[j].start
+	})
+
+	var c consensus
+	count, best := 0, 0
+	for i, e := range edges {
+		if !e.start {
+			count--
+			continue
+		}
+		count++
+		if count > best {
+			// Отрезок наибольшего покрытия тянется до ближайшей следующей границы.
+			best = count
+			c.Low, c.High = e.at, edges[i+1].at
+		}
+	}
+
+	if best*2 <= len(results) {
+		return c, fmt.Errorf("%w: согласны %d из %d", errNoQuorum, best, len(results))
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if low, high := interval(r); low <= c.Low && high >= c.High {
+			c.Truechimers = append(c.Truechimers, i)
+		} else {
+			c.Falsetickers = append(c.Falsetickers, i)
+		}
+	}
+	c.Offset = c.Low + (c.High-c.Low)/2
+	return c, nil
+}
+
+// isFalseticker сообщает, что ответ сервера i отброшен при выборе.
+func (c *consensus) isFalseticker(i int) bool {
+	for _, j := range c.Falsetickers {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/stretchr/testify/assert"
+)
+
+// startFakeNTP запускает SNTP сервер страты 2, часы которого сдвинуты на
+// offset, с корневой дисперсией dispersion.
+func startFakeNTP(t *testing.T, offset, dispersion time.Duration) string {
+	s := newSNTPServer(2)
+	s.Now = func() time.Time { return time.Now().Add(offset) }
+	s.RootDispersion = dispersion
+	return startServer(t, s)
+}
+
+// intervalResult возвращает корректный ответ со смещением offset ± distance.
+func intervalResult(offset, distance time.Duration) result {
+	return result{Response: &ntp.Response{ClockOffset: offset, RootDistance: distance}}
+}
+
+func TestSelectConsensus(t *testing.T) {
+	ms := time.Millisecond
+	results := []result{
+		intervalResult(1000*ms, 20*ms),
+		intervalResult(1010*ms, 20*ms),
+		{Server: "down", Err: errors.New("i/o timeout")},
+		intervalResult(990*ms, 20*ms),
+		intervalResult(5000*ms, 20*ms),
+	}
+	c, err := selectConsensus(results)
+	assert.NoError(t, err)
+	assert.Equal(t, 990*ms, c.Low, "Нижняя граница пересечения")
+	assert.Equal(t, 1010*ms, c.High, "Верхняя граница пересечения")
+	assert.Equal(t, 1000*ms, c.Offset, "Смещение — середина пересечения")
+	assert.Equal(t, []int{0, 1, 3}, c.Truechimers)
+	assert.Equal(t, []int{4}, c.Falsetickers, "Выброс должен быть отброшен")
+
+	// Касающиеся интервалы считаются согласными.
+	c, err = selectConsensus([]result{intervalResult(0, 10*ms), intervalResult(20*ms, 10*ms)})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*ms, c.Offset)
+
+	// Без дисперсии интервал определяется задержкой.
+	c, err = selectConsensus([]result{{Response: &ntp.Response{ClockOffset: ms, RTT: 4 * ms}}})
+	assert.NoError(t, err)
+	assert.Equal(t, -ms, c.Low)
+	assert.Equal(t, 3*ms, c.High)
+
+	_, err = selectConsensus([]result{intervalResult(0, ms), intervalResult(time.Second, ms)})
+	assert.ErrorIs(t, err, errNoQuorum, "Два несогласных сервера не дают большинства")
+	_, err = selectConsensus([]result{intervalResult(0, ms), {Err: errors.New("timeout")}, {Err: errors.New("timeout")}})
+	assert.ErrorIs(t, err, errNoQuorum, "Большинство считается от всех опрошенных серверов")
+}
+
+func TestRun_Consensus(t *testing.T) {
+	ms := time.Millisecond
+	servers := []string{
+		startFakeNTP(t, 2000*ms, 20*ms),
+		startFakeNTP(t, 2005*ms, 20*ms),
+		startFakeNTP(t, 1995*ms, 20*ms),
+		startFakeNTP(t, -30*time.Second, 20*ms),
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), append([]string{"-format", "json", "-timeout", "2s"}, servers...), &stdout, &stderr, ntpSource{})
+	assert.Equal(t, 0, code, "Большинство серверов согласно: %s", stderr.String())
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, len(servers)+1, "После серверов выводится строка с согласованным смещением")
+	var last struct {
+		Consensus jsonConsensus `json:"consensus"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &last))
+	assert.InDelta(t, 2.0, last.Consensus.Offset, 0.03, "Согласованное смещение")
+	assert.LessOrEqual(t, last.Consensus.Low, last.Consensus.Offset)
+	assert.GreaterOrEqual(t, last.Consensus.High, last.Consensus.Offset)
+	assert.Equal(t, servers[:3], last.Consensus.Truechimers)
+	assert.Equal(t, servers[3:], last.Consensus.Falsetickers)
+
+	var falseticker jsonResult
+	assert.NoError(t, json.Unmarshal([]byte(lines[3]), &falseticker))
+	assert.True(t, falseticker.Falseticker, "Выброс помечается в выводе")
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run(context.Background(), []string{"-timeout", "2s", servers[0], servers[3]}, &stdout, &stderr, ntpSource{})
+	assert.Equal(t, 1, code, "Без согласия большинства код выхода ненулевой")
+	assert.Contains(t, stderr.String(), "нет согласия большинства серверов")
+	assert.NotContains(t, stdout.String(), "Точное время (NTP):")
+}
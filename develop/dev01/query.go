@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/beevik/ntp"
+)
+
+// TimeSource — источник точного времени: по адресу сервера возвращает его
+// ответ. Программа работает с NTP через этот интерфейс, чтобы в тестах сеть
+// можно было заменить.
+type TimeSource interface {
+	Query(server string, opt ntp.QueryOptions) (*ntp.Response, error)
+}
+
+// ntpSource опрашивает серверы по сети с помощью библиотеки ntp.
+type ntpSource struct{}
+
+func (ntpSource) Query(server string, opt ntp.QueryOptions) (*ntp.Response, error) {
+	return ntp.QueryWithOptions(server, opt)
+}
+
+// sourceFunc позволяет использовать обычную функцию как TimeSource.
+type sourceFunc func(server string, opt ntp.QueryOptions) (*ntp.Response, error)
+
+func (f sourceFunc) Query(server string, opt ntp.QueryOptions) (*ntp.Response, error) {
+	return f(server, opt)
+}
+
+// errUnsynchronized — сервер страты 0 сообщил, что его часы не синхронизированы.
+var errUnsynchronized = errors.New("сервер не синхронизирован")
+
+// validate проверяет ответ сервера. Ответ страты 0 с индикатором коррекции
+// "не синхронизирован" отличается от прочих kiss-of-death; код из
+// идентификатора источника добавляется к ошибке.
+func validate(resp *ntp.Response) error {
+	err := resp.Validate()
+	if resp.Stratum == 0 && resp.Leap == ntp.LeapNotInSync {
+		err = errUnsynchronized
+	}
+	if resp.Stratum == 0 && resp.KissCode != "" {
+		err = fmt.Errorf("%w: %s", err, resp.KissCode)
+	}
+	return err
+}
+
+// result — ответ одного сервера. Err содержит ошибку запроса или проверки
+// ответа; в последнем случае Response тоже заполнен.
+type result struct {
+	Server   string
+	Response *ntp.Response
+	Err      error
+}
+
+// queryServers опрашивает серверы одновременно и проверяет ответы.
+// Результаты следуют в порядке серверов.
+func queryServers(src TimeSource, cfg config) []result {
+	results := make([]result, len(cfg.Servers))
+	var wg sync.WaitGroup
+	for i, server := range cfg.Servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			resp, err := src.Query(server, ntp.QueryOptions{Timeout: cfg.Timeout, Version: cfg.Version})
+			if err == nil {
+				err = validate(resp)
+			}
+			results[i] = result{Server: server, Response: resp, Err: err}
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// leapString описывает индикатор коррекции секунды.
+func leapString(leap ntp.LeapIndicator) string {
+	switch leap {
+	case ntp.LeapNoWarning:
+		return "none"
+	case ntp.LeapAddSecond:
+		return "add"
+	case ntp.LeapDelSecond:
+		return "delete"
+	default:
+		return "unsynchronized"
+	}
+}
+
+// writeText печатает текущее время, точное время по согласованному смещению
+// и таблицу ответов серверов. c равен nil, если согласия нет.
+func writeText(w io.Writer, now time.Time, results []result, c *consensus) error {
+	fmt.Fprintln(w, "Текущее время:", now)
+	if c != nil {
+		fmt.Fprintln(w, "Точное время (NTP):", now.Add(c.Offset))
+		fmt.Fprintf(w, "Смещение: %s (от %s до %s), согласны %d из %d серверов\n",
+			signed(c.Offset), signed(c.Low), signed(c.High), len(c.Truechimers), len(results))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Сервер\tСмещение\tЗадержка\tСтрата\tИсточник\tLeap\tСтатус")
+	for i, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = r.Err.Error()
+		} else if c != nil && c.isFalseticker(i) {
+			status = "falseticker"
+		}
+		if r.Response == nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t%s\n", r.Server, status)
+			continue
+		}
+		resp := r.Response
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%d\t%s\t%s\t%s\n", r.Server, signed(resp.ClockOffset), resp.RTT,
+			resp.Stratum, resp.ReferenceString(), leapString(resp.Leap), status)
+	}
+	return tw.Flush()
+}
+
+// signed форматирует смещение со знаком: +150ms, -2s.
+func signed(d time.Duration) string {
+	if d < 0 {
+		return d.String()
+	}
+	return "+" + d.String()
+}
+
+// jsonResult — ответ сервера в выводе -format json. Длительности указаны в секундах.
+type jsonResult struct {
+	Server      string     `json:"server"`
+	Time        *time.Time `json:"time,omitempty"`
+	Offset      float64    `json:"offset"`
+	RTT         float64    `json:"rtt"`
+	Stratum     uint8      `json:"stratum"`
+	ReferenceID string     `json:"reference_id,omitempty"`
+	Leap        string     `json:"leap,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Falseticker bool       `json:"falseticker,omitempty"`
+}
+
+// jsonConsensus — согласованное смещение в выводе -format json.
+type jsonConsensus struct {
+	Offset       float64  `json:"offset"`
+	Low          float64  `json:"low"`
+	High         float64  `json:"high"`
+	Truechimers  []string `json:"truechimers"`
+	Falsetickers []string `json:"falsetickers"`
+}
+
+// writeJSON печатает ответы серверов по одному JSON объекту в строке и
+// последней строкой — {"consensus": ...}, если согласие достигнуто.
+func writeJSON(w io.Writer, results []result, c *consensus) error {
+	enc := json.NewEncoder(w)
+	for i, r := range results {
+		out := jsonResult{Server: r.Server}
+		if resp := r.Response; resp != nil {
+			out.Time = &resp.Time
+			out.Offset = resp.ClockOffset.Seconds()
+			out.RTT = resp.RTT.Seconds()
+			out.Stratum = resp.Stratum
+			out.ReferenceID = resp.ReferenceString()
+			out.Leap = leapString(resp.Leap)
+		}
+		if r.Err != nil {
+			out.Error = r.Err.Error()
+		}
+		out.Falseticker = c != nil && c.isFalseticker(i)
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	if c == nil {
+		return nil
+	}
+
+	out := jsonConsensus{
+		Offset:       c.Offset.Seconds(),
+		Low:          c.Low.Seconds(),
+		High:         c.High.Seconds(),
+		Truechimers:  []string{},
+		Falsetickers: []string{},
+	}
+	for _, i := range c.Truechimers {
+		out.Truechimers = append(out.Truechimers, results[i].Server)
+	}
+	for _, i := range c.Falsetickers {
+		out.Falsetickers = append(out.Falsetickers, results[i].Server)
+	}
+	return enc.Encode(struct {
+		Consensus jsonConsensus `json:"consensus"`
+	}{out})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQuery возвращает заранее заданные ответы серверов.
+func fakeQuery(responses map[string]*ntp.Response) TimeSource {
+	return sourceFunc(func(server string, opt ntp.QueryOptions) (*ntp.Response, error) {
+		resp, ok := responses[server]
+		if !ok {
+			return nil, errors.New("i/o timeout")
+		}
+		return resp, nil
+	})
+}
+
+// validResponse возвращает корректный ответ сервера страты 2.
+func validResponse(offset time.Duration) *ntp.Response {
+	now := time.Now()
+	return &ntp.Response{
+		Time:          now.Add(offset),
+		ClockOffset:   offset,
+		RTT:           20 * time.Millisecond,
+		Stratum:       2,
+		ReferenceID:   0xc0a80001,
+		ReferenceTime: now.Add(-time.Minute),
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	cfg, err := parseArgs(nil, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pool.ntp.org"}, cfg.Servers, "По умолчанию опрашивается pool.ntp.org")
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, 4, cfg.Version)
+
+	cfg, err = parseArgs([]string{"-servers", "a.example, b.example:1123", "-timeout", "1s", "-version", "3", "-format", "json"}, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.example", "b.example:1123"}, cfg.Servers, "Серверы из флага разделяются запятой")
+	assert.Equal(t, time.Second, cfg.Timeout)
+	assert.Equal(t, 3, cfg.Version)
+	assert.Equal(t, formatJSON, cfg.Format)
+
+	cfg, err = parseArgs([]string{"c.example", "d.example"}, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c.example", "d.example"}, cfg.Servers, "Позиционные аргументы задают серверы")
+
+	for _, args := range [][]string{
+		{"-servers", " , "},
+		{"-timeout", "0s"},
+		{"-version", "5"},
+		{"-format", "xml"},
+		{"-unknown"},
+	} {
+		_, err := parseArgs(args, &bytes.Buffer{})
+		assert.Error(t, err, "Аргументы %q должны быть отклонены", args)
+	}
+}
+
+func TestRun(t *testing.T) {
+	kod := validResponse(0)
+	kod.Stratum = 0
+	kod.ReferenceID = 0x52415445 // RATE
+	query := fakeQuery(map[string]*ntp.Response{
+		"good.example":  validResponse(150 * time.Millisecond),
+		"other.example": validResponse(152 * time.Millisecond),
+		"kod.example":   kod,
+	})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"good.example"}, &stdout, &stderr, query)
+	assert.Equal(t, 0, code, "Корректный ответ должен завершаться с кодом 0: %s", stderr.String())
+	assert.Contains(t, stdout.String(), "Точное время (NTP):")
+	assert.Contains(t, stdout.String(), "good.example  +150ms")
+	assert.Contains(t, stdout.String(), "192.168.0.1")
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run(context.Background(), []string{"-format", "json", "good.example", "kod.example", "down.example"}, &stdout, &stderr, query)
+	assert.Equal(t, 1, code, "Без согласия большинства серверов код выхода ненулевой")
+	assert.Contains(t, stderr.String(), "kod.example: kiss of death received")
+	assert.Contains(t, stderr.String(), "down.example: i/o timeout")
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, 3, "Каждый сервер выводится отдельной строкой JSON")
+	var good, down jsonResult
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &good))
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &down))
+	assert.InDelta(t, 0.15, good.Offset, 1e-9)
+	assert.Equal(t, uint8(2), good.Stratum)
+	assert.Equal(t, "none", good.Leap)
+	assert.Empty(t, good.Error)
+	assert.Nil(t, down.Time, "У недоступного сервера нет времени ответа")
+	assert.Equal(t, "i/o timeout", down.Error)
+
+	// Ошибка одного сервера не мешает согласию остальных.
+	stdout.Reset()
+	stderr.Reset()
+	code = run(context.Background(), []string{"good.example", "other.example", "down.example"}, &stdout, &stderr, query)
+	assert.Equal(t, 0, code, "Большинство серверов ответило согласованно: %s", stderr.String())
+	assert.Contains(t, stdout.String(), "Точное время (NTP):")
+	assert.Contains(t, stderr.String(), "down.example: i/o timeout", "Ошибка сервера выводится и при наличии согласия")
+	assert.NotContains(t, stderr.String(), errNoQuorum.Error())
+
+	assert.Equal(t, 2, run(context.Background(), []string{"-version", "1"}, &stdout, &stderr, query), "Неверные аргументы должны давать код 2")
+}
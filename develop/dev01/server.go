@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// Поля заголовка NTP (RFC 5905, раздел 7.3).
+const (
+	packetSize = 48
+
+	modeClient = 3
+	modeServer = 4
+
+	// serverPrecision — точность часов сервера, log2 секунд (около микросекунды).
+	serverPrecision = -20
+	// referencePeriod — как часто локальные часы считаются сверенными:
+	// время сверки в ответе — начало текущего периода.
+	referencePeriod = 64 * time.Second
+)
+
+// ntpEpoch — начало шкалы времени NTP.
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// refIDLocal — идентификатор источника "LOCL": некалиброванные локальные часы.
+const refIDLocal = 'L'<<24 | 'O'<<16 | 'C'<<8 | 'L'
+
+// packet — заголовок пакета NTP без расширений и кода аутентификации.
+type packet struct {
+	LiVnMode       uint8 // индикатор коррекции (2 бита), версия (3), режим (3)
+	Stratum        uint8
+	Poll           int8
+	Precision      int8
+	RootDelay      uint32 // секунды в формате 16.16
+	RootDispersion uint32 // секунды в формате 16.16
+	ReferenceID    uint32
+	ReferenceTime  uint64 // метки времени в формате 32.32 от ntpEpoch
+	OriginTime     uint64
+	ReceiveTime    uint64
+	TransmitTime   uint64
+}
+
+func (p *packet) version() uint8 { return p.LiVnMode >> 3 & 0x07 }
+func (p *packet) mode() uint8    { return p.LiVnMode & 0x07 }
+
+// toNTPTime кодирует момент в 64-битную метку времени NTP.
+func toNTPTime(t time.Time) uint64 {
+	d := t.Sub(ntpEpoch)
+	sec := uint64(d / time.Second)
+	frac := uint64(d%time.Second) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+// toNTPShort кодирует длительность в 32-битный формат NTP 16.16.
+func toNTPShort(d time.Duration) uint32 {
+	return uint32(uint64(d) << 16 / uint64(time.Second))
+}
+
+// sntpServer — SNTP сервер (RFC 4330), отвечающий временем локальных часов.
+type sntpServer struct {
+	// Now возвращает время локальных часов.
+	Now func() time.Time
+	// Stratum — страта сервера: 1 для эталонных часов.
+	Stratum uint8
+	// ReferenceID — идентификатор источника времени.
+	ReferenceID uint32
+	// RootDispersion — оценка погрешности локальных часов.
+	RootDispersion time.Duration
+}
+
+// newSNTPServer возвращает сервер страты stratum на системных часах.
+func newSNTPServer(stratum uint8) *sntpServer {
+	s := &sntpServer{Now: time.Now, Stratum: stratum, ReferenceID: refIDLocal}
+	if stratum > 1 {
+		// Для страт 2 и выше идентификатор — IPv4 адрес источника.
+		s.ReferenceID = 0x7f000001
+	}
+	return s
+}
+
+// Serve отвечает на запросы, приходящие на conn, пока соединение не закрыто.
+// Пакеты, не являющиеся запросами клиента, отбрасываются.
+func (s *sntpServer) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		received := s.Now()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, ok := s.respond(buf[:n], received)
+		if !ok {
+			continue
+		}
+		// Ошибка отправки касается только одного клиента.
+		conn.WriteTo(resp, addr)
+	}
+}
+
+// respond строит ответ на запрос req, полученный в момент received.
+func (s *sntpServer) respond(req []byte, received time.Time) ([]byte, bool) {
+	var q packet
+	if len(req) < packetSize || binary.Read(bytes.NewReader(req), binary.BigEndian, &q) != nil {
+		return nil, false
+	}
+	if q.mode() != modeClient || q.version() < 1 || q.version() > 4 {
+		return nil, false
+	}
+
+	resp := packet{
+		LiVnMode:       q.version()<<3 | modeServer,
+		Stratum:        s.Stratum,
+		Poll:           q.Poll,
+		Precision:      serverPrecision,
+		RootDispersion: toNTPShort(s.RootDispersion),
+		ReferenceID:    s.ReferenceID,
+		ReferenceTime:  toNTPTime(received.Truncate(referencePeriod)),
+		// Клиент сверяет исходную метку со своей меткой отправки.
+		OriginTime:  q.TransmitTime,
+		ReceiveTime: toNTPTime(received),
+	}
+	resp.TransmitTime = toNTPTime(s.Now())
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, &resp)
+	return out.Bytes(), true
+}
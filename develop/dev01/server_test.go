@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer запускает сервер s на случайном локальном порту и возвращает его адрес.
+func startServer(t *testing.T, s *sntpServer) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Не удалось запустить NTP сервер: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.Serve(conn)
+	return conn.LocalAddr().String()
+}
+
+func TestToNTPTime(t *testing.T) {
+	// 1970-01-01 отстоит от эпохи NTP на 2208988800 секунд.
+	assert.Equal(t, uint64(2208988800)<<32|1<<31, toNTPTime(time.Unix(0, 5e8)))
+	assert.Equal(t, uint32(3<<15), toNTPShort(1500*time.Millisecond))
+}
+
+func TestSNTPServer_Respond(t *testing.T) {
+	received := time.Date(2024, 3, 1, 12, 0, 30, 0, time.UTC)
+	s := newSNTPServer(1)
+	s.Now = func() time.Time { return received.Add(time.Millisecond) }
+
+	req := packet{LiVnMode: 3<<3 | modeClient, Poll: 6, TransmitTime: 0x0123456789abcdef}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, &req)
+
+	out, ok := s.respond(buf.Bytes(), received)
+	assert.True(t, ok, "Запрос клиента должен получить ответ")
+	var resp packet
+	assert.NoError(t, binary.Read(bytes.NewReader(out), binary.BigEndian, &resp))
+	assert.Equal(t, uint8(3), resp.version(), "Версия ответа совпадает с версией запроса")
+	assert.Equal(t, uint8(modeServer), resp.mode())
+	assert.Equal(t, uint8(0), resp.LiVnMode>>6, "Индикатор коррекции: без предупреждения")
+	assert.Equal(t, uint8(1), resp.Stratum)
+	assert.Equal(t, int8(6), resp.Poll, "Интервал опроса копируется из запроса")
+	assert.Equal(t, uint32(refIDLocal), resp.ReferenceID)
+	assert.Equal(t, req.TransmitTime, resp.OriginTime, "Исходная метка — метка отправки клиента")
+	assert.Equal(t, toNTPTime(received), resp.ReceiveTime)
+	assert.Equal(t, toNTPTime(received.Add(time.Millisecond)), resp.TransmitTime)
+	assert.Equal(t, toNTPTime(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)), resp.ReferenceTime)
+
+	for _, bad := range []packet{
+		{LiVnMode: 4<<3 | modeServer},
+		{LiVnMode: 4<<3 | 1},
+		{LiVnMode: 5<<3 | modeClient},
+		{LiVnMode: 0<<3 | modeClient},
+	} {
+		buf.Reset()
+		binary.Write(&buf, binary.BigEndian, &bad)
+		_, ok := s.respond(buf.Bytes(), received)
+		assert.False(t, ok, "Пакет %08b должен быть отброшен", bad.LiVnMode)
+	}
+	_, ok = s.respond(make([]byte, packetSize-1), received)
+	assert.False(t, ok, "Короткий пакет должен быть отброшен")
+}
+
+func TestSNTPServer_Query(t *testing.T) {
+	addr := startServer(t, newSNTPServer(1))
+	for version := 2; version <= 4; version++ {
+		resp, err := ntp.QueryWithOptions(addr, ntp.QueryOptions{Timeout: 2 * time.Second, Version: version})
+		if !assert.NoError(t, err, "Версия %d", version) {
+			continue
+		}
+		assert.NoError(t, resp.Validate(), "Ответ должен проходить проверку клиента")
+		assert.Equal(t, uint8(1), resp.Stratum)
+		assert.Equal(t, ".LOCL.", resp.ReferenceString())
+		assert.Equal(t, ntp.LeapNoWarning, resp.Leap)
+		assert.InDelta(t, 0, resp.ClockOffset.Seconds(), 0.01, "Сервер работает на тех же часах")
+		assert.Less(t, resp.RTT, time.Second)
+	}
+
+	addr = startServer(t, newSNTPServer(3))
+	resp, err := ntp.Query(addr)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", resp.ReferenceString(), "Для страты 3 источник — IPv4 адрес")
+}
+
+func TestRun_Serve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stdout, w := io.Pipe()
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"-serve", "127.0.0.1:0", "-stratum", "2"}, w, io.Discard, ntpSource{})
+		w.Close()
+	}()
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	assert.NoError(t, err)
+	addr := strings.TrimSpace(strings.TrimPrefix(line, "SNTP сервер слушает"))
+	resp, err := ntp.QueryWithOptions(addr, ntp.QueryOptions{Timeout: 2 * time.Second})
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint8(2), resp.Stratum)
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		assert.Equal(t, 0, code, "Сервер должен завершаться без ошибки")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Сервер не остановился после отмены контекста")
+	}
+
+	assert.Equal(t, 2, run(context.Background(), []string{"-serve", ":0", "-stratum", "16"}, io.Discard, io.Discard, ntpSource{}))
+}
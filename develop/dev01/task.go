@@ -2,12 +2,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
-
-	"github.com/beevik/ntp"
 )
 
 /*
@@ -22,16 +27,172 @@ import (
 Программа должна проходить проверки go vet и golint.
 */
 
-func main() {
-	// Получение точного времени с использованием сервера NTP
-	ntpTime, err := ntp.Time("pool.ntp.org")
+// Форматы вывода.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// config — параметры запуска программы.
+type config struct {
+	// Servers — опрашиваемые NTP серверы в виде host или host:port.
+	Servers []string
+	// Timeout — сколько ждать ответа каждого сервера.
+	Timeout time.Duration
+	// Version — версия протокола NTP в запросах (2–4).
+	Version int
+	// Format — формат вывода: text, json или, в режиме наблюдения, csv.
+	Format string
+	// Watch включает режим наблюдения: серверы опрашиваются каждые Interval,
+	// пока программа не остановлена или не сделано Count измерений (0 — без
+	// ограничения).
+	Watch    bool
+	Interval time.Duration
+	Count    int
+	// Threshold — смещение, при превышении которого выводится предупреждение.
+	Threshold time.Duration
+	// Window — за какой период измерений оценивается дрейф часов.
+	Window time.Duration
+	// Serve — UDP адрес, на котором программа работает SNTP сервером
+	// вместо опроса серверов.
+	Serve string
+	// Stratum — страта SNTP сервера.
+	Stratum int
+}
+
+// parseArgs разбирает аргументы командной строки. Серверы задаются флагом
+// -servers через запятую или позиционными аргументами.
+func parseArgs(args []string, stderr io.Writer) (config, error) {
+	cfg := config{}
+	fs := flag.NewFlagSet("dev01", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	servers := fs.String("servers", "pool.ntp.org", "NTP серверы через запятую")
+	fs.DurationVar(&cfg.Timeout, "timeout", 5*time.Second, "таймаут ответа каждого сервера")
+	fs.IntVar(&cfg.Version, "version", 4, "версия протокола NTP (2-4)")
+	fs.StringVar(&cfg.Format, "format", formatText, "формат вывода: text, json или csv (только с -watch)")
+	fs.BoolVar(&cfg.Watch, "watch", false, "опрашивать серверы периодически и следить за дрейфом часов")
+	fs.DurationVar(&cfg.Interval, "interval", time.Minute, "интервал опроса в режиме -watch")
+	fs.IntVar(&cfg.Count, "count", 0, "число измерений в режиме -watch (0 — до остановки)")
+	fs.DurationVar(&cfg.Threshold, "threshold", 100*time.Millisecond, "порог смещения для предупреждения в режиме -watch")
+	fs.DurationVar(&cfg.Window, "window", time.Hour, "окно оценки дрейфа в режиме -watch")
+	fs.StringVar(&cfg.Serve, "serve", "", "работать SNTP сервером на UDP адресе, например :123")
+	fs.IntVar(&cfg.Stratum, "stratum", 1, "страта SNTP сервера (1-15)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Использование: dev01 [флаги] [сервер ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if fs.NArg() > 0 {
+		cfg.Servers = fs.Args()
+	} else {
+		for _, s := range strings.Split(*servers, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				cfg.Servers = append(cfg.Servers, s)
+			}
+		}
+	}
+	switch {
+	case cfg.Serve != "" && (cfg.Stratum < 1 || cfg.Stratum > 15):
+		return cfg, fmt.Errorf("недопустимая страта %d: допустимы значения от 1 до 15", cfg.Stratum)
+	case cfg.Serve != "":
+		return cfg, nil
+	case len(cfg.Servers) == 0:
+		return cfg, errors.New("не задан ни один NTP сервер")
+	case cfg.Timeout <= 0:
+		return cfg, errors.New("таймаут должен быть положительным")
+	case cfg.Version < 2 || cfg.Version > 4:
+		return cfg, fmt.Errorf("неподдерживаемая версия NTP %d: допустимы 2, 3 и 4", cfg.Version)
+	case cfg.Format == formatCSV && !cfg.Watch:
+		return cfg, errors.New("формат csv доступен только в режиме -watch")
+	case cfg.Format != formatText && cfg.Format != formatJSON && cfg.Format != formatCSV:
+		return cfg, fmt.Errorf("неизвестный формат вывода %q: допустимы text, json и csv", cfg.Format)
+	case cfg.Watch && cfg.Interval <= 0:
+		return cfg, errors.New("интервал опроса должен быть положительным")
+	case cfg.Watch && cfg.Count < 0:
+		return cfg, errors.New("число измерений не может быть отрицательным")
+	case cfg.Watch && cfg.Threshold <= 0:
+		return cfg, errors.New("порог смещения должен быть положительным")
+	case cfg.Watch && cfg.Window <= 0:
+		return cfg, errors.New("окно оценки дрейфа должно быть положительным")
+	}
+	return cfg, nil
+}
+
+// run выполняет программу и возвращает код выхода: 0 при успехе, 1, если
+// большинство серверов не дало согласованного времени, 2 при неверных
+// аргументах. Серверы опрашиваются одновременно, а ответы, не согласные
+// с большинством, отбрасываются. С флагом -serve программа работает SNTP
+// сервером, а с -watch следит за смещением часов до отмены ctx; в этом
+// режиме код 1 означает, что не удалось ни одно измерение. Время
+// запрашивается у src.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, src TimeSource) int {
+	cfg, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Ошибка:", err)
+		return 2
+	}
+	if cfg.Serve != "" {
+		return serve(ctx, cfg, stdout, stderr)
+	}
+	if cfg.Watch {
+		return watch(ctx, cfg, stdout, stderr, src, time.Now)
+	}
+
+	results := queryServers(src, cfg)
+	var agreed *consensus
+	c, consensusErr := selectConsensus(results)
+	if consensusErr == nil {
+		agreed = &c
+	}
+	if cfg.Format == formatJSON {
+		err = writeJSON(stdout, results, agreed)
+	} else {
+		err = writeText(stdout, time.Now(), results, agreed)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Ошибка вывода:", err)
+		return 1
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(stderr, "Ошибка получения времени NTP от %s: %v\n", r.Server, r.Err)
+		}
+	}
+	if consensusErr != nil {
+		fmt.Fprintln(stderr, "Ошибка:", consensusErr)
+		return 1
+	}
+	return 0
+}
+
+// serve работает SNTP сервером на адресе cfg.Serve до отмены ctx.
+func serve(ctx context.Context, cfg config, stdout, stderr io.Writer) int {
+	conn, err := net.ListenPacket("udp", cfg.Serve)
 	if err != nil {
-		log.Println("Ошибка получения времени NTP:", err)
-		os.Exit(1)
+		fmt.Fprintln(stderr, "Ошибка запуска SNTP сервера:", err)
+		return 1
 	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
-	// Печать текущего времени и точного времени
-	currentTime := time.Now()
-	fmt.Println("Текущее время:", currentTime)
-	fmt.Println("Точное время (NTP):", ntpTime)
+	fmt.Fprintln(stdout, "SNTP сервер слушает", conn.LocalAddr())
+	if err := newSNTPServer(uint8(cfg.Stratum)).Serve(conn); err != nil {
+		fmt.Fprintln(stderr, "Ошибка SNTP сервера:", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr, ntpSource{}))
 }
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
@@ -8,15 +13,159 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestNTPTime(t *testing.T) {
-	expectedLocation, _ := time.LoadLocation("UTC")                               // Ожидаемое местоположение времени
-	expectedTime := time.Date(2023, time.March, 25, 8, 0, 0, 0, expectedLocation) // Ожидаемое точное время
+// fakeResponder — UDP NTP сервер для тестов. Он отвечает как sntpServer, но
+// ответ можно испортить перед отправкой или не отвечать вовсе.
+type fakeResponder struct {
+	server *sntpServer
+	// mutate изменяет ответ перед отправкой; nil — без изменений.
+	mutate func(p *packet)
+	// silent — запросы принимаются, но остаются без ответа.
+	silent bool
+}
 
-	ntpTime, err := ntp.Time("pool.ntp.org")
+// startResponder запускает f на случайном локальном порту и возвращает его адрес.
+func startResponder(t *testing.T, f fakeResponder) string {
+	t.Helper()
+	if f.server == nil {
+		f.server = newSNTPServer(2)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
 	if err != nil {
-		t.Fatalf("Ошибка получения времени NTP: %v", err)
+		t.Fatalf("Не удалось запустить NTP сервер: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			out, ok := f.server.respond(buf[:n], f.server.Now())
+			if f.silent || !ok {
+				continue
+			}
+			if f.mutate != nil {
+				var p packet
+				binary.Read(bytes.NewReader(out), binary.BigEndian, &p)
+				f.mutate(&p)
+				var b bytes.Buffer
+				binary.Write(&b, binary.BigEndian, &p)
+				out = b.Bytes()
+			}
+			conn.WriteTo(out, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// refID кодирует четырехбуквенный код в идентификатор источника.
+func refID(code string) uint32 {
+	return binary.BigEndian.Uint32([]byte(code))
+}
+
+func TestNTPSource(t *testing.T) {
+	shifted := newSNTPServer(2)
+	shifted.Now = func() time.Time { return time.Now().Add(3 * time.Second) }
+	addr := startResponder(t, fakeResponder{server: shifted})
+
+	cfg := config{Servers: []string{addr}, Timeout: 2 * time.Second, Version: 4}
+	r := queryServers(ntpSource{}, cfg)[0]
+	if assert.NoError(t, r.Err) {
+		assert.InDelta(t, 3, r.Response.ClockOffset.Seconds(), 0.05, "Смещение сдвинутых часов сервера")
+		assert.Equal(t, uint8(2), r.Response.Stratum)
 	}
+}
+
+func TestNTPSource_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		f       fakeResponder
+		wantErr error
+		message string
+	}{
+		{
+			name:    "kiss-of-death",
+			f:       fakeResponder{mutate: func(p *packet) { p.Stratum, p.ReferenceID = 0, refID("RATE") }},
+			wantErr: ntp.ErrKissOfDeath,
+			message: "kiss of death received: RATE",
+		},
+		{
+			name: "не синхронизированный сервер страты 0",
+			f: fakeResponder{mutate: func(p *packet) {
+				p.LiVnMode |= 3 << 6
+				p.Stratum, p.ReferenceID = 0, refID("INIT")
+			}},
+			wantErr: errUnsynchronized,
+			message: "сервер не синхронизирован: INIT",
+		},
+		{
+			name:    "неверный индикатор коррекции",
+			f:       fakeResponder{mutate: func(p *packet) { p.LiVnMode |= 3 << 6 }},
+			wantErr: ntp.ErrInvalidLeapSecond,
+		},
+		{
+			name:    "недопустимая страта",
+			f:       fakeResponder{mutate: func(p *packet) { p.Stratum = 16 }},
+			wantErr: ntp.ErrInvalidStratum,
+		},
+		{
+			name:    "устаревшее время сверки",
+			f:       fakeResponder{mutate: func(p *packet) { p.ReferenceTime -= 48 * 3600 << 32 }},
+			wantErr: ntp.ErrServerClockFreshness,
+		},
+		{
+			name:    "не ответ сервера",
+			f:       fakeResponder{mutate: func(p *packet) { p.LiVnMode = p.LiVnMode&^0x07 | modeClient }},
+			wantErr: ntp.ErrInvalidMode,
+		},
+		{
+			name:    "ответ на чужой запрос",
+			f:       fakeResponder{mutate: func(p *packet) { p.OriginTime++ }},
+			wantErr: ntp.ErrServerResponseMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startResponder(t, tt.f)
+			r := queryServers(ntpSource{}, config{Servers: []string{addr}, Timeout: 2 * time.Second, Version: 4})[0]
+			assert.ErrorIs(t, r.Err, tt.wantErr)
+			if tt.message != "" {
+				assert.EqualError(t, r.Err, tt.message)
+			}
+		})
+	}
+
+	t.Run("таймаут", func(t *testing.T) {
+		addr := startResponder(t, fakeResponder{silent: true})
+		start := time.Now()
+		r := queryServers(ntpSource{}, config{Servers: []string{addr}, Timeout: 100 * time.Millisecond, Version: 4})[0]
+		var netErr net.Error
+		if assert.True(t, errors.As(r.Err, &netErr), "Ожидалась сетевая ошибка, получено %v", r.Err) {
+			assert.True(t, netErr.Timeout(), "Молчащий сервер дает ошибку таймаута")
+		}
+		assert.Nil(t, r.Response)
+		assert.Less(t, time.Since(start), time.Second, "Таймаут должен соблюдаться")
+	})
+}
+
+func TestRun_ErrorPaths(t *testing.T) {
+	good := startResponder(t, fakeResponder{})
+	kod := startResponder(t, fakeResponder{mutate: func(p *packet) { p.Stratum, p.ReferenceID = 0, refID("DENY") }})
+	silent := startResponder(t, fakeResponder{silent: true})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-timeout", "200ms", good, good, kod}, &stdout, &stderr, ntpSource{})
+	assert.Equal(t, 0, code, "Большинство серверов ответило: %s", stderr.String())
+	assert.Contains(t, stdout.String(), "Точное время (NTP):")
+	assert.Contains(t, stderr.String(), kod+": kiss of death received: DENY")
 
-	// Проверка, что текущее время близко к точному времени (с погрешностью около 1 секунды)
-	assert.InDelta(t, expectedTime.Unix(), ntpTime.Unix(), 1, "Точное время должно быть близко к текущему времени")
+	stdout.Reset()
+	stderr.Reset()
+	code = run(context.Background(), []string{"-timeout", "200ms", good, kod, silent}, &stdout, &stderr, ntpSource{})
+	assert.Equal(t, 1, code, "Без ответа большинства код выхода ненулевой")
+	assert.Contains(t, stderr.String(), silent+": ")
+	assert.Contains(t, stderr.String(), "timeout")
+	assert.Contains(t, stderr.String(), "нет согласия большинства серверов")
 }
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// sample — одно измерение в режиме наблюдения -watch.
+type sample struct {
+	// Time — момент измерения по локальным часам.
+	Time time.Time
+	// Offset, Low и High — согласованное смещение и его границы.
+	Offset, Low, High time.Duration
+	// Agreed — сколько серверов из Servers согласны со смещением.
+	Agreed, Servers int
+	// Drift — скорость изменения смещения в миллионных долях (ppm) по
+	// измерениям в окне; положительная означает, что локальные часы отстают.
+	// HasDrift ложно, пока в окне меньше двух измерений.
+	Drift    float64
+	HasDrift bool
+	// Alert — смещение по модулю превышает порог.
+	Alert bool
+	// Err — ошибка измерения; остальные поля, кроме Time, тогда не заполнены.
+	Err error
+}
+
+// driftPoint — измерение, учитываемое при оценке дрейфа.
+type driftPoint struct {
+	at     time.Time
+	offset time.Duration
+}
+
+// driftEstimator оценивает дрейф часов линейной регрессией смещения по
+// времени на скользящем окне измерений.
+type driftEstimator struct {
+	window time.Duration
+	points []driftPoint
+}
+
+// add учитывает измерение и забывает вышедшие из окна.
+func (d *driftEstimator) add(at time.Time, offset time.Duration) {
+	d.points = append(d.points, driftPoint{at: at, offset: offset})
+	i := 0
+	for i < len(d.points) && at.Sub(d.points[i].at) > d.window {
+		i++
+	}
+	d.points = d.points[i:]
+}
+
+// ppm возвращает наклон прямой наименьших квадратов в миллионных долях.
+func (d *driftEstimator) ppm() (float64, bool) {
+	if len(d.points) < 2 {
+		return 0, false
+	}
+	// Время отсчитывается от первого измерения, чтобы не терять точность.
+	origin := d.points[0].at
+	var sumX, sumY float64
+	for _, p := range d.points {
+		sumX += p.at.Sub(origin).Seconds()
+		sumY += p.offset.Seconds()
+	}
+	n := float64(len(d.points))
+	meanX, meanY := sumX/n, sumY/n
+	var sxy, sxx float64
+	for _, p := range d.points {
+		dx := p.at.Sub(origin).Seconds() - meanX
+		sxy += dx * (p.offset.Seconds() - meanY)
+		sxx += dx * dx
+	}
+	if sxx == 0 {
+		return 0, false
+	}
+	return sxy / sxx * 1e6, true
+}
+
+// sampleWriter выводит измерения в выбранном формате.
+type sampleWriter interface {
+	Write(s sample) error
+}
+
+// newSampleWriter возвращает вывод измерений в формате format.
+func newSampleWriter(w io.Writer, format string) sampleWriter {
+	switch format {
+	case formatJSON:
+		return jsonSampleWriter{enc: json.NewEncoder(w)}
+	case formatCSV:
+		return &csvSampleWriter{w: csv.NewWriter(w)}
+	default:
+		return textSampleWriter{w: w}
+	}
+}
+
+// textSampleWriter печатает измерения строками для человека.
+type textSampleWriter struct {
+	w io.Writer
+}
+
+func (t textSampleWriter) Write(s sample) error {
+	at := s.Time.Format(time.RFC3339)
+	if s.Err != nil {
+		_, err := fmt.Fprintf(t.w, "%s ошибка: %v\n", at, s.Err)
+		return err
+	}
+	drift := "н/д"
+	if s.HasDrift {
+		drift = fmt.Sprintf("%+.3f ppm", s.Drift)
+	}
+	mark := ""
+	if s.Alert {
+		mark = " ПРЕВЫШЕН ПОРОГ"
+	}
+	_, err := fmt.Fprintf(t.w, "%s смещение %s (от %s до %s), дрейф %s, согласны %d из %d%s\n",
+		at, signed(s.Offset), signed(s.Low), signed(s.High), drift, s.Agreed, s.Servers, mark)
+	return err
+}
+
+// csvHeader — заголовок вывода -format csv. Смещения указаны в секундах.
+var csvHeader = []string{"time", "offset", "low", "high", "drift_ppm", "agreed", "servers", "alert", "error"}
+
+// csvSampleWriter выводит измерения в CSV с заголовком перед первым.
+type csvSampleWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvSampleWriter) Write(s sample) error {
+	if !c.headerWritten {
+		c.w.Write(csvHeader)
+		c.headerWritten = true
+	}
+	record := []string{s.Time.Format(time.RFC3339Nano), "", "", "", "", "", strconv.Itoa(s.Servers), "false", ""}
+	if s.Err != nil {
+		record[8] = s.Err.Error()
+	} else {
+		record[1] = formatSeconds(s.Offset)
+		record[2] = formatSeconds(s.Low)
+		record[3] = formatSeconds(s.High)
+		if s.HasDrift {
+			record[4] = strconv.FormatFloat(s.Drift, 'f', 3, 64)
+		}
+		record[5] = strconv.Itoa(s.Agreed)
+		record[7] = strconv.FormatBool(s.Alert)
+	}
+	c.w.Write(record)
+	// Каждое измерение сразу попадает в вывод, чтобы его можно было читать из канала.
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatSeconds записывает длительность в секундах.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// jsonSample — измерение в выводе -format json. Смещения указаны в секундах.
+type jsonSample struct {
+	Time     time.Time `json:"time"`
+	Offset   *float64  `json:"offset,omitempty"`
+	Low      *float64  `json:"low,omitempty"`
+	High     *float64  `json:"high,omitempty"`
+	DriftPPM *float64  `json:"drift_ppm,omitempty"`
+	Agreed   int       `json:"agreed"`
+	Servers  int       `json:"servers"`
+	Alert    bool      `json:"alert"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// jsonSampleWriter выводит измерения по одному JSON объекту в строке.
+type jsonSampleWriter struct {
+	enc *json.Encoder
+}
+
+func (j jsonSampleWriter) Write(s sample) error {
+	out := jsonSample{Time: s.Time, Agreed: s.Agreed, Servers: s.Servers, Alert: s.Alert}
+	if s.Err != nil {
+		out.Error = s.Err.Error()
+	} else {
+		offset, low, high := s.Offset.Seconds(), s.Low.Seconds(), s.High.Seconds()
+		out.Offset, out.Low, out.High = &offset, &low, &high
+		if s.HasDrift {
+			out.DriftPPM = &s.Drift
+		}
+	}
+	return j.enc.Encode(out)
+}
+
+// watch опрашивает серверы каждые cfg.Interval, пока не отменен ctx или не
+// сделано cfg.Count измерений, и выводит измерения в stdout. О превышении
+// порога смещения и об ошибках измерений сообщается в stderr. Код выхода
+// равен 1, если не удалось ни одно измерение или вывод, иначе 0.
+func watch(ctx context.Context, cfg config, stdout, stderr io.Writer, src TimeSource, now func() time.Time) int {
+	out := newSampleWriter(stdout, cfg.Format)
+	drift := &driftEstimator{window: cfg.Window}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	succeeded := false
+	// result возвращает код выхода по итогам наблюдения.
+	result := func() int {
+		if !succeeded {
+			fmt.Fprintln(stderr, "Ошибка: не удалось ни одно измерение")
+			return 1
+		}
+		return 0
+	}
+	for n := 0; cfg.Count == 0 || n < cfg.Count; n++ {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return result()
+			case <-ticker.C:
+			}
+		}
+
+		results := queryServers(src, cfg)
+		s := sample{Time: now(), Servers: len(results)}
+		c, err := selectConsensus(results)
+		if err != nil {
+			s.Err = err
+			fmt.Fprintf(stderr, "%s ошибка измерения: %v\n", s.Time.Format(time.RFC3339), err)
+		} else {
+			succeeded = true
+			s.Offset, s.Low, s.High = c.Offset, c.Low, c.High
+			s.Agreed = len(c.Truechimers)
+			drift.add(s.Time, s.Offset)
+			s.Drift, s.HasDrift = drift.ppm()
+			s.Alert = s.Offset > cfg.Threshold || s.Offset < -cfg.Threshold
+			if s.Alert {
+				fmt.Fprintf(stderr, "%s ВНИМАНИЕ: смещение %s превышает порог %s\n", s.Time.Format(time.RFC3339), signed(s.Offset), cfg.Threshold)
+			}
+		}
+		if err := out.Write(s); err != nil {
+			fmt.Fprintln(stderr, "Ошибка вывода:", err)
+			return 1
+		}
+	}
+	return result()
+}
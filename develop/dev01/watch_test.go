@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriftEstimator(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	d := &driftEstimator{window: 10 * time.Minute}
+	_, ok := d.ppm()
+	assert.False(t, ok, "Без измерений дрейф неизвестен")
+
+	d.add(start, 0)
+	_, ok = d.ppm()
+	assert.False(t, ok, "По одному измерению дрейф неизвестен")
+
+	// Смещение растет на 3 мс в минуту: 50 ppm.
+	for i := 1; i <= 5; i++ {
+		d.add(start.Add(time.Duration(i)*time.Minute), time.Duration(i)*3*time.Millisecond)
+	}
+	ppm, ok := d.ppm()
+	assert.True(t, ok)
+	assert.InDelta(t, 50, ppm, 1e-6)
+
+	// Через 20 минут старые измерения выходят из окна, и остается новый наклон.
+	d.add(start.Add(20*time.Minute), 0)
+	d.add(start.Add(21*time.Minute), -6*time.Millisecond)
+	assert.Len(t, d.points, 2, "Измерения вне окна должны забываться")
+	ppm, _ = d.ppm()
+	assert.InDelta(t, -100, ppm, 1e-6)
+}
+
+// fakeClock — часы, которые сдвигаются на step при каждом чтении.
+type fakeClock struct {
+	mu   sync.Mutex
+	t    time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) peek() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.t
+	c.t = c.t.Add(c.step)
+	return t
+}
+
+func TestWatch(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start, step: time.Minute}
+	// Локальные часы отстают на 1000 ppm: смещение растет на 60 мс в минуту.
+	query := sourceFunc(func(server string, opt ntp.QueryOptions) (*ntp.Response, error) {
+		if server == "down.example" {
+			return nil, errors.New("i/o timeout")
+		}
+		elapsed := clock.peek().Sub(start)
+		return validResponse(50*time.Millisecond + elapsed/1000), nil
+	})
+	cfg := config{
+		Servers:   []string{"a.example"},
+		Timeout:   time.Second,
+		Version:   4,
+		Format:    formatCSV,
+		Interval:  time.Millisecond,
+		Count:     3,
+		Threshold: 100 * time.Millisecond,
+		Window:    time.Hour,
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, watch(context.Background(), cfg, &stdout, &stderr, query, clock.now))
+	records, err := csv.NewReader(&stdout).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 4, "Заголовок и три измерения") {
+		assert.Equal(t, csvHeader, records[0])
+		assert.Equal(t, []string{"2024-03-01T12:00:00Z", "0.05", "0.04", "0.06", "", "1", "1", "false", ""}, records[1])
+		assert.Equal(t, "0.11", records[2][1])
+		assert.Equal(t, "true", records[2][7], "Смещение 110 мс превышает порог")
+		assert.Equal(t, "1000.000", records[3][4], "Дрейф по линейной регрессии")
+	}
+	assert.Equal(t, 2, strings.Count(stderr.String(), "ВНИМАНИЕ"), "О превышении порога сообщается в stderr")
+
+	// Ошибка измерения выводится и не прерывает наблюдение; так как не
+	// удалось ни одно измерение, код выхода ненулевой.
+	stdout.Reset()
+	stderr.Reset()
+	cfg.Servers = []string{"a.example", "down.example", "down.example"}
+	cfg.Format = formatJSON
+	cfg.Count = 2
+	assert.Equal(t, 1, watch(context.Background(), cfg, &stdout, &stderr, query, clock.now))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, 2)
+	var s jsonSample
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &s))
+	assert.Contains(t, s.Error, "нет согласия большинства серверов")
+	assert.Nil(t, s.Offset, "У неудачного измерения нет смещения")
+	assert.Equal(t, 3, s.Servers)
+	assert.Contains(t, stderr.String(), "ошибка измерения")
+
+	// Без ограничения числа измерений наблюдение идет до отмены контекста.
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg.Count = 0
+	cfg.Servers = []string{"a.example"}
+	done := make(chan int)
+	go func() { done <- watch(ctx, cfg, &bytes.Buffer{}, &bytes.Buffer{}, query, clock.now) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case code := <-done:
+		assert.Equal(t, 0, code)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Наблюдение не остановилось после отмены контекста")
+	}
+}
+
+func TestWatch_AllSamplesFailed(t *testing.T) {
+	down := sourceFunc(func(server string, opt ntp.QueryOptions) (*ntp.Response, error) {
+		return nil, errors.New("i/o timeout")
+	})
+	cfg := config{
+		Servers:   []string{"a.example", "b.example"},
+		Timeout:   time.Second,
+		Version:   4,
+		Format:    formatJSON,
+		Interval:  time.Millisecond,
+		Count:     3,
+		Threshold: 100 * time.Millisecond,
+		Window:    time.Hour,
+	}
+
+	var stdout, stderr bytes.Buffer
+	clock := &fakeClock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), step: time.Minute}
+	assert.Equal(t, 1, watch(context.Background(), cfg, &stdout, &stderr, down, clock.now), "Без единого удачного измерения код выхода ненулевой")
+	assert.Len(t, strings.Split(strings.TrimSpace(stdout.String()), "\n"), 3, "Неудачные измерения все равно выводятся")
+	assert.Contains(t, stderr.String(), "не удалось ни одно измерение")
+
+	// То же при остановке наблюдения без ограничения числа измерений.
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg.Count = 0
+	done := make(chan int)
+	go func() { done <- watch(ctx, cfg, &bytes.Buffer{}, &bytes.Buffer{}, down, clock.now) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case code := <-done:
+		assert.Equal(t, 1, code)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Наблюдение не остановилось после отмены контекста")
+	}
+}
+
+func TestParseArgs_Watch(t *testing.T) {
+	cfg, err := parseArgs([]string{"-watch", "-interval", "10s", "-count", "5", "-threshold", "50ms", "-window", "30m", "-format", "csv"}, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Watch)
+	assert.Equal(t, 10*time.Second, cfg.Interval)
+	assert.Equal(t, 5, cfg.Count)
+	assert.Equal(t, 50*time.Millisecond, cfg.Threshold)
+	assert.Equal(t, 30*time.Minute, cfg.Window)
+
+	for _, args := range [][]string{
+		{"-format", "csv"},
+		{"-watch", "-interval", "0s"},
+		{"-watch", "-count", "-1"},
+		{"-watch", "-threshold", "0s"},
+		{"-watch", "-window", "0s"},
+	} {
+		_, err := parseArgs(args, &bytes.Buffer{})
+		assert.Error(t, err, "Аргументы %q должны быть отклонены", args)
+	}
+}
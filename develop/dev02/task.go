@@ -2,7 +2,10 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -41,15 +44,30 @@ func isAlpha(r rune) bool {
 	return false
 }
 
-// Функция записывает руну ch в builder cnt раз
-func write(ch rune, b *strings.Builder, cnt int) {
-	for i := 0; i < cnt; i++ {
-		b.WriteString(string(ch))
+// Функция распоковывает строку. Результат длиннее defaultMaxSize байт
+// считается ошибкой errTooLarge
+func extract(s string) (string, error) {
+	builder := strings.Builder{}
+	if _, err := (&Unpacker{MaxSize: defaultMaxSize}).Unpack(strings.NewReader(s), &builder); err != nil {
+		return "", err
 	}
+	return builder.String(), nil
 }
 
-// Функция распоковывает строку
-func extract(s string) (string, error) {
+// Функция возвращает запись руны в упакованной строке: цифры и обратная
+// косая черта экранируются
+func token(r rune) string {
+	if isAlpha(r) {
+		return string(r)
+	}
+	return `\` + string(r)
+}
+
+// Функция упаковывает строку, обратно extract: extract(pack(s)) == s для
+// любой корректной UTF-8 строки. Серия из n одинаковых рун записывается
+// числом, если так не длиннее, как в "a4bc2d5e", поэтому результат — кратчайшая упакованная
+// запись s
+func pack(s string) string {
 	arr := []rune(s)
 
 	builder := strings.Builder{}
@@ -57,49 +75,85 @@ func extract(s string) (string, error) {
 	ind := 0
 	for ind < len(arr) {
 		curCh := arr[ind]
-		if isAlpha(curCh) {
-			builder.WriteString(string(curCh))
-		} else if isDigit(curCh) {
-			cnt := 0
-
-			j := ind
-			prevInd := ind
-			for j < len(arr) && isDigit(arr[j]) {
-				buf, _ := strconv.Atoi(string(arr[j]))
-				cnt = cnt*10 + buf
-				j++
-				ind++
-			}
-			if prevInd > 0 {
-				write(arr[prevInd-1], &builder, cnt-1)
-			} else {
-				return "", errors.New("wrong string")
-			}
-			continue
-		} else if string(curCh) == `\` {
-			if ind < len(arr)-1 {
-				builder.WriteString(string(arr[ind+1]))
-				ind++
-			} else {
-				return "", errors.New("wrong string")
+		cnt := 1
+		for ind+cnt < len(arr) && arr[ind+cnt] == curCh {
+			cnt++
+		}
+
+		tok := token(curCh)
+		tokLen := len([]rune(tok))
+		num := strconv.Itoa(cnt)
+		if cnt > 1 && tokLen+len(num) <= cnt*tokLen {
+			builder.WriteString(tok)
+			builder.WriteString(num)
+		} else {
+			for i := 0; i < cnt; i++ {
+				builder.WriteString(tok)
 			}
 		}
-		ind++
+		ind += cnt
 	}
 
-	return builder.String(), nil
+	return builder.String()
+}
+
+// Функция распаковывает файлы из args (или стандартный ввод, если файлов
+// нет или имя файла "-") в stdout и возвращает код выхода: 0 при успехе,
+// 1 при ошибке распаковки или чтения, 2 при неверных аргументах. Предел
+// -max действует для каждого входа отдельно
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("dev02", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	maxSize := fs.Int64("max", defaultMaxSize, "максимальный размер результата для одного входа в байтах (0 — без ограничения)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Использование: dev02 [-max байт] [файл ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *maxSize < 0 {
+		fmt.Fprintln(stderr, "Ошибка: -max не может быть отрицательным")
+		return 2
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	u := &Unpacker{MaxSize: *maxSize}
+	code := 0
+	for _, name := range files {
+		if err := unpackFile(u, name, stdin, stdout); err != nil {
+			fmt.Fprintln(stderr, "Ошибка:", err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// Функция распаковывает один вход: файл name или stdin, если name равно "-"
+func unpackFile(u *Unpacker, name string, stdin io.Reader, stdout io.Writer) error {
+	in := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	} else {
+		name = "stdin"
+	}
+	if _, err := u.Unpack(in, stdout); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
 }
 
 func main() {
-	fmt.Println(extract(`a\`))
-	fmt.Println(extract(`a4bc2d5e`))
-	fmt.Println(extract(`abcd`))
-	fmt.Println(extract(`a11b`))
-	fmt.Println(extract(`a12`))
-	fmt.Println(extract(`45`))
-	fmt.Println(extract(``))
-	fmt.Println(extract(`qwe\4\5`))
-	fmt.Println(extract(`qwe\45`))
-	fmt.Println(extract(`qwe\\5`))
-	fmt.Println(extract(`qwe\\`))
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
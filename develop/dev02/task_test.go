@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"testing"
+	"unicode/utf8"
+)
 
 func Test_extract(t *testing.T) {
 	var table = []struct {
@@ -28,6 +31,11 @@ func Test_extract(t *testing.T) {
 			expectedOut: `qwe44444`,
 			err:         false,
 		},
+		{
+			input:       `a99999999`,
+			expectedOut: ``,
+			err:         true,
+		},
 	}
 
 	for _, test := range table {
@@ -37,3 +45,87 @@ func Test_extract(t *testing.T) {
 		}
 	}
 }
+
+func Test_pack(t *testing.T) {
+	var table = []struct {
+		input       string
+		expectedOut string
+	}{
+		{input: ``, expectedOut: ``},
+		{input: `abcd`, expectedOut: `abcd`},
+		{input: `aaaabccddddde`, expectedOut: `a4bc2d5e`},
+		{input: `aab`, expectedOut: `a2b`},
+		{input: `aaaaaaaaaaaa`, expectedOut: `a12`},
+		{input: `qwe45`, expectedOut: `qwe\4\5`},
+		{input: `qwe44444`, expectedOut: `qwe\45`},
+		{input: `qwe44`, expectedOut: `qwe\42`},
+		{input: `qwe\\\\\`, expectedOut: `qwe\\5`},
+		{input: `ффффё`, expectedOut: `ф4ё`},
+	}
+
+	for _, test := range table {
+		out := pack(test.input)
+		if out != test.expectedOut {
+			t.Errorf("pack(%q) = %q, want %q", test.input, out, test.expectedOut)
+		}
+	}
+}
+
+// Функция проверяет, что в упакованной строке нет чисел длиннее maxDigits,
+// чтобы распаковка в тестах не занимала слишком много памяти
+func smallCounts(s string, maxDigits int) bool {
+	arr := []rune(s)
+	digits := 0
+	for ind := 0; ind < len(arr); ind++ {
+		switch {
+		case arr[ind] == '\\':
+			ind++
+			digits = 0
+		case isDigit(arr[ind]):
+			digits++
+			if digits > maxDigits {
+				return false
+			}
+		default:
+			digits = 0
+		}
+	}
+	return true
+}
+
+func FuzzPack(f *testing.F) {
+	for _, seed := range []string{``, `abcd`, `aaaabccddddde`, `qwe45`, `qwe44444`, `qwe\\\\\`, `\`, `ффффё`, `0000000000`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) {
+			t.Skip("extract работает с рунами, а не с байтами")
+		}
+		packed := pack(s)
+		out, err := extract(packed)
+		if err != nil {
+			t.Fatalf("extract(pack(%q)) = %q: %v", s, packed, err)
+		}
+		if out != s {
+			t.Fatalf("extract(pack(%q)) = %q via %q", s, out, packed)
+		}
+	})
+}
+
+func FuzzPackShortest(f *testing.F) {
+	for _, seed := range []string{`a4bc2d5e`, `aa`, `a2`, `a1a1`, `a0`, `\a\a`, `\42`, `\4\4`, `\\3`, `aa3`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, packed string) {
+		if !utf8.ValidString(packed) || !smallCounts(packed, 3) {
+			t.Skip()
+		}
+		s, err := extract(packed)
+		if err != nil {
+			t.Skip()
+		}
+		if got := pack(s); utf8.RuneCountInString(got) > utf8.RuneCountInString(packed) {
+			t.Fatalf("pack(%q) = %q, longer than valid packing %q", s, got, packed)
+		}
+	})
+}
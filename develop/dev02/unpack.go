@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// Ошибки распаковки; возвращаются внутри UnpackError
+var (
+	errCountWithoutRune = errors.New("число без повторяемого символа")
+	errTrailingEscape   = errors.New("незавершенная escape-последовательность")
+	errTooLarge         = errors.New("превышен максимальный размер результата")
+)
+
+// UnpackError — ошибка в упакованных данных. Offset — смещение в байтах
+// от начала входа до символа, на котором обнаружена ошибка
+type UnpackError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *UnpackError) Error() string {
+	return fmt.Sprintf("байт %d: %v", e.Offset, e.Err)
+}
+
+func (e *UnpackError) Unwrap() error {
+	return e.Err
+}
+
+// defaultMaxSize — предел результата для extract и флага -max по умолчанию
+const defaultMaxSize = 64 << 20
+
+// countingWriter считает байты, принятые нижележащим writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unpacker распаковывает строки по тем же правилам, что и extract, но
+// читает вход и пишет результат по частям, не держа его в памяти целиком
+type Unpacker struct {
+	// MaxSize — максимальный размер результата в байтах; 0 — без ограничения.
+	// Распаковка останавливается до записи байта, превышающего предел
+	MaxSize int64
+}
+
+// Функция распаковывает данные из r в w и возвращает число байт, фактически
+// принятых w. При ошибке уже распакованная часть остается записанной в w
+func (u *Unpacker) Unpack(r io.Reader, w io.Writer) (int64, error) {
+	limit := u.MaxSize
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+
+	in := bufio.NewReader(r)
+	counter := &countingWriter{w: w}
+	out := bufio.NewWriter(counter)
+
+	var (
+		offset  int64  // смещение следующего символа во входе
+		written int64  // сколько байт результата выдано, включая буфер out
+		prev    []byte // последний записанный символ в UTF-8
+		cnt     int64  // число повторений, пока читаются его цифры
+		counted bool   // после символа встретились цифры
+	)
+
+	// Функция дописывает повторения prev, заданные прочитанным числом
+	repeat := func() error {
+		for ; counted && cnt > 1; cnt-- {
+			if _, err := out.Write(prev); err != nil {
+				return err
+			}
+			written += int64(len(prev))
+		}
+		cnt, counted = 0, false
+		return nil
+	}
+
+	// Функция возвращает ошибку в данных, сохранив уже распакованное
+	fail := func(at int64, err error) (int64, error) {
+		if ferr := out.Flush(); ferr != nil {
+			return counter.n, ferr
+		}
+		return counter.n, &UnpackError{Offset: at, Err: err}
+	}
+
+	for {
+		ch, size, err := in.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			out.Flush()
+			return counter.n, err
+		}
+		at := offset
+		offset += int64(size)
+
+		if isDigit(ch) {
+			if prev == nil {
+				return fail(at, errCountWithoutRune)
+			}
+			digit := int64(ch - '0')
+			if cnt > (math.MaxInt64-digit)/10 {
+				return fail(at, errTooLarge)
+			}
+			cnt = cnt*10 + digit
+			counted = true
+			// Повторений, кроме уже записанного символа, не больше, чем помещается в предел
+			if cnt-1 > (limit-written)/int64(len(prev)) {
+				return fail(at, errTooLarge)
+			}
+			continue
+		}
+
+		if err := repeat(); err != nil {
+			return counter.n, err
+		}
+		if ch == '\\' {
+			ch, size, err = in.ReadRune()
+			if err == io.EOF {
+				return fail(at, errTrailingEscape)
+			}
+			if err != nil {
+				out.Flush()
+				return counter.n, err
+			}
+			offset += int64(size)
+		}
+
+		prev = utf8.AppendRune(prev[:0], ch)
+		if int64(len(prev)) > limit-written {
+			return fail(at, errTooLarge)
+		}
+		if _, err := out.Write(prev); err != nil {
+			return counter.n, err
+		}
+		written += int64(len(prev))
+	}
+
+	if err := repeat(); err != nil {
+		return counter.n, err
+	}
+	err := out.Flush()
+	return counter.n, err
+}
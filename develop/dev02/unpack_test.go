@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+func Test_Unpacker(t *testing.T) {
+	var table = []struct {
+		input       string
+		maxSize     int64
+		expectedOut string
+		err         error
+		offset      int64
+	}{
+		{input: `a4bc2d5e`, expectedOut: `aaaabccddddde`},
+		{input: ``, expectedOut: ``},
+		{input: `qwe\45`, expectedOut: `qwe44444`},
+		{input: `qwe\\5`, expectedOut: `qwe\\\\\`},
+		{input: `a0b1`, expectedOut: `ab`},
+		{input: `ф3`, expectedOut: `ффф`},
+		{input: `a3`, maxSize: 3, expectedOut: `aaa`},
+		{input: `45`, err: errCountWithoutRune, offset: 0},
+		{input: `ab\`, expectedOut: `ab`, err: errTrailingEscape, offset: 2},
+		{input: `фa\`, expectedOut: `фa`, err: errTrailingEscape, offset: 3},
+		{input: `ab`, maxSize: 1, expectedOut: `a`, err: errTooLarge, offset: 1},
+		{input: `ф2`, maxSize: 3, expectedOut: `ф`, err: errTooLarge, offset: 2},
+		{input: `xa999999999`, maxSize: 1000, expectedOut: `xa`, err: errTooLarge, offset: 5},
+		{input: `a99999999999999999999`, expectedOut: `a`, err: errTooLarge, offset: 19},
+	}
+
+	for _, test := range table {
+		var out bytes.Buffer
+		u := &Unpacker{MaxSize: test.maxSize}
+		n, err := u.Unpack(strings.NewReader(test.input), &out)
+		if out.String() != test.expectedOut || n != int64(out.Len()) {
+			t.Errorf("Unpack(%q) wrote %q (%d bytes), want %q", test.input, out.String(), n, test.expectedOut)
+		}
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("Unpack(%q): unexpected error %v", test.input, err)
+			}
+			continue
+		}
+		var unpackErr *UnpackError
+		if !errors.Is(err, test.err) || !errors.As(err, &unpackErr) || unpackErr.Offset != test.offset {
+			t.Errorf("Unpack(%q) error = %v, want %v at byte %d", test.input, err, test.err, test.offset)
+		}
+	}
+}
+
+// failWriter принимает limit байт, а затем возвращает ошибку
+type failWriter struct {
+	limit int
+}
+
+var errWrite = errors.New("write failed")
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errWrite
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func Test_Unpacker_Stream(t *testing.T) {
+	// Вход читается по байту, а миллион повторений не собирается в памяти
+	u := &Unpacker{}
+	n, err := u.Unpack(iotest.OneByteReader(strings.NewReader(`фa1000000b`)), io.Discard)
+	if err != nil || n != 1000003 {
+		t.Errorf("Unpack wrote %d bytes, %v; want 1000003", n, err)
+	}
+
+	var out bytes.Buffer
+	_, err = u.Unpack(iotest.DataErrReader(iotest.TimeoutReader(strings.NewReader(`a3bc`))), &out)
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("read error = %v, want %v", err, iotest.ErrTimeout)
+	}
+
+	// Возвращается число байт, принятых writer, а не попавших в буфер
+	n, err = u.Unpack(strings.NewReader(`a100000`), &failWriter{limit: 10000})
+	if !errors.Is(err, errWrite) || n != 10000 {
+		t.Errorf("Unpack into failing writer = %d, %v; want 10000, %v", n, err, errWrite)
+	}
+	n, err = u.Unpack(strings.NewReader(`a3`), &failWriter{limit: 1})
+	if !errors.Is(err, errWrite) || n != 1 {
+		t.Errorf("Unpack with failing flush = %d, %v; want 1, %v", n, err, errWrite)
+	}
+}
+
+func FuzzUnpacker(f *testing.F) {
+	for _, seed := range []string{``, `abcd`, `aaaabccddddde`, `qwe45`, `qwe\\\\\`, `ффффё`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) {
+			t.Skip()
+		}
+		packed := pack(s)
+
+		var out bytes.Buffer
+		u := &Unpacker{MaxSize: int64(len(s))}
+		if _, err := u.Unpack(strings.NewReader(packed), &out); err != nil || out.String() != s {
+			t.Fatalf("Unpack(%q) = %q, %v; want %q", packed, out.String(), err, s)
+		}
+		// Предел 0 означает отсутствие ограничения, поэтому меньший предел
+		// проверяется только для результатов длиннее байта
+		if len(s) < 2 {
+			return
+		}
+
+		out.Reset()
+		u.MaxSize--
+		if _, err := u.Unpack(strings.NewReader(packed), &out); !errors.Is(err, errTooLarge) || out.Len() > len(s)-1 {
+			t.Fatalf("Unpack(%q) with limit %d wrote %d bytes, %v", packed, u.MaxSize, out.Len(), err)
+		}
+	})
+}
+
+func Test_run(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	bad := filepath.Join(dir, "bad.txt")
+	os.WriteFile(good, []byte(`a4bc2`), 0o644)
+	os.WriteFile(bad, []byte(`ab\`), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{good, "-", good}, strings.NewReader(`d3`), &stdout, &stderr)
+	if code != 0 || stdout.String() != `aaaabccdddaaaabcc` {
+		t.Errorf("run = %d, %q, %q", code, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{bad, filepath.Join(dir, "missing.txt"), good}, nil, &stdout, &stderr)
+	if code != 1 || stdout.String() != `abaaaabcc` {
+		t.Errorf("run = %d, %q", code, stdout.String())
+	}
+	if !strings.Contains(stderr.String(), bad+": байт 2: незавершенная escape-последовательность") ||
+		!strings.Contains(stderr.String(), "missing.txt") {
+		t.Errorf("unexpected stderr %q", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{"-max", "3"}, strings.NewReader(`a39`), &stdout, &stderr)
+	if code != 1 || stdout.String() != `a` || !strings.Contains(stderr.String(), "stdin: байт 2: превышен максимальный размер результата") {
+		t.Errorf("run = %d, %q, %q", code, stdout.String(), stderr.String())
+	}
+
+	if code := run([]string{"-max", "-1"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("run with negative -max = %d, want 2", code)
+	}
+}
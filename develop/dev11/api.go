@@ -0,0 +1,651 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы даты и времени суток в параметрах запросов.
+const (
+	dateLayout  = "2006-01-02"
+	clockLayout = "15:04"
+)
+
+// paramError описывает ошибку входных данных запроса.
+type paramError struct {
+	name   string
+	reason string
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("invalid parameter %q: %s", e.name, e.reason)
+}
+
+// resultResponse — JSON документ успешного ответа.
+type resultResponse struct {
+	Result interface{} `json:"result"`
+}
+
+// eventResponse — JSON документ ответа на создание и изменение события.
+// Conflicts перечисляет экземпляры других событий, пересекающиеся с ним.
+type eventResponse struct {
+	Result    Event   `json:"result"`
+	Conflicts []Event `json:"conflicts,omitempty"`
+}
+
+// errorResponse — JSON документ ответа с ошибкой.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON сериализует v в JSON и записывает его в ответ с указанным кодом.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		recordError(w, fmt.Errorf("encode response: %w", err))
+	}
+}
+
+// writeResult записывает успешный ответ {"result": ...}.
+func writeResult(w http.ResponseWriter, result interface{}) {
+	writeJSON(w, http.StatusOK, resultResponse{Result: result})
+}
+
+// writeError записывает ответ {"error": ...}, выбирая код по типу ошибки:
+// 400 для ошибок входных данных, 401 и 403 для ошибок доступа, 503 для ошибок
+// бизнес-логики, 500 для остальных.
+func writeError(w http.ResponseWriter, err error) {
+	var pErr *paramError
+	var bErr *BusinessError
+	var aErr *authError
+	var mErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &mErr):
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: fmt.Sprintf("request body exceeds %d bytes", mErr.Limit)})
+	case errors.As(err, &pErr):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	case errors.As(err, &aErr):
+		writeJSON(w, aErr.status, errorResponse{Error: err.Error()})
+	case errors.As(err, &bErr):
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+	default:
+		recordError(w, err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal server error"})
+	}
+}
+
+// parseIntParam читает обязательный положительный целочисленный параметр.
+func parseIntParam(values url.Values, name string) (int, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return 0, &paramError{name: name, reason: "is required"}
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, &paramError{name: name, reason: "must be an integer"}
+	}
+	if n <= 0 {
+		return 0, &paramError{name: name, reason: "must be positive"}
+	}
+	return n, nil
+}
+
+// parseDateParam читает обязательный параметр даты в формате YYYY-MM-DD.
+// Дата задает полночь в часовом поясе loc.
+func parseDateParam(values url.Values, name string, loc *time.Location) (time.Time, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return time.Time{}, &paramError{name: name, reason: "is required"}
+	}
+	date, err := time.ParseInLocation(dateLayout, raw, loc)
+	if err != nil {
+		return time.Time{}, &paramError{name: name, reason: "must be a date in YYYY-MM-DD format"}
+	}
+	return date, nil
+}
+
+// parseClockParam читает необязательный параметр времени суток в формате HH:MM.
+func parseClockParam(values url.Values, name string) (time.Duration, bool, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return 0, false, nil
+	}
+	t, err := time.Parse(clockLayout, raw)
+	if err != nil {
+		return 0, false, &paramError{name: name, reason: "must be a time in HH:MM format"}
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true, nil
+}
+
+// parseLocationParam читает необязательный параметр часового пояса IANA
+// (например, Europe/Moscow). По умолчанию используется UTC.
+func parseLocationParam(values url.Values, name string) (*time.Location, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(raw)
+	if err != nil || raw == "Local" {
+		return nil, &paramError{name: name, reason: "must be an IANA time zone name"}
+	}
+	return loc, nil
+}
+
+// parseBoolParam читает необязательный логический параметр.
+func parseBoolParam(values url.Values, name string) (bool, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, &paramError{name: name, reason: "must be true or false"}
+	}
+	return v, nil
+}
+
+// eventParams — параметры методов /create_event и /update_event.
+type eventParams struct {
+	UserID int
+	Event  Event
+	Policy ConflictPolicy
+}
+
+// parseTagsParam читает необязательный параметр со списком тегов через
+// запятую (например, work,1-on-1) и приводит теги к нижнему регистру.
+func parseTagsParam(values url.Values, name string) ([]string, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	var tags []string
+	for _, s := range strings.Split(raw, ",") {
+		tag, ok := normalizeTag(s)
+		if !ok {
+			return nil, &paramError{name: name, reason: fmt.Sprintf("must be comma-separated tags of 1 to %d letters, digits, '-' or '_'", maxTagLength)}
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return nil, &paramError{name: name, reason: fmt.Sprintf("at most %d tags are allowed", maxTags)}
+	}
+	return tags, nil
+}
+
+// parseRemindersParam читает необязательный параметр reminders — за сколько
+// минут до начала события напомнить о нем, через запятую (например, 10,60).
+func parseRemindersParam(values url.Values) ([]int, error) {
+	raw := values.Get("reminders")
+	if raw == "" {
+		return nil, nil
+	}
+	var reminders []int
+	for _, s := range strings.Split(raw, ",") {
+		minutes, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || minutes < 0 || minutes > maxReminderMinutes {
+			return nil, &paramError{name: "reminders", reason: fmt.Sprintf("must be comma-separated minutes from 0 to %d", maxReminderMinutes)}
+		}
+		reminders = append(reminders, minutes)
+	}
+	if len(reminders) > maxReminders {
+		return nil, &paramError{name: "reminders", reason: fmt.Sprintf("at most %d reminders are allowed", maxReminders)}
+	}
+	return reminders, nil
+}
+
+// parseAttendeesParam читает необязательный параметр attendees — ID
+// приглашенных пользователей через запятую.
+func parseAttendeesParam(values url.Values) ([]Attendee, error) {
+	raw := values.Get("attendees")
+	if raw == "" {
+		return nil, nil
+	}
+	var attendees []Attendee
+	for _, s := range strings.Split(raw, ",") {
+		userID, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || userID <= 0 {
+			return nil, &paramError{name: "attendees", reason: "must be comma-separated user IDs"}
+		}
+		attendees = append(attendees, Attendee{UserID: userID})
+	}
+	if len(attendees) > maxAttendees {
+		return nil, &paramError{name: "attendees", reason: fmt.Sprintf("at most %d attendees are allowed", maxAttendees)}
+	}
+	return attendees, nil
+}
+
+// parseConflictPolicy читает необязательный параметр on_conflict: warn
+// (по умолчанию) сохраняет событие и перечисляет пересечения в ответе,
+// reject отклоняет событие, если оно пересекается с другими.
+func parseConflictPolicy(values url.Values) (ConflictPolicy, error) {
+	switch values.Get("on_conflict") {
+	case "", "warn":
+		return ConflictWarn, nil
+	case "reject":
+		return ConflictReject, nil
+	default:
+		return 0, &paramError{name: "on_conflict", reason: "must be warn or reject"}
+	}
+}
+
+// parseEventParams разбирает и валидирует параметры /create_event и /update_event.
+// ID события назначает сервер, поэтому event_id и version читаются только
+// при обновлении (withID).
+func parseEventParams(r *http.Request, values url.Values, withID bool) (eventParams, error) {
+	var p eventParams
+	var err error
+	if p.UserID, err = parseIntParam(values, "user_id"); err != nil {
+		return p, err
+	}
+	if withID {
+		if p.Event.ID, err = parseIntParam(values, "event_id"); err != nil {
+			return p, err
+		}
+		if p.Event.Version, err = parseVersion(r, values); err != nil {
+			return p, err
+		}
+	} else if values.Get("event_id") != "" {
+		return p, &paramError{name: "event_id", reason: "is assigned by the server"}
+	}
+	if err = parseEventTime(values, &p.Event); err != nil {
+		return p, err
+	}
+	p.Event.Name = strings.TrimSpace(values.Get("name"))
+	if p.Event.Name == "" {
+		return p, &paramError{name: "name", reason: "is required"}
+	}
+	if p.Event.Recurrence, err = parseRecurrenceParams(values); err != nil {
+		return p, err
+	}
+	if p.Event.Reminders, err = parseRemindersParam(values); err != nil {
+		return p, err
+	}
+	if p.Event.Attendees, err = parseAttendeesParam(values); err != nil {
+		return p, err
+	}
+	if p.Event.Tags, err = parseTagsParam(values, "tags"); err != nil {
+		return p, err
+	}
+	if p.Policy, err = parseConflictPolicy(values); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// parseEventTime заполняет начало, конец и часовой пояс события по параметрам:
+//   - date (YYYY-MM-DD) — дата начала, обязательна;
+//   - tz — часовой пояс IANA, по умолчанию UTC;
+//   - all_day — событие на весь день; end_date задает последний день включительно;
+//   - time (HH:MM) — время начала, по умолчанию 00:00;
+//   - end_time (HH:MM) вместе с end_date или duration (например, 1h30m) — конец события.
+func parseEventTime(values url.Values, event *Event) error {
+	loc, err := parseLocationParam(values, "tz")
+	if err != nil {
+		return err
+	}
+	if loc != time.UTC {
+		event.TimeZone = loc.String()
+	}
+	date, err := parseDateParam(values, "date", loc)
+	if err != nil {
+		return err
+	}
+	if event.AllDay, err = parseBoolParam(values, "all_day"); err != nil {
+		return err
+	}
+	endDate := date
+	if values.Get("end_date") != "" {
+		if endDate, err = parseDateParam(values, "end_date", loc); err != nil {
+			return err
+		}
+	}
+
+	if event.AllDay {
+		for _, name := range []string{"time", "end_time", "duration"} {
+			if values.Get(name) != "" {
+				return &paramError{name: name, reason: "is not allowed for all-day events"}
+			}
+		}
+		if endDate.Before(date) {
+			return &paramError{name: "end_date", reason: "must not be before date"}
+		}
+		event.Date, event.End = date, endDate.AddDate(0, 0, 1)
+		return nil
+	}
+
+	start, _, err := parseClockParam(values, "time")
+	if err != nil {
+		return err
+	}
+	event.Date = atClock(date, start)
+
+	end, hasEnd, err := parseClockParam(values, "end_time")
+	if err != nil {
+		return err
+	}
+	switch rawDuration := values.Get("duration"); {
+	case hasEnd && rawDuration != "":
+		return &paramError{name: "duration", reason: "conflicts with end_time"}
+	case hasEnd:
+		event.End = atClock(endDate, end)
+	case rawDuration != "":
+		d, err := time.ParseDuration(rawDuration)
+		if err != nil || d < 0 {
+			return &paramError{name: "duration", reason: "must be a non-negative duration like 30m or 1h30m"}
+		}
+		event.End = event.Date.Add(d)
+	default:
+		event.End = event.Date
+	}
+	if event.End.Before(event.Date) {
+		return &paramError{name: "end_time", reason: "must not be before the start"}
+	}
+	return nil
+}
+
+// atClock возвращает момент date + clock по местным часам пояса даты.
+func atClock(date time.Time, clock time.Duration) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, date.Location())
+}
+
+// parseVersion читает ожидаемую версию события из заголовка If-Match
+// (значение ETag) или из параметра version. Версия обязательна, чтобы
+// одновременные изменения не перезаписывали друг друга.
+func parseVersion(r *http.Request, values url.Values) (int, error) {
+	if match := r.Header.Get("If-Match"); match != "" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(match, "W/"), `"`))
+		if err != nil || version <= 0 {
+			return 0, &paramError{name: "If-Match", reason: "must be an event ETag"}
+		}
+		return version, nil
+	}
+	return parseIntParam(values, "version")
+}
+
+// setETag сообщает клиенту версию события в заголовке ETag.
+func setETag(w http.ResponseWriter, event Event) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(event.Version)))
+}
+
+// parseRecurrenceParams читает необязательные параметры повторения: rrule
+// (например, FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10) и exdate — даты-исключения
+// через запятую.
+func parseRecurrenceParams(values url.Values) (*Recurrence, error) {
+	raw := values.Get("rrule")
+	if raw == "" {
+		if values.Get("exdate") != "" {
+			return nil, &paramError{name: "exdate", reason: "requires rrule"}
+		}
+		return nil, nil
+	}
+	rule, err := ParseRRule(raw)
+	if err != nil {
+		return nil, &paramError{name: "rrule", reason: err.Error()}
+	}
+	for _, s := range strings.Split(values.Get("exdate"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		date, err := time.Parse(dateLayout, s)
+		if err != nil {
+			return nil, &paramError{name: "exdate", reason: "must be comma-separated dates in YYYY-MM-DD format"}
+		}
+		rule.ExDates = append(rule.ExDates, date)
+	}
+	return rule, nil
+}
+
+// methodAllowed сообщает, подходит ли метод запроса для маршрута method.
+// HEAD обрабатывается как GET: тело ответа на него отбрасывает net/http.
+func methodAllowed(r *http.Request, method string) bool {
+	return r.Method == method || method == http.MethodGet && r.Method == http.MethodHead
+}
+
+// parseForm проверяет метод запроса и разбирает его параметры.
+// Для POST параметры берутся из тела, для GET — из query string.
+func parseForm(r *http.Request, method string) (url.Values, error) {
+	if !methodAllowed(r, method) {
+		return nil, &paramError{name: "method", reason: "must be " + method}
+	}
+	if method == http.MethodGet {
+		return r.URL.Query(), nil
+	}
+	if err := r.ParseForm(); err != nil {
+		if isBodyTooLarge(err) {
+			return nil, err
+		}
+		return nil, &paramError{name: "body", reason: err.Error()}
+	}
+	return r.PostForm, nil
+}
+
+// createEventFormHandler обрабатывает POST /create_event. Пересечения с
+// другими событиями пользователя обрабатываются согласно on_conflict.
+func createEventFormHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodPost)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		p, err := parseEventParams(r, values, false)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, p.UserID, AccessWrite); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		event, conflicts, err := store.ScheduleEvent(p.UserID, p.Event, p.Policy)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		setETag(w, event)
+		writeJSON(w, http.StatusOK, eventResponse{Result: event, Conflicts: conflicts})
+	}
+}
+
+// updateEventFormHandler обрабатывает POST /update_event. Ожидаемая версия
+// события передается параметром version или заголовком If-Match.
+func updateEventFormHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodPost)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		p, err := parseEventParams(r, values, true)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, p.UserID, AccessWrite); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		event, conflicts, err := store.ScheduleEvent(p.UserID, p.Event, p.Policy)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		setETag(w, event)
+		writeJSON(w, http.StatusOK, eventResponse{Result: event, Conflicts: conflicts})
+	}
+}
+
+// deleteEventFormHandler обрабатывает POST /delete_event. Ожидаемая версия
+// события передается параметром version или заголовком If-Match.
+func deleteEventFormHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodPost)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, userID, AccessWrite); err != nil {
+			writeError(w, err)
+			return
+		}
+		eventID, err := parseIntParam(values, "event_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		version, err := parseVersion(r, values)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if err := store.DeleteEvent(userID, eventID, version); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, "event deleted")
+	}
+}
+
+// period вычисляет полуинтервал [from, to), содержащий указанную дату.
+type period func(date time.Time) (from, to time.Time)
+
+// dayPeriod — сутки, содержащие дату.
+func dayPeriod(date time.Time) (time.Time, time.Time) {
+	from := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	return from, from.AddDate(0, 0, 1)
+}
+
+// weekPeriod — календарная неделя (с понедельника по воскресенье), содержащая дату.
+func weekPeriod(date time.Time) (time.Time, time.Time) {
+	day, _ := dayPeriod(date)
+	offset := (int(day.Weekday()) + 6) % 7
+	from := day.AddDate(0, 0, -offset)
+	return from, from.AddDate(0, 0, 7)
+}
+
+// monthPeriod — календарный месяц, содержащий дату.
+func monthPeriod(date time.Time) (time.Time, time.Time) {
+	from := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	return from, from.AddDate(0, 1, 0)
+}
+
+// eventsForPeriodHandler обрабатывает GET /events_for_day, /events_for_week и /events_for_month.
+// Границы периода вычисляются в часовом поясе вызывающего (параметр tz, по умолчанию UTC).
+func eventsForPeriodHandler(store Storage, p period) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodGet)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, userID, AccessRead); err != nil {
+			writeError(w, err)
+			return
+		}
+		loc, err := parseLocationParam(values, "tz")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		date, err := parseDateParam(values, "date", loc)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		from, to := p(date)
+		events, err := store.EventsBetween(userID, from, to)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, events)
+	}
+}
+
+// maxRangeDays ограничивает диапазон дат запросов /free_busy и /search.
+const maxRangeDays = 366
+
+// freeBusyHandler обрабатывает GET /free_busy: возвращает занятые интервалы
+// и свободные промежутки пользователя с начала дня date до конца дня end_date
+// (по умолчанию равна date) в часовом поясе tz. Необязательный min_duration
+// (например, 30m) отбрасывает более короткие свободные промежутки.
+func freeBusyHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodGet)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, userID, AccessRead); err != nil {
+			writeError(w, err)
+			return
+		}
+		loc, err := parseLocationParam(values, "tz")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		from, err := parseDateParam(values, "date", loc)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		last := from
+		if values.Get("end_date") != "" {
+			if last, err = parseDateParam(values, "end_date", loc); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		if last.Before(from) {
+			writeError(w, &paramError{name: "end_date", reason: "must not be before date"})
+			return
+		}
+		to := last.AddDate(0, 0, 1)
+		if to.After(from.AddDate(0, 0, maxRangeDays)) {
+			writeError(w, &paramError{name: "end_date", reason: fmt.Sprintf("range must not exceed %d days", maxRangeDays)})
+			return
+		}
+		var minFree time.Duration
+		if raw := values.Get("min_duration"); raw != "" {
+			if minFree, err = time.ParseDuration(raw); err != nil || minFree < 0 {
+				writeError(w, &paramError{name: "min_duration", reason: "must be a non-negative duration like 30m or 1h30m"})
+				return
+			}
+		}
+
+		events, err := store.EventsBetween(userID, from, to)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, freeBusy(events, from, to, minFree))
+	}
+}
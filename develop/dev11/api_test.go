@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postForm выполняет POST запрос с параметрами в теле через handler.
+func postForm(handler http.HandlerFunc, path string, values url.Values) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	handler(response, request)
+	return response
+}
+
+// getQuery выполняет GET запрос с параметрами в query string через handler.
+func getQuery(handler http.HandlerFunc, path string, values url.Values) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path+"?"+values.Encode(), nil)
+	response := httptest.NewRecorder()
+	handler(response, request)
+	return response
+}
+
+func TestCreateEventFormHandler(t *testing.T) {
+	store := NewEventStore()
+	handler := createEventFormHandler(store)
+
+	response := postForm(handler, "/create_event", url.Values{
+		"user_id": {"3"},
+		"name":    {"Standup"},
+		"date":    {"2019-09-09"},
+	})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, response.Code, response.Body)
+	}
+	if etag := response.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("Expected ETag \"1\", got %q", etag)
+	}
+
+	var body struct {
+		Result Event `json:"result"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Result.ID != 1 || body.Result.Version != 1 || body.Result.Name != "Standup" {
+		t.Errorf("Unexpected event in response: %+v", body.Result)
+	}
+	if !store.ContainsEvent(3, 1) {
+		t.Errorf("Event was not stored")
+	}
+}
+
+func TestCreateEventFormHandler_InvalidParams(t *testing.T) {
+	store := NewEventStore()
+	handler := createEventFormHandler(store)
+
+	tests := []url.Values{
+		{"user_id": {"abc"}, "name": {"x"}, "date": {"2019-09-09"}},
+		{"user_id": {"3"}, "name": {"x"}, "date": {"09.09.2019"}},
+		{"user_id": {"3"}, "date": {"2019-09-09"}},
+		{"name": {"x"}, "date": {"2019-09-09"}},
+		{"user_id": {"3"}, "event_id": {"1"}, "name": {"x"}, "date": {"2019-09-09"}},
+	}
+	for _, values := range tests {
+		response := postForm(handler, "/create_event", values)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status code %d, but got %d", values, http.StatusBadRequest, response.Code)
+		}
+		var body errorResponse
+		if err := json.NewDecoder(response.Body).Decode(&body); err != nil || body.Error == "" {
+			t.Errorf("%v: expected error document, got %v", values, err)
+		}
+	}
+}
+
+func TestUpdateEventFormHandler_NotFound(t *testing.T) {
+	store := NewEventStore()
+	handler := updateEventFormHandler(store)
+
+	response := postForm(handler, "/update_event", url.Values{
+		"user_id":  {"3"},
+		"event_id": {"1"},
+		"version":  {"1"},
+		"name":     {"Standup"},
+		"date":     {"2019-09-09"},
+	})
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, but got %d", http.StatusServiceUnavailable, response.Code)
+	}
+}
+
+func TestUpdateEventFormHandler_VersionConflict(t *testing.T) {
+	store := NewEventStore()
+	store.CreateEvent(3, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC)})
+	handler := updateEventFormHandler(store)
+	values := url.Values{"user_id": {"3"}, "event_id": {"1"}, "name": {"Retro"}, "date": {"2019-09-10"}}
+
+	request := httptest.NewRequest(http.MethodPost, "/update_event", strings.NewReader(values.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("If-Match", `"1"`)
+	response := httptest.NewRecorder()
+	handler(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, response.Code, response.Body)
+	}
+	if etag := response.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("Expected ETag \"2\", got %q", etag)
+	}
+
+	// Второй клиент с устаревшей версией не затирает изменение первого.
+	values.Set("version", "1")
+	values.Set("name", "Planning")
+	response = postForm(handler, "/update_event", values)
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, but got %d", http.StatusServiceUnavailable, response.Code)
+	}
+	if !strings.Contains(response.Body.String(), "version conflict") {
+		t.Errorf("Expected version conflict error, got %s", response.Body)
+	}
+	if events, _ := store.GetUserEvents(3); events[0].Name != "Retro" {
+		t.Errorf("Stale update overwrote the event: %+v", events[0])
+	}
+
+	values.Del("version")
+	response = postForm(handler, "/update_event", values)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without version, but got %d", http.StatusBadRequest, response.Code)
+	}
+}
+
+func TestDeleteEventFormHandler(t *testing.T) {
+	store := NewEventStore()
+	store.CreateEvent(3, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC)})
+	handler := deleteEventFormHandler(store)
+
+	response := postForm(handler, "/delete_event", url.Values{"user_id": {"3"}, "event_id": {"1"}, "version": {"1"}})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, response.Code)
+	}
+	if store.ContainsEvent(3, 1) {
+		t.Errorf("Event was not deleted")
+	}
+
+	response = postForm(handler, "/delete_event", url.Values{"user_id": {"3"}, "event_id": {"1"}, "version": {"1"}})
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, but got %d", http.StatusServiceUnavailable, response.Code)
+	}
+}
+
+func TestEventsForPeriodHandler(t *testing.T) {
+	store := NewEventStore()
+	for _, day := range []int{1, 8, 9, 15, 30} {
+		store.CreateEvent(3, Event{Name: "event", Date: time.Date(2019, 9, day, 0, 0, 0, 0, time.UTC)})
+	}
+	store.CreateEvent(3, Event{Name: "event", Date: time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)})
+
+	tests := []struct {
+		handler http.HandlerFunc
+		want    []int
+	}{
+		{eventsForPeriodHandler(store, dayPeriod), []int{3}},
+		{eventsForPeriodHandler(store, weekPeriod), []int{3, 4}},
+		{eventsForPeriodHandler(store, monthPeriod), []int{1, 2, 3, 4, 5}},
+	}
+	for _, test := range tests {
+		response := getQuery(test.handler, "/events_for_period", url.Values{"user_id": {"3"}, "date": {"2019-09-09"}})
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, response.Code)
+		}
+		var body struct {
+			Result []Event `json:"result"`
+		}
+		if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(body.Result) != len(test.want) {
+			t.Fatalf("Expected %d events, but got %d", len(test.want), len(body.Result))
+		}
+		for i, event := range body.Result {
+			if event.ID != test.want[i] {
+				t.Errorf("Expected event %d at position %d, but got %d", test.want[i], i, event.ID)
+			}
+		}
+	}
+}
+
+func TestEventsForPeriodHandler_WrongMethod(t *testing.T) {
+	handler := eventsForPeriodHandler(NewEventStore(), dayPeriod)
+
+	response := postForm(handler, "/events_for_day", url.Values{"user_id": {"3"}, "date": {"2019-09-09"}})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, response.Code)
+	}
+}
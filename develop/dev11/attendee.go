@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// maxAttendees ограничивает число приглашенных на одно событие.
+const maxAttendees = 100
+
+// Статусы приглашения.
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusDeclined = "declined"
+)
+
+// ErrNotInvited возвращается, если пользователь не приглашен на событие.
+var ErrNotInvited = &BusinessError{msg: "user is not invited to the event"}
+
+// Attendee — приглашенный на событие пользователь и его ответ.
+type Attendee struct {
+	UserID int    `json:"user_id"`
+	Status string `json:"status"`
+}
+
+// eventRef ссылается на событие в календаре организатора.
+type eventRef struct {
+	ownerID int
+	eventID int
+}
+
+// mergeAttendees проверяет список приглашенных и проставляет им статусы:
+// ответ сохраняется у тех, кто был приглашен в current, остальные получают
+// StatusPending. Статусы из запроса игнорируются — их меняет только /rsvp.
+func mergeAttendees(ownerID int, attendees, current []Attendee) ([]Attendee, error) {
+	if len(attendees) == 0 {
+		return nil, nil
+	}
+	if len(attendees) > maxAttendees {
+		return nil, &BusinessError{msg: fmt.Sprintf("event may have at most %d attendees", maxAttendees)}
+	}
+	previous := make(map[int]string, len(current))
+	for _, attendee := range current {
+		previous[attendee.UserID] = attendee.Status
+	}
+
+	merged := make([]Attendee, 0, len(attendees))
+	seen := make(map[int]bool, len(attendees))
+	for _, attendee := range attendees {
+		switch {
+		case attendee.UserID <= 0:
+			return nil, &BusinessError{msg: fmt.Sprintf("invalid attendee ID %d", attendee.UserID)}
+		case attendee.UserID == ownerID:
+			return nil, &BusinessError{msg: "organizer cannot be invited to their own event"}
+		case seen[attendee.UserID]:
+			continue
+		}
+		seen[attendee.UserID] = true
+		status, ok := previous[attendee.UserID]
+		if !ok {
+			status = StatusPending
+		}
+		merged = append(merged, Attendee{UserID: attendee.UserID, Status: status})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].UserID < merged[j].UserID })
+	return merged, nil
+}
+
+// attendeeStatus возвращает статус приглашения пользователя на событие.
+func (e *Event) attendeeStatus(userID int) (string, bool) {
+	for _, attendee := range e.Attendees {
+		if attendee.UserID == userID {
+			return attendee.Status, true
+		}
+	}
+	return "", false
+}
+
+// rsvpHandler обрабатывает POST /rsvp: приглашенный user_id отвечает на
+// приглашение на событие event_id организатора organizer_id. status —
+// accepted или declined.
+func rsvpHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodPost)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		organizerID, err := parseIntParam(values, "organizer_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		eventID, err := parseIntParam(values, "event_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		status := values.Get("status")
+		if status != StatusAccepted && status != StatusDeclined {
+			writeError(w, &paramError{name: "status", reason: "must be accepted or declined"})
+			return
+		}
+		if err := authorizeOwner(r, userID); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		event, err := store.RespondToInvitation(organizerID, eventID, userID, status)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		setETag(w, event)
+		writeResult(w, event)
+	}
+}
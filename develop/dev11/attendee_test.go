@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStore_Attendees(t *testing.T) {
+	store := NewEventStore()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	event, err := store.CreateEvent(1, Event{
+		Name:      "Planning",
+		Date:      date,
+		End:       date.Add(time.Hour),
+		Attendees: []Attendee{{UserID: 3, Status: StatusAccepted}, {UserID: 2}, {UserID: 3}},
+	})
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	want := []Attendee{{2, StatusPending}, {3, StatusPending}}
+	if len(event.Attendees) != 2 || event.Attendees[0] != want[0] || event.Attendees[1] != want[1] || event.Organizer != 1 {
+		t.Fatalf("Expected pending attendees %v, got %+v", want, event)
+	}
+	if _, err := store.CreateEvent(1, Event{Date: date, Attendees: []Attendee{{UserID: 1}}}); err == nil {
+		t.Error("Expected error when inviting the organizer")
+	}
+
+	// Приглашенный видит событие в своих списках.
+	if events, _ := store.GetUserEvents(2); len(events) != 1 || events[0].ID != event.ID {
+		t.Errorf("Invited event is missing from GetUserEvents: %+v", events)
+	}
+	if events, _ := store.EventsBetween(3, date, date.Add(time.Hour)); len(events) != 1 {
+		t.Errorf("Invited event is missing from EventsBetween: %+v", events)
+	}
+	if !store.HasUser(2) {
+		t.Error("Attendee was not registered")
+	}
+
+	if _, err := store.RespondToInvitation(1, event.ID, 4, StatusAccepted); !errors.Is(err, ErrNotInvited) {
+		t.Errorf("Expected ErrNotInvited, got %v", err)
+	}
+	event, err = store.RespondToInvitation(1, event.ID, 3, StatusDeclined)
+	if err != nil || event.Version != 2 {
+		t.Fatalf("RespondToInvitation: %+v, %v", event, err)
+	}
+	if events, _ := store.GetUserEvents(3); len(events) != 0 {
+		t.Errorf("Declined event is still listed: %+v", events)
+	}
+	store.RespondToInvitation(1, event.ID, 2, StatusAccepted)
+
+	// Изменение сохраняет ответы оставшихся приглашенных.
+	event, err = store.UpdateEvent(1, Event{ID: event.ID, Name: "Planning", Date: date, Attendees: []Attendee{{UserID: 2}, {UserID: 5}}})
+	if err != nil {
+		t.Fatalf("UpdateEvent: %v", err)
+	}
+	if status, _ := event.attendeeStatus(2); status != StatusAccepted {
+		t.Errorf("Attendee 2 lost the answer: %+v", event.Attendees)
+	}
+	if _, ok := event.attendeeStatus(3); ok {
+		t.Errorf("Removed attendee is still invited: %+v", event.Attendees)
+	}
+	if events, _ := store.GetUserEvents(5); len(events) != 1 {
+		t.Errorf("New attendee does not see the event: %+v", events)
+	}
+
+	store.DeleteEvent(1, event.ID, 0)
+	if events, _ := store.GetUserEvents(2); len(events) != 0 {
+		t.Errorf("Deleted event is still listed for attendee: %+v", events)
+	}
+}
+
+func TestFileStore_AttendeesReplay(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	event, _ := store.CreateEvent(1, Event{Name: "Planning", Date: date, Attendees: []Attendee{{UserID: 2}}})
+	store.RespondToInvitation(1, event.ID, 2, StatusAccepted)
+	store.Close()
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+	events, _ := reopened.GetUserEvents(2)
+	if len(events) != 1 || events[0].Attendees[0].Status != StatusAccepted || events[0].Organizer != 1 {
+		t.Errorf("Invitation was not restored: %+v", events)
+	}
+}
+
+func TestRSVPHandler(t *testing.T) {
+	auth := NewAuthenticator(testSecret, time.Hour)
+	store := NewEventStore()
+	create := createEventFormHandler(store)
+	rsvp := rsvpHandler(store)
+
+	response := authedRequest(create, auth, 1, http.MethodPost, "/create_event", url.Values{
+		"user_id": {"1"}, "name": {"Planning"}, "date": {"2019-09-09"}, "attendees": {"2,3"},
+	})
+	if response.Code != http.StatusOK {
+		t.Fatalf("create_event: %d %s", response.Code, response.Body)
+	}
+
+	values := url.Values{"user_id": {"2"}, "organizer_id": {"1"}, "event_id": {"1"}, "status": {"accepted"}}
+	if response := authedRequest(rsvp, auth, 3, http.MethodPost, "/rsvp", values); response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d when answering for another user, but got %d", http.StatusForbidden, response.Code)
+	}
+	if response := authedRequest(rsvp, auth, 2, http.MethodPost, "/rsvp", values); response.Code != http.StatusOK {
+		t.Errorf("rsvp: %d %s", response.Code, response.Body)
+	}
+	values.Set("user_id", "4")
+	if response := authedRequest(rsvp, auth, 4, http.MethodPost, "/rsvp", values); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d for uninvited user, but got %d", http.StatusServiceUnavailable, response.Code)
+	}
+	values.Set("status", "maybe")
+	if response := authedRequest(rsvp, auth, 4, http.MethodPost, "/rsvp", values); response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for unknown status, but got %d", http.StatusBadRequest, response.Code)
+	}
+
+	// Приглашенный видит событие в своем календаре без доступа к календарю организатора.
+	response = authedRequest(eventsForPeriodHandler(store, dayPeriod), auth, 2, http.MethodGet, "/events_for_day", url.Values{"user_id": {"2"}, "date": {"2019-09-09"}})
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"organizer":1`) {
+		t.Errorf("Unexpected events_for_day response: %d %s", response.Code, response.Body)
+	}
+}
+
+func TestImportEvents_SkipsInvitedEvents(t *testing.T) {
+	store := NewEventStore()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	invited, _ := store.CreateEvent(1, Event{Name: "Planning", Date: date, Attendees: []Attendee{{UserID: 2}}})
+
+	imported := []Event{{UID: exportUID(invited), Name: "Hijacked", Date: date, End: date}}
+	if _, err := ImportEvents(store, 2, imported); err != nil {
+		t.Fatalf("ImportEvents: %v", err)
+	}
+	events, _ := store.GetUserEvents(1)
+	if len(events) != 1 || events[0].Name != "Planning" {
+		t.Errorf("Import changed the organizer's event: %+v", events)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// minSecretLength — минимальная длина секрета для подписи токенов.
+const minSecretLength = 32
+
+// Access — уровень доступа к календарю другого пользователя.
+type Access string
+
+// Уровни доступа к календарю.
+const (
+	AccessNone  Access = ""
+	AccessRead  Access = "read"
+	AccessWrite Access = "write"
+)
+
+// allows сообщает, достаточно ли уровня доступа a для операции с уровнем need.
+func (a Access) allows(need Access) bool {
+	return a == AccessWrite || (a == AccessRead && need == AccessRead)
+}
+
+// authError — ошибка аутентификации (401) или авторизации (403).
+type authError struct {
+	status int
+	msg    string
+}
+
+func (e *authError) Error() string {
+	return e.msg
+}
+
+// Ошибки проверки токена.
+var (
+	errTokenMissing   = &authError{status: http.StatusUnauthorized, msg: "missing bearer token"}
+	errTokenMalformed = &authError{status: http.StatusUnauthorized, msg: "malformed bearer token"}
+	errTokenSignature = &authError{status: http.StatusUnauthorized, msg: "invalid token signature"}
+	errTokenExpired   = &authError{status: http.StatusUnauthorized, msg: "token expired"}
+)
+
+// tokenClaims — содержимое токена.
+type tokenClaims struct {
+	UserID  int   `json:"sub"`
+	Expires int64 `json:"exp"`
+}
+
+// Authenticator выпускает и проверяет bearer токены вида
+// base64url(claims).base64url(HMAC-SHA256(secret, claims)).
+type Authenticator struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewAuthenticator создает Authenticator с секретом для подписи токенов
+// и сроком их действия.
+func NewAuthenticator(secret string, ttl time.Duration) *Authenticator {
+	return &Authenticator{secret: []byte(secret), ttl: ttl, now: time.Now}
+}
+
+// IssueToken выпускает токен пользователя userID.
+func (a *Authenticator) IssueToken(userID int) string {
+	claims, _ := json.Marshal(tokenClaims{UserID: userID, Expires: a.now().Add(a.ttl).Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(a.sign(payload))
+}
+
+// Verify проверяет подпись и срок действия токена и возвращает ID пользователя.
+func (a *Authenticator) Verify(token string) (int, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, errTokenMalformed
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return 0, errTokenMalformed
+	}
+	if !hmac.Equal(mac, a.sign(payload)) {
+		return 0, errTokenSignature
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, errTokenMalformed
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.UserID <= 0 {
+		return 0, errTokenMalformed
+	}
+	if !a.now().Before(time.Unix(claims.Expires, 0)) {
+		return 0, errTokenExpired
+	}
+	return claims.UserID, nil
+}
+
+// sign вычисляет подпись содержимого токена.
+func (a *Authenticator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// authUserKey — ключ ID аутентифицированного пользователя в контексте.
+type authUserKey struct{}
+
+// authUserFromContext возвращает ID аутентифицированного пользователя.
+// ok равно false, если аутентификация отключена.
+func authUserFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(authUserKey{}).(int)
+	return userID, ok
+}
+
+// authMiddleware требует заголовок Authorization: Bearer <token> и кладет
+// ID пользователя из токена в контекст запроса. Запросы к путям public
+// (проверки состояния, метрики) пропускаются без токена.
+func authMiddleware(auth *Authenticator, public ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, path := range public {
+				if r.URL.Path == path {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				writeAuthError(w, errTokenMissing)
+				return
+			}
+			userID, err := auth.Verify(strings.TrimSpace(token))
+			if err != nil {
+				writeAuthError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey{}, userID)))
+		})
+	}
+}
+
+// writeAuthError отвечает на запрос без действительного токена.
+func writeAuthError(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="calendar"`)
+	writeError(w, err)
+}
+
+// authorize проверяет, что аутентифицированный пользователь может работать
+// с календарем пользователя userID с уровнем доступа need: владельцу доступно
+// все, остальным — то, что владелец открыл через /share_calendar.
+func authorize(r *http.Request, store Storage, userID int, need Access) error {
+	caller, ok := authUserFromContext(r.Context())
+	if !ok || caller == userID {
+		return nil
+	}
+	if store.CalendarAccess(userID, caller).allows(need) {
+		return nil
+	}
+	return &authError{status: http.StatusForbidden, msg: fmt.Sprintf("no %s access to the calendar of user %d", need, userID)}
+}
+
+// authorizeOwner проверяет, что запрос сделан самим пользователем userID.
+func authorizeOwner(r *http.Request, userID int) error {
+	if caller, ok := authUserFromContext(r.Context()); ok && caller != userID {
+		return &authError{status: http.StatusForbidden, msg: "only the calendar owner may do this"}
+	}
+	return nil
+}
+
+// shareCalendarHandler обрабатывает POST /share_calendar: владелец user_id
+// открывает свой календарь пользователю grantee_id с уровнем доступа access
+// (read или write) или отзывает доступ (access=none).
+func shareCalendarHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodPost)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		ownerID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		granteeID, err := parseIntParam(values, "grantee_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		access := Access(values.Get("access"))
+		switch access {
+		case AccessRead, AccessWrite:
+		case "none":
+			access = AccessNone
+		default:
+			writeError(w, &paramError{name: "access", reason: "must be read, write or none"})
+			return
+		}
+		if err := authorizeOwner(r, ownerID); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if err := store.ShareCalendar(ownerID, granteeID, access); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, store.CalendarShares(ownerID))
+	}
+}
+
+// calendarSharesHandler обрабатывает GET /calendar_shares: возвращает
+// пользователей, которым открыт календарь user_id.
+func calendarSharesHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodGet)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		ownerID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorizeOwner(r, ownerID); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, store.CalendarShares(ownerID))
+	}
+}
+
+// runTokenCommand выпускает токен для пользователя: calendar token -user 3
+// [-ttl 24h] [-- флаги конфигурации]. Секрет берется из конфигурации сервера.
+func runTokenCommand(args []string, getenv func(string) string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("calendar token", flag.ContinueOnError)
+	userID := fs.Int("user", 0, "ID пользователя, для которого выпускается токен")
+	ttl := fs.Duration("ttl", 0, "срок действия токена, по умолчанию auth.token_ttl")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *userID <= 0 {
+		return errors.New("-user must be a positive user ID")
+	}
+	cfg, err := loadConfig(fs.Args(), getenv)
+	if err != nil {
+		return err
+	}
+	if cfg.Auth.Secret == "" {
+		return errors.New("auth.secret is not configured")
+	}
+	if *ttl <= 0 {
+		*ttl = time.Duration(cfg.Auth.TokenTTL)
+	}
+	_, err = fmt.Fprintln(stdout, NewAuthenticator(cfg.Auth.Secret, *ttl).IssueToken(*userID))
+	return err
+}
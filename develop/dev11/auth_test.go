@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestAuthenticator_Tokens(t *testing.T) {
+	auth := NewAuthenticator(testSecret, time.Hour)
+	now := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	auth.now = func() time.Time { return now }
+
+	token := auth.IssueToken(3)
+	if userID, err := auth.Verify(token); err != nil || userID != 3 {
+		t.Fatalf("Verify: expected user 3, got %d, %v", userID, err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := NewAuthenticator(testSecret, time.Hour)
+	forged.now = auth.now
+	otherPayload, _, _ := strings.Cut(forged.IssueToken(4), ".")
+	other := NewAuthenticator(strings.Repeat("x", 32), time.Hour)
+	other.now = auth.now
+
+	tests := []struct {
+		token string
+		want  error
+	}{
+		{"", errTokenMalformed},
+		{payload, errTokenMalformed},
+		{otherPayload + "." + signature, errTokenSignature},
+		{other.IssueToken(3), errTokenSignature},
+		{payload + ".!!!", errTokenMalformed},
+	}
+	for _, test := range tests {
+		if _, err := auth.Verify(test.token); err != test.want {
+			t.Errorf("Verify(%q): expected %v, got %v", test.token, test.want, err)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := auth.Verify(token); err != errTokenExpired {
+		t.Errorf("Expected expired token, got %v", err)
+	}
+}
+
+// authedRequest выполняет запрос к обработчику за authMiddleware от имени пользователя.
+func authedRequest(handler http.Handler, auth *Authenticator, userID int, method, path string, values url.Values) *httptest.ResponseRecorder {
+	var request *http.Request
+	if method == http.MethodGet {
+		request = httptest.NewRequest(method, path+"?"+values.Encode(), nil)
+	} else {
+		request = httptest.NewRequest(method, path, strings.NewReader(values.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if userID != 0 {
+		request.Header.Set("Authorization", "Bearer "+auth.IssueToken(userID))
+	}
+	response := httptest.NewRecorder()
+	chain(handler, authMiddleware(auth)).ServeHTTP(response, request)
+	return response
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	auth := NewAuthenticator(testSecret, time.Hour)
+	store := NewEventStore()
+	handler := eventsForPeriodHandler(store, dayPeriod)
+	values := url.Values{"user_id": {"1"}, "date": {"2019-09-09"}}
+
+	response := authedRequest(handler, auth, 0, http.MethodGet, "/events_for_day", values)
+	if response.Code != http.StatusUnauthorized || response.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with WWW-Authenticate, got %d %v", response.Code, response.Header())
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/events_for_day?"+values.Encode(), nil)
+	request.Header.Set("Authorization", "Bearer garbage")
+	response = httptest.NewRecorder()
+	chain(handler, authMiddleware(auth)).ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for invalid token, but got %d", http.StatusUnauthorized, response.Code)
+	}
+
+	if response := authedRequest(handler, auth, 1, http.MethodGet, "/events_for_day", values); response.Code != http.StatusOK {
+		t.Errorf("Expected owner access, got %d: %s", response.Code, response.Body)
+	}
+	if response := authedRequest(handler, auth, 2, http.MethodGet, "/events_for_day", values); response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d for another user, but got %d", http.StatusForbidden, response.Code)
+	}
+}
+
+func TestCalendarSharing(t *testing.T) {
+	auth := NewAuthenticator(testSecret, time.Hour)
+	store := NewEventStore()
+	store.CreateEvent(1, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)})
+	read := getUserEventsHandler(store)
+	update := updateEventFormHandler(store)
+	share := shareCalendarHandler(store)
+	readValues := url.Values{"userId": {"1"}}
+	updateValues := url.Values{"user_id": {"1"}, "event_id": {"1"}, "version": {"1"}, "name": {"Retro"}, "date": {"2019-09-09"}}
+
+	response := authedRequest(read, auth, 2, http.MethodGet, "/events/get", readValues)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d before sharing, but got %d", http.StatusForbidden, response.Code)
+	}
+	if body := strings.TrimSpace(response.Body.String()); body != `{"error":"no read access to the calendar of user 1"}` {
+		t.Errorf("Legacy handler should return a JSON error, got %s", body)
+	}
+
+	// Открыть календарь может только его владелец.
+	shareValues := url.Values{"user_id": {"1"}, "grantee_id": {"2"}, "access": {"read"}}
+	if response := authedRequest(share, auth, 2, http.MethodPost, "/share_calendar", shareValues); response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d for non-owner, but got %d", http.StatusForbidden, response.Code)
+	}
+	if response := authedRequest(share, auth, 1, http.MethodPost, "/share_calendar", shareValues); response.Code != http.StatusOK {
+		t.Fatalf("share_calendar: %d %s", response.Code, response.Body)
+	}
+
+	if response := authedRequest(read, auth, 2, http.MethodGet, "/events/get", readValues); response.Code != http.StatusOK {
+		t.Errorf("Expected read access after sharing, got %d", response.Code)
+	}
+	if response := authedRequest(update, auth, 2, http.MethodPost, "/update_event", updateValues); response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d for write with read access, but got %d", http.StatusForbidden, response.Code)
+	}
+
+	shareValues.Set("access", "write")
+	authedRequest(share, auth, 1, http.MethodPost, "/share_calendar", shareValues)
+	if response := authedRequest(update, auth, 2, http.MethodPost, "/update_event", updateValues); response.Code != http.StatusOK {
+		t.Errorf("Expected write access after sharing, got %d: %s", response.Code, response.Body)
+	}
+	if response := authedRequest(read, auth, 3, http.MethodGet, "/events/get", readValues); response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d for user without share, but got %d", http.StatusForbidden, response.Code)
+	}
+
+	shareValues.Set("access", "none")
+	response = authedRequest(share, auth, 1, http.MethodPost, "/share_calendar", shareValues)
+	if response.Code != http.StatusOK || strings.TrimSpace(response.Body.String()) != `{"result":[]}` {
+		t.Errorf("Unexpected response to revoke: %d %s", response.Code, response.Body)
+	}
+	if response := authedRequest(read, auth, 2, http.MethodGet, "/events/get", readValues); response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d after revoke, but got %d", http.StatusForbidden, response.Code)
+	}
+}
+
+func TestEventStore_ShareCalendar(t *testing.T) {
+	store := NewEventStore()
+	if err := store.ShareCalendar(1, 1, AccessRead); err == nil {
+		t.Error("Expected error when sharing with the owner")
+	}
+	if err := store.ShareCalendar(1, 2, Access("admin")); err == nil {
+		t.Error("Expected error for unknown access level")
+	}
+	store.ShareCalendar(1, 3, AccessWrite)
+	store.ShareCalendar(1, 2, AccessRead)
+	if shares := store.CalendarShares(1); len(shares) != 2 || shares[0] != (Share{2, AccessRead}) || shares[1] != (Share{3, AccessWrite}) {
+		t.Errorf("Unexpected shares: %+v", shares)
+	}
+	if store.CalendarAccess(2, 1) != AccessNone || store.CalendarAccess(1, 1) != AccessWrite {
+		t.Error("Unexpected access for owner or reverse direction")
+	}
+}
+
+func TestRunTokenCommand(t *testing.T) {
+	var out bytes.Buffer
+	env := envMap(map[string]string{"CALENDAR_AUTH_SECRET": testSecret})
+	if err := runTokenCommand([]string{"-user", "5", "-ttl", "1h"}, env, &out); err != nil {
+		t.Fatalf("runTokenCommand: %v", err)
+	}
+	if userID, err := NewAuthenticator(testSecret, time.Hour).Verify(strings.TrimSpace(out.String())); err != nil || userID != 5 {
+		t.Errorf("Issued token is invalid: %d, %v", userID, err)
+	}
+
+	if err := runTokenCommand([]string{"-user", "5"}, envMap(nil), &out); err == nil {
+		t.Error("Expected error without configured secret")
+	}
+	if err := runTokenCommand(nil, env, &out); err == nil {
+		t.Error("Expected error without -user")
+	}
+}
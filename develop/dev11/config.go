@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultConfigPath — файл конфигурации, который читается, если путь не задан явно.
+const defaultConfigPath = "config.json"
+
+// Типы хранилища событий.
+const (
+	storageMemory = "memory"
+	storageFile   = "file"
+)
+
+// Форматы логов.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Duration — time.Duration, который в JSON записывается строкой вида "5s".
+type Duration time.Duration
+
+// MarshalJSON кодирует длительность строкой.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON разбирает длительность из строки вида "5s" или из числа наносекунд.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("duration must be a string like \"5s\"")
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config описывает настройки сервера календаря.
+type Config struct {
+	Addr         string   `json:"addr"`
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+	IdleTimeout  Duration `json:"idle_timeout"`
+	// ShutdownTimeout ограничивает ожидание обрабатываемых запросов при
+	// остановке; ShutdownDelay — пауза между переходом /readyz в 503 и
+	// закрытием listener, чтобы балансировщик успел исключить сервер.
+	ShutdownTimeout Duration       `json:"shutdown_timeout"`
+	ShutdownDelay   Duration       `json:"shutdown_delay"`
+	Storage         StorageConfig  `json:"storage"`
+	Log             LogConfig      `json:"log"`
+	Reminders       ReminderConfig `json:"reminders"`
+	Auth            AuthConfig     `json:"auth"`
+	Limits          LimitsConfig   `json:"limits"`
+}
+
+// AuthConfig описывает аутентификацию по bearer токенам. Без секрета сервер
+// не запускается, пока аутентификация не отключена явно через Disabled.
+// Поставляемый config.json отключает ее для локальной разработки; в рабочем
+// окружении секрет задается переменной CALENDAR_AUTH_SECRET, которая
+// включает аутентификацию поверх файла.
+type AuthConfig struct {
+	// Secret — ключ HMAC для подписи токенов, не короче 32 байт.
+	Secret string `json:"secret"`
+	// Disabled отключает аутентификацию: любой клиент работает с любым
+	// календарем. Несовместимо с непустым Secret.
+	Disabled bool     `json:"disabled"`
+	TokenTTL Duration `json:"token_ttl"`
+}
+
+// StorageConfig описывает хранилище событий.
+type StorageConfig struct {
+	Backend       string `json:"backend"`
+	Path          string `json:"path"`
+	SnapshotEvery int    `json:"snapshot_every"`
+}
+
+// LogConfig описывает формат и уровень логов.
+type LogConfig struct {
+	Format string `json:"format"`
+	Level  string `json:"level"`
+}
+
+// ReminderConfig описывает доставку напоминаний о событиях.
+type ReminderConfig struct {
+	// Notifier — способ доставки: none, log, webhook или email.
+	Notifier     string   `json:"notifier"`
+	PollInterval Duration `json:"poll_interval"`
+	MaxAttempts  int      `json:"max_attempts"`
+	RetryBackoff Duration `json:"retry_backoff"`
+	WebhookURL   string   `json:"webhook_url"`
+	SMTPAddr     string   `json:"smtp_addr"`
+	MailFrom     string   `json:"mail_from"`
+	// MailTo — шаблон адреса получателя, %d заменяется ID пользователя.
+	MailTo string `json:"mail_to"`
+}
+
+// defaultConfig возвращает конфигурацию по умолчанию.
+func defaultConfig() Config {
+	return Config{
+		Addr:            ":8080",
+		ReadTimeout:     Duration(5 * time.Second),
+		WriteTimeout:    Duration(10 * time.Second),
+		IdleTimeout:     Duration(60 * time.Second),
+		ShutdownTimeout: Duration(10 * time.Second),
+		Storage: StorageConfig{
+			Backend:       storageMemory,
+			SnapshotEvery: defaultSnapshotEvery,
+		},
+		Log: LogConfig{
+			Format: logFormatText,
+			Level:  "info",
+		},
+		Reminders: ReminderConfig{
+			Notifier:     notifierLog,
+			PollInterval: Duration(15 * time.Second),
+			MaxAttempts:  5,
+			RetryBackoff: Duration(30 * time.Second),
+			MailFrom:     "calendar@localhost",
+			MailTo:       "user%d@localhost",
+		},
+		Auth: AuthConfig{
+			TokenTTL: Duration(24 * time.Hour),
+		},
+		Limits: LimitsConfig{
+			RouteLimits: RouteLimits{RPS: 20, Burst: 40, MaxBodyBytes: 1 << 20},
+			Routes: map[string]RouteLimits{
+				"/import_ics": {RPS: 1, Burst: 5, MaxBodyBytes: 10 << 20},
+			},
+		},
+	}
+}
+
+// loadConfig собирает конфигурацию из значений по умолчанию, файла, переменных
+// окружения и флагов командной строки — каждый следующий источник переопределяет
+// предыдущий. Путь к файлу задается флагом -config или переменной CALENDAR_CONFIG.
+func loadConfig(args []string, getenv func(string) string) (Config, error) {
+	cfg := defaultConfig()
+
+	fs := flag.NewFlagSet("calendar", flag.ContinueOnError)
+	configPath := fs.String("config", "", "путь к файлу конфигурации (JSON)")
+	addr := fs.String("addr", "", "адрес, на котором слушает сервер, например :8080")
+	readTimeout := fs.Duration("read-timeout", 0, "таймаут чтения запроса")
+	writeTimeout := fs.Duration("write-timeout", 0, "таймаут записи ответа")
+	idleTimeout := fs.Duration("idle-timeout", 0, "таймаут простоя keep-alive соединения")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 0, "максимальное ожидание обрабатываемых запросов при остановке")
+	shutdownDelay := fs.Duration("shutdown-delay", 0, "пауза перед закрытием listener при остановке")
+	backend := fs.String("storage", "", "хранилище событий: memory или file")
+	storagePath := fs.String("storage-path", "", "каталог файлового хранилища")
+	snapshotEvery := fs.Int("snapshot-every", 0, "число записей журнала между снимками")
+	logFormat := fs.String("log-format", "", "формат логов: text или json")
+	logLevel := fs.String("log-level", "", "уровень логов: debug, info, warn или error")
+	notifier := fs.String("notifier", "", "доставка напоминаний: none, log, webhook или email")
+	webhookURL := fs.String("webhook-url", "", "URL для POST запросов с напоминаниями")
+	smtpAddr := fs.String("smtp-addr", "", "адрес SMTP сервера для писем с напоминаниями")
+	if err := fs.Parse(args); err != nil {
+		return cfg, fmt.Errorf("parse flags: %w", err)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	path, explicit := *configPath, set["config"]
+	if !explicit {
+		if path = getenv("CALENDAR_CONFIG"); path != "" {
+			explicit = true
+		} else {
+			path = defaultConfigPath
+		}
+	}
+	if err := cfg.loadFile(path); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return cfg, err
+		}
+	}
+
+	if err := cfg.loadEnv(getenv); err != nil {
+		return cfg, err
+	}
+
+	if set["addr"] {
+		cfg.Addr = *addr
+	}
+	if set["read-timeout"] {
+		cfg.ReadTimeout = Duration(*readTimeout)
+	}
+	if set["write-timeout"] {
+		cfg.WriteTimeout = Duration(*writeTimeout)
+	}
+	if set["idle-timeout"] {
+		cfg.IdleTimeout = Duration(*idleTimeout)
+	}
+	if set["shutdown-timeout"] {
+		cfg.ShutdownTimeout = Duration(*shutdownTimeout)
+	}
+	if set["shutdown-delay"] {
+		cfg.ShutdownDelay = Duration(*shutdownDelay)
+	}
+	if set["storage"] {
+		cfg.Storage.Backend = *backend
+	}
+	if set["storage-path"] {
+		cfg.Storage.Path = *storagePath
+	}
+	if set["snapshot-every"] {
+		cfg.Storage.SnapshotEvery = *snapshotEvery
+	}
+	if set["log-format"] {
+		cfg.Log.Format = *logFormat
+	}
+	if set["log-level"] {
+		cfg.Log.Level = *logLevel
+	}
+	if set["notifier"] {
+		cfg.Reminders.Notifier = *notifier
+	}
+	if set["webhook-url"] {
+		cfg.Reminders.WebhookURL = *webhookURL
+	}
+	if set["smtp-addr"] {
+		cfg.Reminders.SMTPAddr = *smtpAddr
+	}
+
+	return cfg, cfg.validate()
+}
+
+// loadFile читает JSON файл конфигурации поверх текущих значений.
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv переопределяет значения переменными окружения CALENDAR_*.
+func (cfg *Config) loadEnv(getenv func(string) string) error {
+	stringVars := map[string]*string{
+		"CALENDAR_ADDR":         &cfg.Addr,
+		"CALENDAR_STORAGE":      &cfg.Storage.Backend,
+		"CALENDAR_STORAGE_PATH": &cfg.Storage.Path,
+		"CALENDAR_LOG_FORMAT":   &cfg.Log.Format,
+		"CALENDAR_LOG_LEVEL":    &cfg.Log.Level,
+		"CALENDAR_NOTIFIER":     &cfg.Reminders.Notifier,
+		"CALENDAR_WEBHOOK_URL":  &cfg.Reminders.WebhookURL,
+		"CALENDAR_SMTP_ADDR":    &cfg.Reminders.SMTPAddr,
+		"CALENDAR_AUTH_SECRET":  &cfg.Auth.Secret,
+	}
+	for name, dst := range stringVars {
+		if v := getenv(name); v != "" {
+			*dst = v
+		}
+	}
+
+	durations := map[string]*Duration{
+		"CALENDAR_READ_TIMEOUT":     &cfg.ReadTimeout,
+		"CALENDAR_WRITE_TIMEOUT":    &cfg.WriteTimeout,
+		"CALENDAR_IDLE_TIMEOUT":     &cfg.IdleTimeout,
+		"CALENDAR_SHUTDOWN_TIMEOUT": &cfg.ShutdownTimeout,
+		"CALENDAR_SHUTDOWN_DELAY":   &cfg.ShutdownDelay,
+	}
+	for name, dst := range durations {
+		if v := getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = Duration(d)
+		}
+	}
+
+	// Секрет из окружения включает аутентификацию, отключенную в файле;
+	// CALENDAR_AUTH_DISABLED, если задана, все равно имеет приоритет.
+	if getenv("CALENDAR_AUTH_SECRET") != "" {
+		cfg.Auth.Disabled = false
+	}
+	if v := getenv("CALENDAR_AUTH_DISABLED"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("CALENDAR_AUTH_DISABLED: %w", err)
+		}
+		cfg.Auth.Disabled = disabled
+	}
+
+	if v := getenv("CALENDAR_SNAPSHOT_EVERY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("CALENDAR_SNAPSHOT_EVERY: %w", err)
+		}
+		cfg.Storage.SnapshotEvery = n
+	}
+	return nil
+}
+
+// validate проверяет согласованность конфигурации.
+func (cfg *Config) validate() error {
+	var errs []error
+	if _, port, err := net.SplitHostPort(cfg.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("addr %q: %w", cfg.Addr, err))
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		errs = append(errs, fmt.Errorf("addr %q: invalid port", cfg.Addr))
+	}
+	timeouts := []struct {
+		name  string
+		value Duration
+	}{
+		{"read_timeout", cfg.ReadTimeout},
+		{"write_timeout", cfg.WriteTimeout},
+		{"idle_timeout", cfg.IdleTimeout},
+		{"shutdown_timeout", cfg.ShutdownTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", timeout.name))
+		}
+	}
+	if cfg.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("shutdown_delay must not be negative"))
+	}
+
+	switch cfg.Storage.Backend {
+	case storageMemory:
+	case storageFile:
+		if cfg.Storage.Path == "" {
+			errs = append(errs, errors.New("storage.path is required for file storage"))
+		}
+		if cfg.Storage.SnapshotEvery <= 0 {
+			errs = append(errs, errors.New("storage.snapshot_every must be positive"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend %q: must be %q or %q", cfg.Storage.Backend, storageMemory, storageFile))
+	}
+
+	switch cfg.Log.Format {
+	case logFormatText, logFormatJSON:
+	default:
+		errs = append(errs, fmt.Errorf("log.format %q: must be %q or %q", cfg.Log.Format, logFormatText, logFormatJSON))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level %q: must be debug, info, warn or error", cfg.Log.Level))
+	}
+
+	errs = append(errs, cfg.Reminders.validate()...)
+	errs = append(errs, cfg.Limits.validate()...)
+	switch {
+	case cfg.Auth.Disabled && cfg.Auth.Secret != "":
+		errs = append(errs, errors.New("auth.secret must be empty when auth.disabled is true"))
+	case !cfg.Auth.Disabled && cfg.Auth.Secret == "":
+		errs = append(errs, errors.New("auth.secret is required unless auth.disabled is true"))
+	case cfg.Auth.Secret != "" && len(cfg.Auth.Secret) < minSecretLength:
+		errs = append(errs, fmt.Errorf("auth.secret must be at least %d bytes long", minSecretLength))
+	}
+	if cfg.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.token_ttl must be positive"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validate проверяет настройки напоминаний.
+func (cfg *ReminderConfig) validate() []error {
+	var errs []error
+	switch cfg.Notifier {
+	case notifierNone:
+		return nil
+	case notifierLog:
+	case notifierWebhook:
+		if u, err := url.Parse(cfg.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("reminders.webhook_url %q: must be an http or https URL", cfg.WebhookURL))
+		}
+	case notifierEmail:
+		if _, _, err := net.SplitHostPort(cfg.SMTPAddr); err != nil {
+			errs = append(errs, fmt.Errorf("reminders.smtp_addr %q: %w", cfg.SMTPAddr, err))
+		}
+		if cfg.MailFrom == "" {
+			errs = append(errs, errors.New("reminders.mail_from is required for email notifier"))
+		}
+		if strings.Count(cfg.MailTo, "%d") != 1 || strings.Count(cfg.MailTo, "%") != 1 {
+			errs = append(errs, fmt.Errorf("reminders.mail_to %q: must contain a single %%d for the user ID", cfg.MailTo))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("reminders.notifier %q: must be %q, %q, %q or %q", cfg.Notifier, notifierNone, notifierLog, notifierWebhook, notifierEmail))
+	}
+	if cfg.PollInterval <= 0 {
+		errs = append(errs, errors.New("reminders.poll_interval must be positive"))
+	}
+	if cfg.MaxAttempts <= 0 {
+		errs = append(errs, errors.New("reminders.max_attempts must be positive"))
+	}
+	if cfg.RetryBackoff <= 0 {
+		errs = append(errs, errors.New("reminders.retry_backoff must be positive"))
+	}
+	return errs
+}
+
+// newLogger создает логгер согласно настройкам.
+func newLogger(cfg LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// openStorage создает хранилище согласно настройкам. Возвращаемая функция
+// освобождает ресурсы хранилища.
+func openStorage(cfg StorageConfig) (Storage, func() error, error) {
+	if cfg.Backend == storageFile {
+		store, err := NewFileStore(cfg.Path, cfg.SnapshotEvery)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	}
+	return NewEventStore(), func() error { return nil }, nil
+}
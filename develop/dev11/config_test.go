@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envMap возвращает функцию getenv, читающую переменные из map.
+func envMap(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"CALENDAR_CONFIG": ""}))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Addr != ":8080" || cfg.Storage.Backend != storageMemory {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+	// Поставляемый config.json запускает сервер для разработки без секрета.
+	if !cfg.Auth.Disabled {
+		t.Errorf("Shipped config should disable auth for development: %+v", cfg.Auth)
+	}
+	cfg, err = loadConfig(nil, envMap(map[string]string{"CALENDAR_AUTH_SECRET": strings.Repeat("s", minSecretLength)}))
+	if err != nil || cfg.Auth.Disabled {
+		t.Errorf("Secret from the environment should enable auth over the shipped config: %+v, %v", cfg.Auth, err)
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"addr": ":9000", "read_timeout": "1s", "storage": {"backend": "file", "path": "/tmp/cal"}, "log": {"format": "json"}, "auth": {"disabled": true}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := envMap(map[string]string{
+		"CALENDAR_CONFIG":       path,
+		"CALENDAR_ADDR":         ":9001",
+		"CALENDAR_IDLE_TIMEOUT": "2m",
+	})
+	cfg, err := loadConfig([]string{"-addr", ":9002", "-log-level", "debug"}, env)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	if cfg.Addr != ":9002" {
+		t.Errorf("Flag should override env and file, got addr %q", cfg.Addr)
+	}
+	if time.Duration(cfg.IdleTimeout) != 2*time.Minute {
+		t.Errorf("Env should override defaults, got idle timeout %v", time.Duration(cfg.IdleTimeout))
+	}
+	if time.Duration(cfg.ReadTimeout) != time.Second || cfg.Storage.Path != "/tmp/cal" || cfg.Log.Format != logFormatJSON {
+		t.Errorf("File values were not applied: %+v", cfg)
+	}
+	if time.Duration(cfg.WriteTimeout) != 10*time.Second {
+		t.Errorf("Defaults should survive partial file, got write timeout %v", time.Duration(cfg.WriteTimeout))
+	}
+	if cfg.Log.Level != "debug" {
+		t.Errorf("Flag log level was not applied: %q", cfg.Log.Level)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-addr", "8080"}, "addr"},
+		{[]string{"-addr", ":99999"}, "invalid port"},
+		{[]string{"-read-timeout", "0s"}, "read_timeout"},
+		{[]string{"-shutdown-timeout", "0s"}, "shutdown_timeout"},
+		{[]string{"-shutdown-delay", "-1s"}, "shutdown_delay"},
+		{[]string{"-storage", "redis"}, "storage.backend"},
+		{[]string{"-storage", "file", "-storage-path", ""}, "storage.path"},
+		{[]string{"-log-format", "xml"}, "log.format"},
+		{[]string{"-log-level", "loud"}, "log.level"},
+		{[]string{"-notifier", "sms"}, "reminders.notifier"},
+		{[]string{"-notifier", "webhook"}, "reminders.webhook_url"},
+		{[]string{"-notifier", "webhook", "-webhook-url", "localhost:9000/hook"}, "reminders.webhook_url"},
+		{[]string{"-notifier", "email", "-smtp-addr", "localhost"}, "reminders.smtp_addr"},
+		{[]string{"-config", "/nonexistent/config.json"}, "read config"},
+	}
+	for _, test := range tests {
+		_, err := loadConfig(test.args, envMap(nil))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: expected error mentioning %q, got %v", test.args, test.want, err)
+		}
+	}
+
+	_, err := loadConfig(nil, envMap(map[string]string{"CALENDAR_AUTH_SECRET": "short"}))
+	if err == nil || !strings.Contains(err.Error(), "at least 32 bytes") {
+		t.Errorf("Expected error for short auth secret, got %v", err)
+	}
+}
+
+func TestLoadConfig_Auth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	secret := strings.Repeat("s", minSecretLength)
+	tests := []struct {
+		file string
+		env  map[string]string
+		want string
+	}{
+		{file: `{}`, want: "auth.secret is required unless auth.disabled is true"},
+		{file: `{"auth": {"disabled": false}}`, want: "auth.secret is required"},
+		{file: `{"auth": {"disabled": true, "secret": "` + secret + `"}}`, want: "auth.secret must be empty"},
+		{file: `{"auth": {"disabled": true}}`, env: map[string]string{"CALENDAR_AUTH_SECRET": secret, "CALENDAR_AUTH_DISABLED": "true"}, want: "auth.secret must be empty"},
+		{file: `{"auth": {"disabled": true}}`, env: map[string]string{"CALENDAR_AUTH_SECRET": secret}},
+		{file: `{}`, env: map[string]string{"CALENDAR_AUTH_DISABLED": "maybe"}, want: "CALENDAR_AUTH_DISABLED"},
+		{file: `{"auth": {"disabled": true}}`},
+		{file: `{}`, env: map[string]string{"CALENDAR_AUTH_DISABLED": "true"}},
+		{file: `{"auth": {"disabled": true}}`, env: map[string]string{"CALENDAR_AUTH_SECRET": secret, "CALENDAR_AUTH_DISABLED": "false"}},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(path, []byte(test.file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		env := map[string]string{"CALENDAR_CONFIG": path}
+		for name, value := range test.env {
+			env[name] = value
+		}
+		_, err := loadConfig(nil, envMap(env))
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s %v: unexpected error %v", test.file, test.env, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%s %v: expected error mentioning %q, got %v", test.file, test.env, test.want, err)
+		}
+	}
+}
+
+func TestLoadConfig_UnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"port": 8080}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig([]string{"-config", path}, envMap(nil)); err == nil {
+		t.Errorf("Expected error for unknown config field")
+	}
+}
+
+func TestLoadConfig_Limits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"auth": {"disabled": true}, "limits": {"rps": 5, "routes": {"/search": {"rps": 1}}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig([]string{"-config", path}, envMap(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if search, _ := cfg.Limits.forRoute("/search"); search.RPS != 1 || search.Burst != 40 || search.MaxBodyBytes != 1<<20 {
+		t.Errorf("Route limits did not inherit defaults: %+v", search)
+	}
+	if _, ok := cfg.Limits.Routes["/import_ics"]; !ok || cfg.Limits.RPS != 5 {
+		t.Errorf("File limits were not merged with defaults: %+v", cfg.Limits)
+	}
+
+	for _, data := range []string{
+		`{"limits": {"rps": -1}}`,
+		`{"limits": {"burst": 0}}`,
+		`{"limits": {"max_body_bytes": 0}}`,
+		`{"limits": {"routes": {"search": {"rps": 1}}}}`,
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig([]string{"-config", path}, envMap(nil)); err == nil || !strings.Contains(err.Error(), "limits") {
+			t.Errorf("Expected limits error for %s, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidEventTime возвращается, если конец события раньше его начала.
+var ErrInvalidEventTime = &BusinessError{msg: "event ends before it starts"}
+
+// Ограничения напоминаний одного события.
+const (
+	maxReminders       = 5
+	maxReminderMinutes = 7 * 24 * 60
+)
+
+// Ограничения тегов одного события.
+const (
+	maxTags      = 20
+	maxTagLength = 32
+)
+
+// UnmarshalJSON разбирает событие и переводит его моменты в часовой пояс
+// события: при сериализации в JSON сохраняется только смещение, а для
+// развертки повторений через переходы на летнее время нужен сам пояс.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type plain Event
+	if err := json.Unmarshal(data, (*plain)(e)); err != nil {
+		return err
+	}
+	return e.attachZone()
+}
+
+// Location возвращает часовой пояс события.
+func (e *Event) Location() (*time.Location, error) {
+	if e.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", e.TimeZone)
+	}
+	return loc, nil
+}
+
+// attachZone переводит моменты события в его часовой пояс.
+func (e *Event) attachZone() error {
+	loc, err := e.Location()
+	if err != nil {
+		return err
+	}
+	e.Date = e.Date.In(loc)
+	if !e.End.IsZero() {
+		e.End = e.End.In(loc)
+	}
+	return nil
+}
+
+// normalize проставляет значения по умолчанию и проверяет согласованность
+// времени события.
+func (e *Event) normalize() error {
+	if err := e.attachZone(); err != nil {
+		return &BusinessError{msg: err.Error()}
+	}
+	if e.End.IsZero() {
+		e.End = e.Date
+	}
+	if e.End.Before(e.Date) {
+		return ErrInvalidEventTime
+	}
+	if err := e.normalizeReminders(); err != nil {
+		return err
+	}
+	return e.normalizeTags()
+}
+
+// normalizeReminders упорядочивает напоминания, убирает повторы и проверяет
+// их количество и диапазон.
+func (e *Event) normalizeReminders() error {
+	if len(e.Reminders) == 0 {
+		e.Reminders = nil
+		return nil
+	}
+	reminders := append([]int(nil), e.Reminders...)
+	sort.Ints(reminders)
+	unique := reminders[:1]
+	for _, minutes := range reminders[1:] {
+		if minutes != unique[len(unique)-1] {
+			unique = append(unique, minutes)
+		}
+	}
+	if len(unique) > maxReminders {
+		return &BusinessError{msg: fmt.Sprintf("event may have at most %d reminders", maxReminders)}
+	}
+	if unique[0] < 0 || unique[len(unique)-1] > maxReminderMinutes {
+		return &BusinessError{msg: fmt.Sprintf("reminders must be between 0 and %d minutes before the event", maxReminderMinutes)}
+	}
+	e.Reminders = unique
+	return nil
+}
+
+// normalizeTags приводит теги к нижнему регистру, упорядочивает их, убирает
+// повторы и проверяет их количество и допустимые символы: буквы, цифры,
+// дефис и подчеркивание.
+func (e *Event) normalizeTags() error {
+	if len(e.Tags) == 0 {
+		e.Tags = nil
+		return nil
+	}
+	seen := make(map[string]bool, len(e.Tags))
+	tags := make([]string, 0, len(e.Tags))
+	for _, tag := range e.Tags {
+		tag, ok := normalizeTag(tag)
+		if !ok {
+			return &BusinessError{msg: fmt.Sprintf("tags must be 1 to %d letters, digits, '-' or '_'", maxTagLength)}
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTags {
+		return &BusinessError{msg: fmt.Sprintf("event may have at most %d tags", maxTags)}
+	}
+	sort.Strings(tags)
+	e.Tags = tags
+	return nil
+}
+
+// normalizeTag приводит тег к нижнему регистру и проверяет его.
+func normalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+		return "", false
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return "", false
+		}
+	}
+	return tag, true
+}
+
+// endOf возвращает конец экземпляра события, начинающегося в start. Для событий
+// на весь день длительность считается в календарных днях, чтобы переход на
+// летнее время не сдвигал границы дней.
+func (e *Event) endOf(start time.Time) time.Time {
+	if e.AllDay {
+		days := int(e.End.Sub(e.Date).Round(24*time.Hour) / (24 * time.Hour))
+		return start.AddDate(0, 0, days)
+	}
+	return start.Add(e.End.Sub(e.Date))
+}
+
+// overlaps проверяет, пересекается ли экземпляр события [start, end)
+// с полуинтервалом [from, to). Событие без длительности пересекается с
+// интервалом, если начинается внутри него.
+func overlaps(start, end, from, to time.Time) bool {
+	if !end.After(start) {
+		return !start.Before(from) && start.Before(to)
+	}
+	return start.Before(to) && end.After(from)
+}
+
+// occurrencesBetween возвращает экземпляры события, пересекающиеся с
+// полуинтервалом [from, to). Для повторяющегося события каждый экземпляр —
+// копия события с началом и концом повторения. Событие, правило которого
+// не удалось развернуть на [from, to), пропускается с предупреждением в логе,
+// чтобы не ломать весь запрос.
+func (e Event) occurrencesBetween(from, to time.Time) []Event {
+	if e.Recurrence == nil {
+		if overlaps(e.Date, e.End, from, to) {
+			return []Event{e}
+		}
+		return nil
+	}
+
+	// Экземпляры, начавшиеся до from, могут еще продолжаться.
+	starts, err := e.Recurrence.Occurrences(e.Date, from.Add(-e.End.Sub(e.Date)-24*time.Hour), to)
+	if err != nil {
+		slog.Warn("Recurring event skipped", slog.Int("event_id", e.ID), slog.Any("error", err))
+		return nil
+	}
+	var events []Event
+	for _, t := range starts {
+		occurrence := e
+		occurrence.Date, occurrence.End = t, e.endOf(t)
+		if overlaps(occurrence.Date, occurrence.End, from, to) {
+			events = append(events, occurrence)
+		}
+	}
+	return events
+}
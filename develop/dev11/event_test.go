@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// createForm создает событие через /create_event и проверяет код ответа.
+func createForm(t *testing.T, store Storage, values url.Values) {
+	t.Helper()
+	response := postForm(createEventFormHandler(store), "/create_event", values)
+	if response.Code != http.StatusOK {
+		t.Fatalf("create_event %v: expected status code %d, but got %d: %s", values, http.StatusOK, response.Code, response.Body)
+	}
+}
+
+// eventIDs возвращает ID событий из ответа events_for_*.
+func eventIDs(t *testing.T, handler http.HandlerFunc, values url.Values) []int {
+	t.Helper()
+	response := getQuery(handler, "/events_for_period", values)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, response.Code, response.Body)
+	}
+	var body struct {
+		Result []Event `json:"result"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	ids := make([]int, len(body.Result))
+	for i, event := range body.Result {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseEventTime(t *testing.T) {
+	moscow := mustLoadLocation(t, "Europe/Moscow")
+	tests := []struct {
+		values url.Values
+		start  time.Time
+		end    time.Time
+		allDay bool
+	}{
+		{
+			url.Values{"date": {"2019-09-09"}},
+			time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC), time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC), false,
+		},
+		{
+			url.Values{"date": {"2019-09-09"}, "time": {"10:00"}, "duration": {"1h30m"}, "tz": {"Europe/Moscow"}},
+			time.Date(2019, 9, 9, 10, 0, 0, 0, moscow), time.Date(2019, 9, 9, 11, 30, 0, 0, moscow), false,
+		},
+		{
+			url.Values{"date": {"2019-09-09"}, "time": {"23:00"}, "end_date": {"2019-09-10"}, "end_time": {"01:00"}},
+			time.Date(2019, 9, 9, 23, 0, 0, 0, time.UTC), time.Date(2019, 9, 10, 1, 0, 0, 0, time.UTC), false,
+		},
+		{
+			url.Values{"date": {"2019-09-09"}, "end_date": {"2019-09-11"}, "all_day": {"true"}, "tz": {"Europe/Moscow"}},
+			time.Date(2019, 9, 9, 0, 0, 0, 0, moscow), time.Date(2019, 9, 12, 0, 0, 0, 0, moscow), true,
+		},
+	}
+	for _, test := range tests {
+		var event Event
+		if err := parseEventTime(test.values, &event); err != nil {
+			t.Fatalf("%v: %v", test.values, err)
+		}
+		if !event.Date.Equal(test.start) || !event.End.Equal(test.end) || event.AllDay != test.allDay {
+			t.Errorf("%v: expected %v - %v (all day %v), got %v - %v (all day %v)",
+				test.values, test.start, test.end, test.allDay, event.Date, event.End, event.AllDay)
+		}
+	}
+
+	for _, values := range []url.Values{
+		{"date": {"2019-09-09"}, "tz": {"Mars/Olympus"}},
+		{"date": {"2019-09-09"}, "time": {"25:00"}},
+		{"date": {"2019-09-09"}, "time": {"10:00"}, "end_time": {"09:00"}},
+		{"date": {"2019-09-09"}, "end_time": {"09:00"}, "duration": {"1h"}},
+		{"date": {"2019-09-09"}, "all_day": {"true"}, "time": {"10:00"}},
+		{"date": {"2019-09-09"}, "all_day": {"yes please"}},
+	} {
+		var event Event
+		if err := parseEventTime(values, &event); err == nil {
+			t.Errorf("%v: expected error", values)
+		}
+	}
+}
+
+func TestEventsForDay_CallerTimeZone(t *testing.T) {
+	store := NewEventStore()
+	// 23:30 по Москве 9 сентября — это 20:30 UTC 9 сентября и 05:30 10 сентября в Токио.
+	createForm(t, store, url.Values{"user_id": {"1"}, "name": {"Late call"},
+		"date": {"2019-09-09"}, "time": {"23:30"}, "duration": {"1h"}, "tz": {"Europe/Moscow"}})
+	createForm(t, store, url.Values{"user_id": {"1"}, "name": {"Holiday"},
+		"date": {"2019-09-10"}, "all_day": {"true"}})
+
+	handler := eventsForPeriodHandler(store, dayPeriod)
+	tests := []struct {
+		date, tz string
+		want     []int
+	}{
+		{"2019-09-09", "Europe/Moscow", []int{1}},
+		{"2019-09-10", "Europe/Moscow", []int{1, 2}},
+		{"2019-09-09", "", []int{1}},
+		{"2019-09-10", "", []int{2}},
+		{"2019-09-10", "Asia/Tokyo", []int{1, 2}},
+		{"2019-09-09", "Asia/Tokyo", []int{}},
+	}
+	for _, test := range tests {
+		values := url.Values{"user_id": {"1"}, "date": {test.date}}
+		if test.tz != "" {
+			values.Set("tz", test.tz)
+		}
+		if got := eventIDs(t, handler, values); !equalInts(got, test.want) {
+			t.Errorf("%s in %q: expected %v, got %v", test.date, test.tz, test.want, got)
+		}
+	}
+}
+
+func TestEvent_RecurrenceAcrossDST(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	createForm(t, store, url.Values{"user_id": {"1"}, "name": {"Standup"},
+		"date": {"2019-10-21"}, "time": {"09:00"}, "duration": {"15m"}, "tz": {"Europe/Berlin"},
+		"rrule": {"FREQ=WEEKLY;COUNT=3"}})
+	store.Close()
+
+	// После восстановления из журнала часовой пояс события сохраняется.
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+
+	events, _ := reopened.EventsBetween(1, time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, 11, 30, 0, 0, 0, 0, time.UTC))
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 occurrences, got %d", len(events))
+	}
+	for _, event := range events {
+		if h, m, _ := event.Date.Clock(); h != 9 || m != 0 || event.Date.Location().String() != "Europe/Berlin" {
+			t.Errorf("Occurrence %v is not at 09:00 Berlin time", event.Date)
+		}
+		if event.End.Sub(event.Date) != 15*time.Minute {
+			t.Errorf("Occurrence %v lost its duration", event.Date)
+		}
+	}
+}
+
+func TestEvent_Reminders(t *testing.T) {
+	store := NewEventStore()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	event, err := store.CreateEvent(1, Event{Date: date, Reminders: []int{60, 10, 60}})
+	if err != nil || fmt.Sprint(event.Reminders) != "[10 60]" {
+		t.Errorf("Expected reminders [10 60], got %v, %v", event.Reminders, err)
+	}
+	for _, reminders := range [][]int{{-1}, {maxReminderMinutes + 1}, {1, 2, 3, 4, 5, 6}} {
+		if _, err := store.CreateEvent(1, Event{Date: date, Reminders: reminders}); err == nil {
+			t.Errorf("Expected error for reminders %v", reminders)
+		}
+	}
+
+	values := url.Values{"user_id": {"1"}, "name": {"x"}, "date": {"2019-09-09"}, "reminders": {"10, 60"}}
+	p, err := parseEventParams(httptest.NewRequest(http.MethodPost, "/create_event", nil), values, false)
+	if err != nil || fmt.Sprint(p.Event.Reminders) != "[10 60]" {
+		t.Errorf("Expected reminders [10 60], got %v, %v", p.Event.Reminders, err)
+	}
+	for _, raw := range []string{"soon", "-5", "20000", "1,2,3,4,5,6"} {
+		values.Set("reminders", raw)
+		if _, err := parseEventParams(httptest.NewRequest(http.MethodPost, "/create_event", nil), values, false); err == nil {
+			t.Errorf("Expected error for reminders %q", raw)
+		}
+	}
+}
+
+func TestEventStore_RejectsInvalidTime(t *testing.T) {
+	store := NewEventStore()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	if _, err := store.CreateEvent(1, Event{Date: date, End: date.Add(-time.Hour)}); err != ErrInvalidEventTime {
+		t.Errorf("Expected ErrInvalidEventTime, got %v", err)
+	}
+}
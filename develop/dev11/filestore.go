@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Имена файлов хранилища внутри каталога данных.
+const (
+	journalFileName  = "journal.log"
+	snapshotFileName = "snapshot.json"
+)
+
+// defaultSnapshotEvery — число записей журнала, после которого он сжимается в снимок.
+const defaultSnapshotEvery = 1000
+
+// snapshot — сжатое состояние хранилища на момент изменения Seq.
+type snapshot struct {
+	Seq    uint64         `json:"seq"`
+	NextID int            `json:"next_id"`
+	Users  []snapshotUser `json:"users"`
+}
+
+// snapshotUser — события одного пользователя в снимке.
+type snapshotUser struct {
+	ID     int     `json:"id"`
+	Events []Event `json:"events"`
+	Shares []Share `json:"shares,omitempty"`
+}
+
+// journalFile — файл журнала; в тестах подменяется файлом со сбоями записи.
+type journalFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FileStore — хранилище событий на диске. Каждое изменение сначала
+// дописывается в журнал (write-ahead log), а затем применяется к состоянию
+// в памяти. Журнал периодически сжимается в снимок; при запуске состояние
+// восстанавливается из снимка и последующих записей журнала.
+type FileStore struct {
+	*EventStore
+	dir           string
+	journal       journalFile
+	records       int
+	snapshotEvery int
+	// broken — ошибка, после которой журнал не удалось вернуть к последней
+	// целой записи; дальнейшие изменения отклоняются.
+	broken error
+}
+
+var _ Storage = (*FileStore)(nil)
+
+// NewFileStore открывает хранилище в каталоге dir, создавая его при необходимости,
+// и восстанавливает сохраненное состояние. snapshotEvery задает число записей
+// журнала между снимками; значение <= 0 означает значение по умолчанию.
+func NewFileStore(dir string, snapshotEvery int) (*FileStore, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = defaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	fs := &FileStore{
+		EventStore:    NewEventStore(),
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+	}
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	journal, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	fs.journal = journal
+	if err := fs.replay(); err != nil {
+		journal.Close()
+		return nil, err
+	}
+
+	fs.EventStore.log = fs
+	return fs, nil
+}
+
+// Close закрывает файл журнала. Все изменения к этому моменту уже на диске.
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.journal.Close()
+}
+
+// Snapshot принудительно сжимает журнал в снимок.
+func (fs *FileStore) Snapshot() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.compact()
+}
+
+// append дописывает изменение в журнал и сбрасывает его на диск.
+// Вызывается EventStore под блокировкой на запись. Если запись не удалась,
+// журнал обрезается до прежней длины: отклоненное изменение не должно
+// попасть в журнал, иначе при восстановлении оно заняло бы номер Seq
+// следующего принятого изменения.
+func (fs *FileStore) append(c change) error {
+	if fs.broken != nil {
+		return fs.broken
+	}
+	if fs.records >= fs.snapshotEvery {
+		if err := fs.compact(); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("encode journal record: %w", err)
+	}
+	offset, err := fs.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("locate journal end: %w", err)
+	}
+	if _, err := fs.journal.Write(append(line, '\n')); err != nil {
+		return fs.rollback(offset, fmt.Errorf("write journal: %w", err))
+	}
+	if err := fs.journal.Sync(); err != nil {
+		return fs.rollback(offset, fmt.Errorf("sync journal: %w", err))
+	}
+	fs.records++
+	return nil
+}
+
+// rollback отбрасывает недописанную запись журнала начиная с offset и
+// возвращает cause. Если журнал не удалось обрезать, хранилище помечается
+// неисправным, чтобы следующие записи не оказались после поврежденной.
+func (fs *FileStore) rollback(offset int64, cause error) error {
+	if err := fs.journal.Truncate(offset); err != nil {
+		fs.broken = fmt.Errorf("journal broken after %v: truncate: %w", cause, err)
+		return fs.broken
+	}
+	if _, err := fs.journal.Seek(offset, io.SeekStart); err != nil {
+		fs.broken = fmt.Errorf("journal broken after %v: rewind: %w", cause, err)
+		return fs.broken
+	}
+	return cause
+}
+
+// compact записывает снимок текущего состояния и очищает журнал.
+// Снимок сначала пишется во временный файл и атомарно переименовывается,
+// поэтому сбой на любом шаге оставляет на диске согласованное состояние:
+// записи журнала, уже вошедшие в снимок, при восстановлении пропускаются.
+// Вызывающий должен удерживать блокировку на запись.
+func (fs *FileStore) compact() error {
+	snap := snapshot{Seq: fs.seq, NextID: fs.nextID, Users: make([]snapshotUser, 0, len(fs.events))}
+	for userID, userEvents := range fs.events {
+		user := snapshotUser{ID: userID, Events: make([]Event, 0, len(userEvents))}
+		for _, event := range userEvents {
+			user.Events = append(user.Events, event)
+		}
+		sortEvents(user.Events)
+		for granteeID, access := range fs.shares[userID] {
+			user.Shares = append(user.Shares, Share{UserID: granteeID, Access: access})
+		}
+		sort.Slice(user.Shares, func(i, j int) bool { return user.Shares[i].UserID < user.Shares[j].UserID })
+		snap.Users = append(snap.Users, user)
+	}
+	sort.Slice(snap.Users, func(i, j int) bool { return snap.Users[i].ID < snap.Users[j].ID })
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	path := filepath.Join(fs.dir, snapshotFileName)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+	if err := syncDir(fs.dir); err != nil {
+		return fmt.Errorf("sync data dir: %w", err)
+	}
+
+	if err := fs.journal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+	if _, err := fs.journal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind journal: %w", err)
+	}
+	fs.records = 0
+	return nil
+}
+
+// loadSnapshot загружает последний снимок, если он есть.
+func (fs *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(fs.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	for _, user := range snap.Users {
+		fs.userEvents(user.ID)
+		for _, event := range user.Events {
+			fs.putEvent(user.ID, event)
+		}
+		for _, share := range user.Shares {
+			fs.applyShare(user.ID, share)
+		}
+	}
+	fs.seq = snap.Seq
+	if snap.NextID > fs.nextID {
+		fs.nextID = snap.NextID
+	}
+	return nil
+}
+
+// replay применяет записи журнала, не вошедшие в снимок. Недописанная
+// последняя запись (сбой во время записи) отбрасывается, а журнал
+// обрезается до последней целой записи. Поврежденная запись в середине
+// журнала считается ошибкой.
+func (fs *FileStore) replay() error {
+	reader := bufio.NewReader(fs.journal)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// Последняя запись не завершена переводом строки.
+				return fs.truncateJournal(offset)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read journal: %w", err)
+		}
+
+		var c change
+		if err := json.Unmarshal(line, &c); err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				return fs.truncateJournal(offset)
+			}
+			return fmt.Errorf("journal corrupted at offset %d: %w", offset, err)
+		}
+		if c.Seq > fs.seq+1 {
+			return fmt.Errorf("journal gap at offset %d: expected seq %d, got %d", offset, fs.seq+1, c.Seq)
+		}
+		offset += int64(len(line))
+		if c.Seq <= fs.seq {
+			continue
+		}
+		if (c.Op == opCreateEvent || c.Op == opUpdateEvent) && c.Event == nil {
+			return fmt.Errorf("journal record %d has no event", c.Seq)
+		}
+		if c.Op == opShare && c.Share == nil {
+			return fmt.Errorf("journal record %d has no share", c.Seq)
+		}
+		fs.apply(c)
+		fs.records++
+	}
+
+	_, err := fs.journal.Seek(0, io.SeekEnd)
+	return err
+}
+
+// truncateJournal отбрасывает хвост журнала начиная с offset.
+func (fs *FileStore) truncateJournal(offset int64) error {
+	if err := fs.journal.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate torn journal record: %w", err)
+	}
+	_, err := fs.journal.Seek(offset, io.SeekStart)
+	return err
+}
+
+// writeFileSync записывает файл и сбрасывает его содержимое на диск.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir сбрасывает на диск метаданные каталога (например, после переименования).
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
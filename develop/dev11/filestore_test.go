@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore_Replay(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	store.CreateUser(7)
+	store.ShareCalendar(1, 7, AccessWrite)
+	store.ShareCalendar(1, 8, AccessRead)
+	store.ShareCalendar(1, 8, AccessNone)
+	store.CreateEvent(1, Event{Name: "Standup", Date: date})
+	store.CreateEvent(1, Event{Name: "Retro", Date: date})
+	store.UpdateEvent(1, Event{ID: 1, Version: 1, Name: "Planning", Date: date})
+	store.DeleteEvent(1, 2, 1)
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+
+	events, _ := reopened.GetUserEvents(1)
+	if len(events) != 1 || events[0].Name != "Planning" || events[0].Version != 2 || !events[0].Date.Equal(date) {
+		t.Errorf("Unexpected events after replay: %+v", events)
+	}
+	if !reopened.HasUser(7) {
+		t.Errorf("User without events was not restored")
+	}
+	if shares := reopened.CalendarShares(1); len(shares) != 1 || shares[0] != (Share{7, AccessWrite}) {
+		t.Errorf("Unexpected shares after replay: %+v", shares)
+	}
+	// ID удаленного события не выдается повторно.
+	if event, _ := reopened.CreateEvent(1, Event{Date: date}); event.ID != 3 {
+		t.Errorf("Expected new event ID 3, got %d", event.ID)
+	}
+}
+
+func TestFileStore_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+
+	store, err := NewFileStore(dir, 3)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := store.CreateEvent(1, Event{Date: date}); err != nil {
+			t.Fatalf("CreateEvent: %v", err)
+		}
+	}
+	store.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("Snapshot was not written: %v", err)
+	}
+	if store.records > 3 {
+		t.Errorf("Journal was not compacted: %d records", store.records)
+	}
+
+	reopened, err := NewFileStore(dir, 3)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	events, _ := reopened.GetUserEvents(1)
+	if len(events) != 10 {
+		t.Errorf("Expected 10 events after replay, got %d", len(events))
+	}
+	reopened.DeleteEvent(1, 10, 0)
+	reopened.ShareCalendar(1, 2, AccessRead)
+	reopened.Snapshot()
+	reopened.Close()
+
+	// Счетчик ID сохраняется в снимке, даже если событие с максимальным ID удалено.
+	again, err := NewFileStore(dir, 3)
+	if err != nil {
+		t.Fatalf("reopen after snapshot: %v", err)
+	}
+	defer again.Close()
+	if event, _ := again.CreateEvent(1, Event{Date: date}); event.ID != 11 {
+		t.Errorf("Expected new event ID 11, got %d", event.ID)
+	}
+	if again.CalendarAccess(1, 2) != AccessRead {
+		t.Errorf("Share was not restored from snapshot")
+	}
+}
+
+func TestFileStore_TornRecord(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	store.CreateEvent(1, Event{Date: date})
+	store.Close()
+
+	// Имитация сбоя во время записи второй записи журнала.
+	journal := filepath.Join(dir, journalFileName)
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":2,"op":"create","user_id":1,"ev`)
+	f.Close()
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen with torn record: %v", err)
+	}
+	if !reopened.ContainsEvent(1, 1) {
+		t.Errorf("Complete record was lost")
+	}
+	if _, err := reopened.CreateEvent(1, Event{Date: date}); err != nil {
+		t.Fatalf("CreateEvent after recovery: %v", err)
+	}
+	reopened.Close()
+
+	again, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen after recovery: %v", err)
+	}
+	defer again.Close()
+	if !again.ContainsEvent(1, 2) {
+		t.Errorf("Record written after recovery was lost")
+	}
+}
+
+func TestFileStore_CorruptedJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(dir, journalFileName)
+	data := "not json\n" + `{"seq":1,"op":"create_user","user_id":1}` + "\n"
+	if err := os.WriteFile(journal, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStore(dir, 0); err == nil {
+		t.Errorf("Expected error for corrupted journal")
+	}
+}
+
+// failingJournal — журнал, запись в который дописывает половину данных и
+// завершается ошибкой, пока установлен failWrite; failTruncate ломает и
+// откат записи.
+type failingJournal struct {
+	*os.File
+	failWrite    bool
+	failSync     bool
+	failTruncate bool
+}
+
+var errDiskFull = errors.New("no space left on device")
+
+func (j *failingJournal) Write(p []byte) (int, error) {
+	if !j.failWrite {
+		return j.File.Write(p)
+	}
+	n, _ := j.File.Write(p[:len(p)/2])
+	return n, errDiskFull
+}
+
+func (j *failingJournal) Sync() error {
+	if j.failSync {
+		return errDiskFull
+	}
+	return j.File.Sync()
+}
+
+func (j *failingJournal) Truncate(size int64) error {
+	if j.failTruncate {
+		return errDiskFull
+	}
+	return j.File.Truncate(size)
+}
+
+func TestFileStore_FailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	path := filepath.Join(dir, journalFileName)
+
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	store.CreateEvent(1, Event{Name: "Accepted", Date: date})
+	journal := &failingJournal{File: store.journal.(*os.File)}
+	store.journal = journal
+	before, _ := os.ReadFile(path)
+
+	for _, fail := range []*bool{&journal.failWrite, &journal.failSync} {
+		*fail = true
+		if _, err := store.CreateEvent(1, Event{Name: "Rejected", Date: date}); !errors.Is(err, errDiskFull) {
+			t.Errorf("Expected journal error, got %v", err)
+		}
+		*fail = false
+		if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+			t.Errorf("Failed record was left in the journal: %q", after[len(before):])
+		}
+	}
+
+	if _, err := store.CreateEvent(1, Event{Name: "Next", Date: date}); err != nil {
+		t.Fatalf("CreateEvent after failed append: %v", err)
+	}
+	store.Close()
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen after failed append: %v", err)
+	}
+	defer reopened.Close()
+	events, _ := reopened.GetUserEvents(1)
+	if len(events) != 2 || events[0].Name != "Accepted" || events[1].Name != "Next" {
+		t.Errorf("Unexpected events after replay: %+v", events)
+	}
+}
+
+func TestFileStore_BrokenJournal(t *testing.T) {
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	store, err := NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer store.Close()
+	store.journal = &failingJournal{File: store.journal.(*os.File), failWrite: true, failTruncate: true}
+
+	if _, err := store.CreateEvent(1, Event{Date: date}); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Expected journal error, got %v", err)
+	}
+	// Журнал с недописанной записью не принимает новых изменений.
+	store.journal.(*failingJournal).failWrite = false
+	if _, err := store.CreateEvent(1, Event{Date: date}); err == nil {
+		t.Errorf("Expected broken journal to reject changes")
+	}
+	if store.ContainsEvent(1, 1) || store.ContainsEvent(1, 2) {
+		t.Errorf("Rejected change was applied")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy определяет, как хранилище реагирует на пересечение
+// сохраняемого события с другими событиями пользователя.
+type ConflictPolicy int
+
+const (
+	// ConflictIgnore — пересечения не проверяются.
+	ConflictIgnore ConflictPolicy = iota
+	// ConflictWarn — событие сохраняется, пересечения возвращаются вызывающему.
+	ConflictWarn
+	// ConflictReject — событие с пересечениями не сохраняется.
+	ConflictReject
+)
+
+// conflictHorizon ограничивает проверку пересечений повторяющегося события:
+// сравниваются только экземпляры, начинающиеся в течение года от его начала.
+const conflictHorizon = 366 * 24 * time.Hour
+
+// maxReportedConflicts — число пересечений, перечисляемых в тексте ошибки.
+const maxReportedConflicts = 5
+
+// ErrEventConflict возвращается, если событие пересекается с другими
+// событиями пользователя, а политика запрещает пересечения.
+var ErrEventConflict = &BusinessError{msg: "event overlaps other events"}
+
+// ConflictError перечисляет экземпляры событий, с которыми пересекается
+// сохраняемое событие. errors.Is(err, ErrEventConflict) для нее истинно.
+type ConflictError struct {
+	Conflicts []Event
+}
+
+func (e *ConflictError) Error() string {
+	parts := make([]string, 0, maxReportedConflicts+1)
+	for i, event := range e.Conflicts {
+		if i == maxReportedConflicts {
+			parts = append(parts, fmt.Sprintf("and %d more", len(e.Conflicts)-i))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%d at %s", event.ID, event.Date.Format(time.RFC3339)))
+	}
+	return ErrEventConflict.msg + ": " + strings.Join(parts, ", ")
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrEventConflict
+}
+
+// blocksTime сообщает, занимает ли событие время в расписании. События на
+// весь день (праздники, дни рождения) и события без длительности
+// (напоминания, дедлайны) не делают время занятым.
+func (e *Event) blocksTime() bool {
+	return !e.AllDay && e.End.After(e.Date)
+}
+
+// conflictsWith возвращает экземпляры событий из others, пересекающиеся с
+// экземплярами event. Само событие (по ID) не учитывается. Событие должно
+// быть нормализовано.
+func conflictsWith(event Event, others []Event) []Event {
+	if !event.blocksTime() {
+		return nil
+	}
+	to := event.End
+	if event.Recurrence != nil {
+		to = event.endOf(event.Date.Add(conflictHorizon))
+	}
+	own := event.occurrencesBetween(event.Date, to)
+
+	conflicts := make([]Event, 0)
+	for _, other := range others {
+		if other.ID == event.ID || !other.blocksTime() {
+			continue
+		}
+		for _, occurrence := range other.occurrencesBetween(event.Date, to) {
+			for _, mine := range own {
+				if occurrence.Date.Before(mine.End) && occurrence.End.After(mine.Date) {
+					conflicts = append(conflicts, occurrence)
+					break
+				}
+			}
+		}
+	}
+	sortEvents(conflicts)
+	return conflicts
+}
+
+// Interval — полуинтервал времени [Start, End).
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// FreeBusy описывает занятость пользователя в диапазоне времени.
+type FreeBusy struct {
+	// Busy — занятые интервалы, объединенные и упорядоченные по началу.
+	Busy []Interval `json:"busy"`
+	// Free — промежутки между занятыми интервалами не короче запрошенной длительности.
+	Free []Interval `json:"free"`
+}
+
+// freeBusy вычисляет занятые и свободные интервалы в [from, to) по
+// экземплярам событий, упорядоченным по началу (как возвращает EventsBetween).
+// Свободные промежутки короче minFree отбрасываются. Моменты переводятся
+// в часовой пояс from.
+func freeBusy(events []Event, from, to time.Time, minFree time.Duration) FreeBusy {
+	loc := from.Location()
+	result := FreeBusy{Busy: make([]Interval, 0), Free: make([]Interval, 0)}
+	for _, event := range events {
+		if !event.blocksTime() {
+			continue
+		}
+		start, end := event.Date, event.End
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		if n := len(result.Busy); n > 0 && !start.After(result.Busy[n-1].End) {
+			if end.After(result.Busy[n-1].End) {
+				result.Busy[n-1].End = end.In(loc)
+			}
+			continue
+		}
+		result.Busy = append(result.Busy, Interval{Start: start.In(loc), End: end.In(loc)})
+	}
+
+	cursor := from
+	for _, busy := range append(result.Busy, Interval{Start: to, End: to}) {
+		if gap := busy.Start.Sub(cursor); gap > 0 && gap >= minFree {
+			result.Free = append(result.Free, Interval{Start: cursor.In(loc), End: busy.Start.In(loc)})
+		}
+		cursor = busy.End
+	}
+	return result
+}
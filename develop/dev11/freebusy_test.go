@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func meeting(day, hour, minutes int) Event {
+	start := time.Date(2019, 9, day, hour, 0, 0, 0, time.UTC)
+	return Event{Name: "meeting", Date: start, End: start.Add(time.Duration(minutes) * time.Minute)}
+}
+
+func TestEventStore_ScheduleEvent_Conflicts(t *testing.T) {
+	store := NewEventStore()
+	standup, _ := store.CreateEvent(1, meeting(9, 10, 60))
+	store.CreateEvent(1, Event{Name: "holiday", Date: time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC), End: time.Date(2019, 9, 10, 0, 0, 0, 0, time.UTC), AllDay: true})
+	store.CreateEvent(2, meeting(9, 10, 60))
+
+	// Пересечение с событием того же пользователя; события на весь день
+	// и события других пользователей не учитываются.
+	_, conflicts, err := store.ScheduleEvent(1, meeting(9, 10, 30), ConflictReject)
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) || !errors.Is(err, ErrEventConflict) {
+		t.Fatalf("Expected ConflictError, got %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].ID != standup.ID {
+		t.Errorf("Unexpected conflicts: %+v", conflicts)
+	}
+	if events, _ := store.GetUserEvents(1); len(events) != 2 {
+		t.Errorf("Rejected event was saved: %+v", events)
+	}
+
+	// Смежные события не пересекаются.
+	if _, conflicts, err := store.ScheduleEvent(1, meeting(9, 11, 30), ConflictReject); err != nil || len(conflicts) != 0 {
+		t.Errorf("Adjacent event: conflicts %+v, err %v", conflicts, err)
+	}
+
+	event, conflicts, err := store.ScheduleEvent(1, meeting(9, 10, 90), ConflictWarn)
+	if err != nil || event.ID == 0 {
+		t.Fatalf("ScheduleEvent with ConflictWarn: %v", err)
+	}
+	if len(conflicts) != 2 {
+		t.Errorf("Expected 2 conflicts, got %+v", conflicts)
+	}
+
+	// Изменение события не конфликтует с его прежней версией.
+	standup.End = standup.End.Add(-30 * time.Minute)
+	if _, _, err := store.ScheduleEvent(1, standup, ConflictWarn); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	updated, conflicts, _ := store.ScheduleEvent(1, meeting(9, 10, 20), ConflictWarn)
+	for _, conflict := range conflicts {
+		if conflict.ID == updated.ID {
+			t.Errorf("Event conflicts with itself: %+v", conflicts)
+		}
+	}
+}
+
+func TestEventStore_ScheduleEvent_RecurringConflict(t *testing.T) {
+	store := NewEventStore()
+	weekly := meeting(2, 15, 60)
+	weekly.Recurrence = &Recurrence{Freq: freqWeekly}
+	store.CreateEvent(1, weekly)
+
+	// Разовая встреча в понедельник через месяц попадает на повторение.
+	_, conflicts, err := store.ScheduleEvent(1, meeting(30, 15, 30), ConflictReject)
+	if err == nil || len(conflicts) != 1 || !conflicts[0].Date.Equal(time.Date(2019, 9, 30, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected conflict with occurrence on 2019-09-30, got %+v, %v", conflicts, err)
+	}
+
+	// Еженедельное событие по средам ни с чем не пересекается, ежедневное — пересекается.
+	wednesdays := meeting(4, 15, 60)
+	wednesdays.Recurrence = &Recurrence{Freq: freqWeekly, Count: 3}
+	if _, _, err := store.ScheduleEvent(1, wednesdays, ConflictReject); err != nil {
+		t.Errorf("Unexpected conflict: %v", err)
+	}
+	daily := meeting(1, 15, 60)
+	daily.Recurrence = &Recurrence{Freq: freqDaily, Count: 3}
+	if _, _, err := store.ScheduleEvent(1, daily, ConflictReject); !errors.Is(err, ErrEventConflict) {
+		t.Errorf("Expected conflict for daily event, got %v", err)
+	}
+}
+
+func TestEventStore_ScheduleEvent_InvitationConflict(t *testing.T) {
+	store := NewEventStore()
+	review := meeting(9, 10, 60)
+	review.Attendees = []Attendee{{UserID: 1}}
+	review, _ = store.CreateEvent(2, review)
+
+	// Приглашение, на которое еще не ответили, время не занимает.
+	if _, _, err := store.ScheduleEvent(1, meeting(9, 10, 30), ConflictReject); err != nil {
+		t.Fatalf("Pending invitation caused a conflict: %v", err)
+	}
+	if _, err := store.RespondToInvitation(2, review.ID, 1, StatusAccepted); err != nil {
+		t.Fatalf("RespondToInvitation: %v", err)
+	}
+	_, conflicts, err := store.ScheduleEvent(1, meeting(9, 10, 45), ConflictReject)
+	if !errors.Is(err, ErrEventConflict) || len(conflicts) != 2 {
+		t.Fatalf("Expected conflicts with the accepted invitation and own event, got %+v, %v", conflicts, err)
+	}
+	if conflicts[0].ID != review.ID && conflicts[1].ID != review.ID {
+		t.Errorf("Accepted invitation is missing from conflicts: %+v", conflicts)
+	}
+
+	if _, err := store.RespondToInvitation(2, review.ID, 1, StatusDeclined); err != nil {
+		t.Fatalf("RespondToInvitation: %v", err)
+	}
+	if _, conflicts, _ := store.ScheduleEvent(1, meeting(9, 10, 45), ConflictWarn); len(conflicts) != 1 || conflicts[0].ID == review.ID {
+		t.Errorf("Declined invitation should not conflict, got %+v", conflicts)
+	}
+}
+
+func TestFreeBusy(t *testing.T) {
+	from := time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	events := []Event{
+		{Date: from.Add(-time.Hour), End: from.Add(time.Hour)},
+		{Date: from.Add(9 * time.Hour), End: from.Add(10 * time.Hour)},
+		{Date: from.Add(9*time.Hour + 30*time.Minute), End: from.Add(11 * time.Hour)},
+		{Date: from.Add(11 * time.Hour), End: from.Add(12 * time.Hour)},
+		{Date: from.Add(12*time.Hour + 15*time.Minute), End: from.Add(13 * time.Hour)},
+		{Date: from.Add(14 * time.Hour), End: from.Add(14 * time.Hour)},
+	}
+
+	result := freeBusy(events, from, to, 30*time.Minute)
+	busy := []Interval{
+		{from, from.Add(time.Hour)},
+		{from.Add(9 * time.Hour), from.Add(12 * time.Hour)},
+		{from.Add(12*time.Hour + 15*time.Minute), from.Add(13 * time.Hour)},
+	}
+	free := []Interval{
+		{from.Add(time.Hour), from.Add(9 * time.Hour)},
+		{from.Add(13 * time.Hour), to},
+	}
+	if !equalIntervals(result.Busy, busy) {
+		t.Errorf("Expected busy %v, got %v", busy, result.Busy)
+	}
+	if !equalIntervals(result.Free, free) {
+		t.Errorf("Expected free %v, got %v", free, result.Free)
+	}
+}
+
+func equalIntervals(a, b []Interval) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Start.Equal(b[i].Start) || !a[i].End.Equal(b[i].End) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCreateEventFormHandler_OnConflict(t *testing.T) {
+	store := NewEventStore()
+	store.CreateEvent(3, meeting(9, 10, 60))
+	handler := createEventFormHandler(store)
+	values := url.Values{"user_id": {"3"}, "name": {"Retro"}, "date": {"2019-09-09"}, "time": {"10:30"}, "duration": {"1h"}}
+
+	response := postForm(handler, "/create_event", values)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, response.Code, response.Body)
+	}
+	var body struct {
+		Result    Event   `json:"result"`
+		Conflicts []Event `json:"conflicts"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Result.ID != 2 || len(body.Conflicts) != 1 || body.Conflicts[0].ID != 1 {
+		t.Errorf("Unexpected response: %s", response.Body)
+	}
+
+	values.Set("on_conflict", "reject")
+	response = postForm(handler, "/create_event", values)
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, but got %d", http.StatusServiceUnavailable, response.Code)
+	}
+
+	values.Set("on_conflict", "ignore")
+	response = postForm(handler, "/create_event", values)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, response.Code)
+	}
+}
+
+func TestFreeBusyHandler(t *testing.T) {
+	store := NewEventStore()
+	store.CreateEvent(3, meeting(9, 7, 60))
+	handler := freeBusyHandler(store)
+
+	response := getQuery(handler, "/free_busy", url.Values{"user_id": {"3"}, "date": {"2019-09-09"}, "tz": {"Europe/Moscow"}})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, response.Code, response.Body)
+	}
+	var body struct {
+		Result FreeBusy `json:"result"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	if len(body.Result.Busy) != 1 || body.Result.Busy[0].Start.Format(time.RFC3339) != "2019-09-09T10:00:00+03:00" {
+		t.Errorf("Unexpected busy intervals: %+v", body.Result.Busy)
+	}
+	if len(body.Result.Free) != 2 || !body.Result.Free[0].Start.Equal(time.Date(2019, 9, 9, 0, 0, 0, 0, moscow)) {
+		t.Errorf("Unexpected free intervals: %+v", body.Result.Free)
+	}
+
+	for _, values := range []url.Values{
+		{"user_id": {"3"}, "date": {"2019-09-09"}, "end_date": {"2019-09-08"}},
+		{"user_id": {"3"}, "date": {"2019-09-09"}, "end_date": {"2021-09-09"}},
+		{"user_id": {"3"}, "date": {"2019-09-09"}, "min_duration": {"soon"}},
+	} {
+		response := getQuery(handler, "/free_busy", values)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %v, but got %d", http.StatusBadRequest, values, response.Code)
+		}
+	}
+}
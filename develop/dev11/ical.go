@@ -0,0 +1,845 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icalProdID — идентификатор продукта в экспортируемых календарях.
+const icalProdID = "-//WBL2//dev11 calendar//RU"
+
+// Форматы дат iCalendar.
+const (
+	icalUTCLayout   = "20060102T150405Z"
+	icalLocalLayout = "20060102T150405"
+	icalDateLayout  = "20060102"
+)
+
+// icalMaxLine — максимальная длина развернутой строки при разборе.
+const icalMaxLine = 1 << 20
+
+// ImportResult описывает итог импорта календаря.
+type ImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	// Skipped — события, выданные этим сервером, но не принадлежащие
+	// пользователю: приглашения и удаленные события.
+	Skipped int `json:"skipped"`
+	// Failed — события, которые хранилище не приняло; остальные события
+	// при этом сохранены.
+	Failed   int             `json:"failed"`
+	Failures []ImportFailure `json:"failures,omitempty"`
+	Events   []Event         `json:"events"`
+}
+
+// ImportFailure описывает событие импорта, которое не удалось сохранить.
+type ImportFailure struct {
+	// Index — номер события в файле, начиная с 1.
+	Index int    `json:"index"`
+	UID   string `json:"uid"`
+	Error string `json:"error"`
+}
+
+// exportUID возвращает UID события для экспорта. События, созданные
+// не через импорт, получают UID вида event-<id>@dev11.
+func exportUID(event Event) string {
+	if event.UID != "" {
+		return event.UID
+	}
+	return fmt.Sprintf("event-%d@dev11", event.ID)
+}
+
+// isServerUID сообщает, выдан ли UID этим сервером при экспорте.
+func isServerUID(uid string) bool {
+	id, ok := strings.CutPrefix(uid, "event-")
+	if !ok {
+		return false
+	}
+	id, ok = strings.CutSuffix(id, "@dev11")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(id)
+	return err == nil && n > 0
+}
+
+// EncodeICal записывает события в формате iCalendar (RFC 5545).
+// now используется как DTSTAMP всех событий.
+func EncodeICal(w io.Writer, events []Event, now time.Time) error {
+	lw := &icalWriter{w: bufio.NewWriter(w)}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + icalProdID)
+	lw.line("CALSCALE:GREGORIAN")
+
+	// Описания часовых поясов, на которые ссылаются события.
+	zones := make(map[string]time.Time)
+	var names []string
+	for _, event := range events {
+		if name := icalZoneName(event.Date.Location()); name != "" && !event.AllDay {
+			if _, ok := zones[name]; !ok {
+				zones[name] = event.Date
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeVTimezone(lw, zones[name])
+	}
+
+	for _, event := range events {
+		lw.line("BEGIN:VEVENT")
+		lw.line("UID:" + escapeICalText(exportUID(event)))
+		lw.line("DTSTAMP:" + now.UTC().Format(icalUTCLayout))
+		if event.AllDay {
+			lw.line("DTSTART;VALUE=DATE:" + event.Date.Format(icalDateLayout))
+			lw.line("DTEND;VALUE=DATE:" + event.End.Format(icalDateLayout))
+		} else {
+			lw.line("DTSTART" + formatICalTime(event.Date))
+			if event.End.After(event.Date) {
+				lw.line("DTEND" + formatICalTime(event.End))
+			}
+		}
+		lw.line("SUMMARY:" + escapeICalText(event.Name))
+		if len(event.Tags) > 0 {
+			lw.line("CATEGORIES:" + strings.Join(event.Tags, ","))
+		}
+		if rule := event.Recurrence; rule != nil {
+			lw.line("RRULE:" + rule.String())
+			for _, ex := range rule.ExDates {
+				if event.AllDay {
+					lw.line("EXDATE;VALUE=DATE:" + ex.Format(icalDateLayout))
+					continue
+				}
+				hour, minute, sec := event.Date.Clock()
+				at := time.Date(ex.Year(), ex.Month(), ex.Day(), hour, minute, sec, 0, event.Date.Location())
+				lw.line("EXDATE" + formatICalTime(at))
+			}
+		}
+		for _, minutes := range event.Reminders {
+			lw.line("BEGIN:VALARM")
+			lw.line("ACTION:DISPLAY")
+			lw.line("DESCRIPTION:" + escapeICalText(event.Name))
+			lw.line(fmt.Sprintf("TRIGGER:-PT%dM", minutes))
+			lw.line("END:VALARM")
+		}
+		lw.line("END:VEVENT")
+	}
+
+	lw.line("END:VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return lw.w.Flush()
+}
+
+// icalWriter пишет строки контента iCalendar, перенося их по 75 октетов.
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (lw *icalWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+	// Строки продолжения начинаются с пробела, который входит в лимит.
+	for limit := 75; len(s) > limit; limit = 74 {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		if _, lw.err = lw.w.WriteString(s[:cut] + "\r\n "); lw.err != nil {
+			return
+		}
+		s = s[cut:]
+	}
+	_, lw.err = lw.w.WriteString(s + "\r\n")
+}
+
+// isRuneStart сообщает, начинается ли с байта b новая руна UTF-8.
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// icalZoneName возвращает TZID для часового пояса или пустую строку, если
+// время следует записывать в UTC.
+func icalZoneName(loc *time.Location) string {
+	name := loc.String()
+	if name == "UTC" || name == "Local" || name == "" {
+		return ""
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// formatICalTime форматирует момент как параметры и значение свойства даты,
+// например ";TZID=Europe/Moscow:20190909T100000" или ":20190909T070000Z".
+func formatICalTime(t time.Time) string {
+	if name := icalZoneName(t.Location()); name != "" {
+		return ";TZID=" + name + ":" + t.Format(icalLocalLayout)
+	}
+	return ":" + t.UTC().Format(icalUTCLayout)
+}
+
+// writeVTimezone записывает VTIMEZONE с правилами перехода, действующими
+// в году момента at.
+func writeVTimezone(lw *icalWriter, at time.Time) {
+	loc := at.Location()
+	lw.line("BEGIN:VTIMEZONE")
+	lw.line("TZID:" + loc.String())
+
+	transitions := zoneTransitions(loc, at.Year())
+	if len(transitions) == 0 {
+		name, offset := time.Date(at.Year(), 1, 1, 0, 0, 0, 0, loc).Zone()
+		lw.line("BEGIN:STANDARD")
+		lw.line("DTSTART:19700101T000000")
+		lw.line("TZOFFSETFROM:" + formatUTCOffset(offset))
+		lw.line("TZOFFSETTO:" + formatUTCOffset(offset))
+		lw.line("TZNAME:" + name)
+		lw.line("END:STANDARD")
+	}
+	for _, tr := range transitions {
+		kind := "STANDARD"
+		if tr.at.In(loc).IsDST() {
+			kind = "DAYLIGHT"
+		}
+		// DTSTART перехода указывается в местном времени до перехода.
+		onset := tr.at.UTC().Add(time.Duration(tr.offsetFrom) * time.Second)
+		name, _ := tr.at.In(loc).Zone()
+		lw.line("BEGIN:" + kind)
+		lw.line("DTSTART:" + onset.Format(icalLocalLayout))
+		lw.line(fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%s", onset.Month(), monthlyByDay(onset)))
+		lw.line("TZOFFSETFROM:" + formatUTCOffset(tr.offsetFrom))
+		lw.line("TZOFFSETTO:" + formatUTCOffset(tr.offsetTo))
+		lw.line("TZNAME:" + name)
+		lw.line("END:" + kind)
+	}
+	lw.line("END:VTIMEZONE")
+}
+
+// zoneTransition — смена смещения часового пояса.
+type zoneTransition struct {
+	at         time.Time
+	offsetFrom int
+	offsetTo   int
+}
+
+// zoneTransitions находит смены смещения часового пояса в течение года.
+func zoneTransitions(loc *time.Location, year int) []zoneTransition {
+	var transitions []zoneTransition
+	t := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	end := t.AddDate(1, 0, 0)
+	_, offset := t.Zone()
+	for t.Before(end) {
+		next := t.Add(24 * time.Hour)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset != offset {
+			// Двоичный поиск момента перехода с точностью до секунды.
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o := mid.In(loc).Zone(); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			transitions = append(transitions, zoneTransition{at: hi.Truncate(time.Second), offsetFrom: offset, offsetTo: nextOffset})
+			offset = nextOffset
+		}
+		t = next
+	}
+	return transitions
+}
+
+// monthlyByDay описывает дату как день недели с порядковым номером в месяце
+// (например, -1SU — последнее воскресенье).
+func monthlyByDay(t time.Time) string {
+	code := ""
+	for c, weekday := range weekdayCodes {
+		if weekday == t.Weekday() {
+			code = c
+		}
+	}
+	if t.Day() > daysIn(t)-7 {
+		return "-1" + code
+	}
+	return strconv.Itoa((t.Day()-1)/7+1) + code
+}
+
+// formatUTCOffset форматирует смещение в секундах как +hhmm.
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+	if offset%60 != 0 {
+		s += fmt.Sprintf("%02d", offset%60)
+	}
+	return s
+}
+
+// parseUTCOffset разбирает смещение вида +hhmm[ss].
+func parseUTCOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+	parts := []string{s[1:3], s[3:5]}
+	if len(s) == 7 {
+		parts = append(parts, s[5:7])
+	}
+	offset := 0
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", s)
+		}
+		offset += n * []int{3600, 60, 1}[i]
+	}
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+// escapeICalText экранирует значение типа TEXT.
+func escapeICalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// unescapeICalText раскрывает экранирование значения типа TEXT.
+func unescapeICalText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// splitICalList разбивает значение-список по запятым, не экранированным
+// обратной косой чертой.
+func splitICalList(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, s[start:])
+}
+
+// icalProperty — строка контента iCalendar.
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICalLine разбирает строку вида NAME;PARAM=VALUE:value.
+func parseICalLine(line string) (icalProperty, error) {
+	var prop icalProperty
+	// Двоеточие внутри кавычек значения параметра не завершает имя.
+	colon, quoted := -1, false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		}
+		if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+	head := line[:colon]
+	prop.value = line[colon+1:]
+	parts := strings.Split(head, ";")
+	prop.name = strings.ToUpper(parts[0])
+	prop.params = make(map[string]string)
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// icalLines читает строки контента, склеивая перенесенные строки.
+func icalLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), icalMaxLine)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// DecodeICal разбирает события VEVENT из календаря iCalendar. Поддерживаются
+// свойства UID, SUMMARY, CATEGORIES, DTSTART, DTEND, DURATION, RRULE и EXDATE. Часовые пояса TZID
+// ищутся в базе IANA; если пояс неизвестен, используется смещение из
+// описания VTIMEZONE.
+func DecodeICal(r io.Reader) ([]Event, error) {
+	lines, err := icalLines(r)
+	if err != nil {
+		return nil, err
+	}
+	props := make([]icalProperty, 0, len(lines))
+	for _, line := range lines {
+		prop, err := parseICalLine(line)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+	if len(props) == 0 || props[0].name != "BEGIN" || !strings.EqualFold(props[0].value, "VCALENDAR") {
+		return nil, errors.New("not an iCalendar object: missing BEGIN:VCALENDAR")
+	}
+
+	zones := fallbackZones(props)
+	var events []Event
+	var stack []string
+	var current []icalProperty
+	for _, prop := range props {
+		switch prop.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(prop.value))
+			if stack[len(stack)-1] == "VEVENT" {
+				current = current[:0]
+			}
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(prop.value) {
+				return nil, fmt.Errorf("unexpected END:%s", prop.value)
+			}
+			if stack[len(stack)-1] == "VEVENT" {
+				event, err := decodeVEvent(current, zones)
+				if err != nil {
+					return nil, err
+				}
+				events = append(events, event)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) > 0 && stack[len(stack)-1] == "VEVENT" {
+				current = append(current, prop)
+			}
+			// TRIGGER не встречается среди свойств VEVENT, поэтому напоминания
+			// вложенных VALARM собираются вместе со свойствами события.
+			if len(stack) > 1 && stack[len(stack)-1] == "VALARM" && stack[len(stack)-2] == "VEVENT" && prop.name == "TRIGGER" {
+				current = append(current, prop)
+			}
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unterminated component %s", stack[len(stack)-1])
+	}
+	return events, nil
+}
+
+// fallbackZones строит часовые поясы с фиксированным смещением по описаниям
+// VTIMEZONE — на случай, если TZID не является именем из базы IANA.
+func fallbackZones(props []icalProperty) map[string]*time.Location {
+	zones := make(map[string]*time.Location)
+	var tzid, section string
+	for _, prop := range props {
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VTIMEZONE"):
+			tzid = ""
+		case prop.name == "BEGIN":
+			section = strings.ToUpper(prop.value)
+		case prop.name == "TZID":
+			tzid = prop.value
+		case prop.name == "TZOFFSETTO" && tzid != "":
+			if _, ok := zones[tzid]; ok && section != "STANDARD" {
+				continue
+			}
+			if offset, err := parseUTCOffset(prop.value); err == nil {
+				zones[tzid] = time.FixedZone(tzid, offset)
+			}
+		}
+	}
+	return zones
+}
+
+// decodeVEvent собирает событие из свойств VEVENT.
+func decodeVEvent(props []icalProperty, zones map[string]*time.Location) (Event, error) {
+	var event Event
+	var exdates []time.Time
+	var rrule string
+	var end time.Time
+	var duration time.Duration
+	hasStart, hasDuration := false, false
+	for _, prop := range props {
+		switch prop.name {
+		case "UID":
+			event.UID = unescapeICalText(prop.value)
+		case "SUMMARY":
+			event.Name = unescapeICalText(prop.value)
+		case "CATEGORIES":
+			// Категории, которые нельзя сохранить как теги, пропускаются.
+			for _, value := range splitICalList(prop.value) {
+				if tag, ok := normalizeTag(unescapeICalText(value)); ok && len(event.Tags) < maxTags {
+					event.Tags = append(event.Tags, tag)
+				}
+			}
+		case "DTSTART":
+			start, err := parseICalTime(prop, zones)
+			if err != nil {
+				return event, err
+			}
+			event.Date, hasStart = start, true
+			event.AllDay = isICalDate(prop)
+			if tzid := prop.params["TZID"]; tzid != "" && !event.AllDay {
+				if _, err := time.LoadLocation(tzid); err == nil {
+					event.TimeZone = tzid
+				}
+			}
+		case "DTEND":
+			var err error
+			if end, err = parseICalTime(prop, zones); err != nil {
+				return event, err
+			}
+		case "DURATION":
+			var err error
+			if duration, err = parseICalDuration(prop.value); err != nil {
+				return event, fmt.Errorf("DURATION: %w", err)
+			}
+			hasDuration = true
+		case "RRULE":
+			rrule = prop.value
+		case "TRIGGER":
+			// Поддерживаются только напоминания до начала события; абсолютные,
+			// отсчитываемые от конца события и сверх лимита пропускаются.
+			if prop.params["VALUE"] != "" || strings.EqualFold(prop.params["RELATED"], "END") || len(event.Reminders) == maxReminders {
+				continue
+			}
+			before, err := parseICalDuration(prop.value)
+			if err != nil {
+				return event, fmt.Errorf("TRIGGER: %w", err)
+			}
+			if minutes := int(-before / time.Minute); before <= 0 && minutes <= maxReminderMinutes {
+				event.Reminders = append(event.Reminders, minutes)
+			}
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				ex, err := parseICalTime(icalProperty{name: prop.name, params: prop.params, value: value}, zones)
+				if err != nil {
+					return event, err
+				}
+				exdates = append(exdates, time.Date(ex.Year(), ex.Month(), ex.Day(), 0, 0, 0, 0, time.UTC))
+			}
+		}
+	}
+	if event.UID == "" {
+		return event, errors.New("VEVENT without UID")
+	}
+	if !hasStart {
+		return event, fmt.Errorf("VEVENT %s without DTSTART", event.UID)
+	}
+	switch {
+	case !end.IsZero():
+		event.End = end.In(event.Date.Location())
+	case hasDuration:
+		event.End = event.Date.Add(duration)
+	case event.AllDay:
+		// Событие на дату без DTEND длится один день (RFC 5545, 3.6.1).
+		event.End = event.Date.AddDate(0, 0, 1)
+	default:
+		event.End = event.Date
+	}
+	if event.End.Before(event.Date) {
+		return event, fmt.Errorf("VEVENT %s ends before it starts", event.UID)
+	}
+	if rrule != "" {
+		rule, err := ParseRRule(rrule)
+		if err != nil {
+			return event, fmt.Errorf("VEVENT %s: %w", event.UID, err)
+		}
+		rule.ExDates = exdates
+		event.Recurrence = rule
+	}
+	return event, nil
+}
+
+// isICalDate сообщает, является ли значение свойства датой без времени.
+func isICalDate(prop icalProperty) bool {
+	return strings.EqualFold(prop.params["VALUE"], "DATE") || len(strings.TrimSpace(prop.value)) == len(icalDateLayout)
+}
+
+// parseICalDuration разбирает длительность вида P1W, P1DT2H30M или PT15M.
+func parseICalDuration(value string) (time.Duration, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	timeUnits := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var total time.Duration
+	n := -1
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			if n < 0 {
+				n = 0
+			}
+			n = n*10 + int(c-'0')
+		case c == 'T':
+			units = timeUnits
+		default:
+			unit, ok := units[c]
+			if !ok || n < 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			total += time.Duration(n) * unit
+			n = -1
+		}
+	}
+	if n >= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * total, nil
+}
+
+// parseICalTime разбирает значение DATE или DATE-TIME с учетом TZID.
+// Время без TZID и без суффикса Z («плавающее») считается временем UTC.
+func parseICalTime(prop icalProperty, zones map[string]*time.Location) (time.Time, error) {
+	value := strings.TrimSpace(prop.value)
+	if isICalDate(prop) {
+		t, err := time.Parse(icalDateLayout, value)
+		if err != nil {
+			return t, fmt.Errorf("%s: invalid date %q", prop.name, value)
+		}
+		return t, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icalUTCLayout, value)
+		if err != nil {
+			return t, fmt.Errorf("%s: invalid time %q", prop.name, value)
+		}
+		return t, nil
+	}
+
+	loc := time.UTC
+	if tzid := prop.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			var ok bool
+			if loc, ok = zones[tzid]; !ok {
+				return time.Time{}, fmt.Errorf("%s: unknown time zone %q", prop.name, tzid)
+			}
+		}
+	}
+	t, err := time.ParseInLocation(icalLocalLayout, value, loc)
+	if err != nil {
+		return t, fmt.Errorf("%s: invalid time %q", prop.name, value)
+	}
+	return t, nil
+}
+
+// ImportEvents сохраняет импортированные события пользователя. Событие,
+// UID которого совпадает с уже существующим (в том числе выданным при
+// экспорте), обновляется поверх прочитанной версии; остальные создаются с
+// новыми ID. События, на которые пользователь приглашен, и прочие UID этого
+// сервера, не принадлежащие пользователю, пропускаются, чтобы повторный
+// импорт собственной выгрузки не создавал копий. Все события проверяются до
+// записи первого из них, и некорректное событие отклоняет весь календарь.
+// Записываются события по одному: если хранилище не приняло событие
+// (например, из-за конфликта версий), остальные все равно сохраняются, а
+// несохраненные перечисляются в Failures.
+func ImportEvents(store Storage, userID int, imported []Event) (ImportResult, error) {
+	existing, err := store.GetUserEvents(userID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	byUID := make(map[string]Event, len(existing))
+	invited := make(map[string]bool)
+	for _, event := range existing {
+		// События, на которые пользователь приглашен, изменяет только организатор.
+		if event.Organizer == userID {
+			byUID[exportUID(event)] = event
+		} else {
+			invited[exportUID(event)] = true
+		}
+	}
+
+	for i := range imported {
+		if err := validateImported(imported[i]); err != nil {
+			return ImportResult{}, &paramError{name: "body", reason: fmt.Sprintf("event %d: %v", i+1, err)}
+		}
+	}
+
+	result := ImportResult{Events: make([]Event, 0, len(imported))}
+	for i, event := range imported {
+		uid := event.UID
+		if current, ok := byUID[event.UID]; ok {
+			// Приглашенные не выгружаются в iCalendar и сохраняются при обновлении.
+			// Версия прочитанного события защищает от одновременного изменения.
+			event.ID, event.UID, event.Attendees = current.ID, current.UID, current.Attendees
+			event.Version = current.Version
+			if event, err = store.UpdateEvent(userID, event); err != nil {
+				result.fail(i, uid, err)
+				continue
+			}
+			byUID[event.UID] = event
+			result.Updated++
+		} else if invited[event.UID] || isServerUID(event.UID) {
+			result.Skipped++
+			continue
+		} else {
+			if event, err = store.CreateEvent(userID, event); err != nil {
+				result.fail(i, uid, err)
+				continue
+			}
+			byUID[event.UID] = event
+			result.Created++
+		}
+		result.Events = append(result.Events, event)
+	}
+	return result, nil
+}
+
+// fail учитывает событие с номером i (с нуля), которое не удалось сохранить.
+// Как и в writeError, текст внутренних ошибок не раскрывается клиенту.
+func (r *ImportResult) fail(i int, uid string, err error) {
+	message := err.Error()
+	var bErr *BusinessError
+	if !errors.As(err, &bErr) {
+		slog.Error("Failed to import event", slog.Int("index", i+1), slog.String("uid", uid), slog.Any("error", err))
+		message = "internal server error"
+	}
+	r.Failed++
+	r.Failures = append(r.Failures, ImportFailure{Index: i + 1, UID: uid, Error: message})
+}
+
+// validateImported проверяет импортированное событие теми же правилами, что
+// и событие, созданное через /create_event.
+func validateImported(event Event) error {
+	if strings.TrimSpace(event.Name) == "" {
+		return errors.New("SUMMARY is required")
+	}
+	if event.Recurrence != nil {
+		if err := event.Recurrence.Validate(); err != nil {
+			return err
+		}
+	}
+	// normalize изменяет событие, поэтому проверяется копия.
+	return event.normalize()
+}
+
+// exportICalHandler обрабатывает GET /export_ics: возвращает события
+// пользователя (или одно событие, если задан event_id) в формате iCalendar.
+func exportICalHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodGet)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, userID, AccessRead); err != nil {
+			writeError(w, err)
+			return
+		}
+		eventID := 0
+		if values.Get("event_id") != "" {
+			if eventID, err = parseIntParam(values, "event_id"); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+
+		events, err := store.GetUserEvents(userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if eventID != 0 {
+			var selected []Event
+			for _, event := range events {
+				if event.ID == eventID {
+					selected = append(selected, event)
+				}
+			}
+			if len(selected) == 0 {
+				writeError(w, ErrEventNotFound)
+				return
+			}
+			events = selected
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="calendar-%d.ics"`, userID))
+		if err := EncodeICal(w, events, time.Now()); err != nil {
+			writeError(w, err)
+		}
+	}
+}
+
+// importICalHandler обрабатывает POST /import_ics?user_id=N: тело запроса —
+// файл .ics, события из которого создаются или обновляются у пользователя.
+func importICalHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, &paramError{name: "method", reason: "must be POST"})
+			return
+		}
+		userID, err := parseIntParam(r.URL.Query(), "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, userID, AccessWrite); err != nil {
+			writeError(w, err)
+			return
+		}
+		events, err := DecodeICal(r.Body)
+		if isBodyTooLarge(err) {
+			writeError(w, err)
+			return
+		}
+		if err != nil {
+			writeError(w, &paramError{name: "body", reason: err.Error()})
+			return
+		}
+
+		result, err := ImportEvents(store, userID, events)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, result)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s is not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestICal_RoundTrip(t *testing.T) {
+	moscow := mustLoadLocation(t, "Europe/Moscow")
+	newYork := mustLoadLocation(t, "America/New_York")
+	rule, _ := ParseRRule("FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6")
+	rule.ExDates = []time.Time{time.Date(2019, 3, 13, 0, 0, 0, 0, time.UTC)}
+
+	events := []Event{
+		{ID: 1, Name: "Standup; daily, short", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, moscow)},
+		{ID: 2, Name: "Sync across the DST change", Date: time.Date(2019, 3, 4, 9, 30, 0, 0, newYork), Recurrence: rule},
+		{ID: 3, Name: "Release", Date: time.Date(2019, 9, 10, 12, 0, 0, 0, time.UTC), UID: "release@example.com", Reminders: []int{0, 90}, Tags: []string{"launch", "q3"}},
+		{ID: 4, Name: strings.Repeat("Очень длинное название ", 10), Date: time.Date(2019, 9, 11, 0, 0, 0, 0, time.UTC)},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeICal(&buf, events, time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("EncodeICal: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Content line is not folded: %q", line)
+		}
+	}
+	for _, want := range []string{"BEGIN:VTIMEZONE", "TZID:America/New_York", "BEGIN:DAYLIGHT", "DTSTART;TZID=Europe/Moscow:20190909T100000", "UID:event-1@dev11", "UID:release@example.com"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Export does not contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	decoded, err := DecodeICal(&buf)
+	if err != nil {
+		t.Fatalf("DecodeICal: %v", err)
+	}
+	if len(decoded) != len(events) {
+		t.Fatalf("Expected %d events, got %d", len(events), len(decoded))
+	}
+	for i, event := range decoded {
+		want := events[i]
+		if event.UID != exportUID(want) || event.Name != want.Name {
+			t.Errorf("Event %d: expected UID %q and name %q, got %q and %q", i, exportUID(want), want.Name, event.UID, event.Name)
+		}
+		if !event.Date.Equal(want.Date) || event.Date.Location().String() != want.Date.Location().String() {
+			t.Errorf("Event %d: expected start %v, got %v", i, want.Date, event.Date)
+		}
+		if fmt.Sprint(event.Reminders) != fmt.Sprint(want.Reminders) {
+			t.Errorf("Event %d: expected reminders %v, got %v", i, want.Reminders, event.Reminders)
+		}
+		if fmt.Sprint(event.Tags) != fmt.Sprint(want.Tags) {
+			t.Errorf("Event %d: expected tags %v, got %v", i, want.Tags, event.Tags)
+		}
+	}
+
+	got := decoded[1].Recurrence
+	if got == nil || got.String() != rule.String() || len(got.ExDates) != 1 || !got.ExDates[0].Equal(rule.ExDates[0]) {
+		t.Errorf("Recurrence was not preserved: %+v", got)
+	}
+	// Повторения после перехода на летнее время остаются в 9:30 по местному времени.
+	for _, occurrence := range occurrences(t, got, decoded[1].Date, decoded[1].Date, decoded[1].Date.AddDate(0, 1, 0)) {
+		if h, m, _ := occurrence.Clock(); h != 9 || m != 30 {
+			t.Errorf("Occurrence %v is not at 9:30 local time", occurrence)
+		}
+	}
+}
+
+func TestDecodeICal_ForeignCalendar(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Example//Desktop//EN",
+		"BEGIN:VTIMEZONE",
+		"TZID:Custom Standard Time",
+		"BEGIN:STANDARD",
+		"DTSTART:16010101T000000",
+		"TZOFFSETFROM:+0500",
+		"TZOFFSETTO:+0500",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:abc-123",
+		"DTSTAMP:20190901T000000Z",
+		`SUMMARY:Planning\, Q4`,
+		"DTSTART;TZID=\"Custom Standard Time\":20190909T100000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:def-456",
+		"SUMMARY:Long",
+		" Summary",
+		"DTSTART;VALUE=DATE:20190910",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := DecodeICal(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeICal: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Name != "Planning, Q4" || !events[0].Date.Equal(time.Date(2019, 9, 9, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected first event: %+v", events[0])
+	}
+	if events[1].Name != "LongSummary" || !events[1].Date.Equal(time.Date(2019, 9, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected second event: %+v", events[1])
+	}
+}
+
+func TestDecodeICal_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"BEGIN:VEVENT\r\nEND:VEVENT",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nEND:VEVENT",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20190909T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nDTSTART;TZID=Nowhere/Unknown:20190909T100000\r\nEND:VEVENT\r\nEND:VCALENDAR",
+	} {
+		if _, err := DecodeICal(strings.NewReader(data)); err == nil {
+			t.Errorf("%q: expected error", data)
+		}
+	}
+}
+
+func TestICalHandlers_ImportExport(t *testing.T) {
+	store := NewEventStore()
+	store.CreateEvent(3, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)})
+
+	response := getQuery(exportICalHandler(store), "/export_ics", url.Values{"user_id": {"3"}})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, response.Code)
+	}
+	if ct := response.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+
+	// Повторный импорт выгрузки обновляет событие, а не создает копию.
+	body := strings.Replace(response.Body.String(), "SUMMARY:Standup", "SUMMARY:Daily standup", 1)
+	body = strings.Replace(body, "END:VCALENDAR", "BEGIN:VEVENT\r\nUID:new@example.com\r\nDTSTART:20190910T100000Z\r\nSUMMARY:Retro\r\nEND:VEVENT\r\nEND:VCALENDAR", 1)
+	request := httptest.NewRequest(http.MethodPost, "/import_ics?user_id=3", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	importICalHandler(store)(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	var result struct {
+		Result ImportResult `json:"result"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Result.Created != 1 || result.Result.Updated != 1 {
+		t.Errorf("Expected 1 created and 1 updated event, got %+v", result.Result)
+	}
+
+	events, _ := store.GetUserEvents(3)
+	if len(events) != 2 || events[0].ID != 1 || events[0].Version != 2 || events[0].Name != "Daily standup" || events[0].UID != "" {
+		t.Fatalf("Unexpected events after import: %+v", events)
+	}
+	if events[1].ID != 2 || events[1].UID != "new@example.com" {
+		t.Errorf("Unexpected imported event: %+v", events[1])
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/import_ics?user_id=3", strings.NewReader("garbage"))
+	recorder = httptest.NewRecorder()
+	importICalHandler(store)(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for malformed calendar, but got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+// racingStore — хранилище, в котором событие изменяется сразу после того,
+// как импорт прочитал календарь.
+type racingStore struct {
+	*EventStore
+}
+
+func (s racingStore) GetUserEvents(userID int) ([]Event, error) {
+	events, err := s.EventStore.GetUserEvents(userID)
+	s.EventStore.UpdateEvent(userID, Event{ID: 1, Name: "Changed", Date: time.Date(2019, 9, 9, 11, 0, 0, 0, time.UTC)})
+	return events, err
+}
+
+func TestImportEvents(t *testing.T) {
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	store := NewEventStore()
+	store.CreateEvent(3, Event{Name: "Standup", Date: date})
+	store.CreateEvent(5, Event{Name: "Review", Date: date, Attendees: []Attendee{{UserID: 3}}})
+	store.CreateEvent(5, Event{Name: "Private", Date: date})
+
+	var exported bytes.Buffer
+	events, _ := store.GetUserEvents(3)
+	if err := EncodeICal(&exported, events, date); err != nil {
+		t.Fatalf("EncodeICal: %v", err)
+	}
+	imported, err := DecodeICal(&exported)
+	if err != nil {
+		t.Fatalf("DecodeICal: %v", err)
+	}
+	// UID чужого события этого сервера тоже не создает копию.
+	imported = append(imported, Event{UID: "event-3@dev11", Name: "Private", Date: date})
+
+	result, err := ImportEvents(store, 3, imported)
+	if err != nil {
+		t.Fatalf("ImportEvents: %v", err)
+	}
+	if result.Created != 0 || result.Updated != 1 || result.Skipped != 2 {
+		t.Errorf("Expected 1 updated and 2 skipped events, got %+v", result)
+	}
+	if events, _ := store.GetUserEvents(3); len(events) != 2 {
+		t.Errorf("Re-import of own export created copies: %+v", events)
+	}
+
+	// Некорректное событие отклоняет весь календарь.
+	_, err = ImportEvents(store, 3, []Event{
+		{UID: "first@example.com", Name: "Retro", Date: date},
+		{UID: "second@example.com", Date: date},
+	})
+	var pErr *paramError
+	if !errors.As(err, &pErr) || !strings.Contains(err.Error(), "event 2: SUMMARY is required") {
+		t.Errorf("Expected error for event without SUMMARY, got %v", err)
+	}
+	if events, _ := store.GetUserEvents(3); len(events) != 2 {
+		t.Errorf("Events before the invalid one were imported: %+v", events)
+	}
+
+	// Изменение события после чтения календаря не перезаписывается импортом.
+	// Остальные события при этом сохраняются.
+	result, err = ImportEvents(racingStore{store}, 3, []Event{
+		{UID: "event-1@dev11", Name: "Imported", Date: date},
+		{UID: "third@example.com", Name: "Planning", Date: date},
+	})
+	if err != nil {
+		t.Fatalf("ImportEvents: %v", err)
+	}
+	if result.Created != 1 || result.Updated != 0 || result.Failed != 1 || len(result.Failures) != 1 ||
+		result.Failures[0].Index != 1 || result.Failures[0].UID != "event-1@dev11" || !strings.HasPrefix(result.Failures[0].Error, ErrVersionConflict.Error()) {
+		t.Errorf("Expected 1 created and 1 failed event, got %+v", result)
+	}
+	events, _ = store.GetUserEvents(3)
+	for _, event := range events {
+		if event.ID == 1 && event.Name != "Changed" {
+			t.Errorf("Concurrent change was overwritten: %+v", event)
+		}
+	}
+}
+
+func TestICal_AllDayAndDuration(t *testing.T) {
+	events := []Event{
+		{ID: 1, Name: "Vacation", AllDay: true, Date: time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC), End: time.Date(2019, 9, 14, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, Name: "Review", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC), End: time.Date(2019, 9, 9, 11, 30, 0, 0, time.UTC)},
+	}
+	var buf bytes.Buffer
+	if err := EncodeICal(&buf, events, time.Now()); err != nil {
+		t.Fatalf("EncodeICal: %v", err)
+	}
+	if !strings.Contains(buf.String(), "DTSTART;VALUE=DATE:20190909\r\nDTEND;VALUE=DATE:20190914") {
+		t.Errorf("All-day event is not exported as dates:\n%s", buf.String())
+	}
+
+	decoded, err := DecodeICal(&buf)
+	if err != nil {
+		t.Fatalf("DecodeICal: %v", err)
+	}
+	for i, event := range decoded {
+		if event.AllDay != events[i].AllDay || !event.Date.Equal(events[i].Date) || !event.End.Equal(events[i].End) {
+			t.Errorf("Event %d: expected %v - %v, got %v - %v", i, events[i].Date, events[i].End, event.Date, event.End)
+		}
+	}
+
+	data := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nDTSTART:20190909T100000Z\r\nDURATION:P1DT2H\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	decoded, err = DecodeICal(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeICal: %v", err)
+	}
+	if got := decoded[0].End.Sub(decoded[0].Date); got != 26*time.Hour {
+		t.Errorf("Expected duration 26h, got %v", got)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucketSweepInterval — как часто удаляются корзины простаивающих клиентов.
+const bucketSweepInterval = time.Minute
+
+// RouteLimits — ограничения запросов к маршруту. Нулевые поля означают
+// значения по умолчанию из LimitsConfig.
+type RouteLimits struct {
+	// RPS — скорость пополнения корзины токенов, запросов в секунду.
+	RPS float64 `json:"rps"`
+	// Burst — емкость корзины: сколько запросов можно сделать подряд.
+	Burst int `json:"burst"`
+	// MaxBodyBytes — наибольший размер тела запроса.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+}
+
+// LimitsConfig описывает ограничения запросов клиентов. Клиент определяется
+// по ID пользователя из bearer токена, а без аутентификации — по IP адресу.
+type LimitsConfig struct {
+	// RouteLimits — ограничения по умолчанию; RPS, равный нулю, отключает
+	// ограничение частоты запросов.
+	RouteLimits
+	// Routes переопределяет ограничения для отдельных маршрутов; у каждого
+	// такого маршрута своя корзина токенов.
+	Routes map[string]RouteLimits `json:"routes"`
+}
+
+// forRoute возвращает ограничения маршрута с подставленными значениями по умолчанию.
+func (cfg LimitsConfig) forRoute(route string) (RouteLimits, bool) {
+	limits, ok := cfg.Routes[route]
+	if limits.RPS == 0 {
+		limits.RPS = cfg.RPS
+	}
+	if limits.Burst == 0 {
+		limits.Burst = cfg.Burst
+	}
+	if limits.MaxBodyBytes == 0 {
+		limits.MaxBodyBytes = cfg.MaxBodyBytes
+	}
+	return limits, ok
+}
+
+// validate проверяет ограничения запросов.
+func (cfg *LimitsConfig) validate() []error {
+	var errs []error
+	check := func(name string, limits RouteLimits) {
+		if limits.RPS < 0 || math.IsInf(limits.RPS, 0) || math.IsNaN(limits.RPS) {
+			errs = append(errs, fmt.Errorf("%s.rps must be a non-negative number", name))
+		}
+		if limits.Burst < 0 {
+			errs = append(errs, fmt.Errorf("%s.burst must not be negative", name))
+		}
+		if limits.MaxBodyBytes < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_body_bytes must not be negative", name))
+		}
+	}
+	check("limits", cfg.RouteLimits)
+	if cfg.RPS > 0 && cfg.Burst < 1 {
+		errs = append(errs, errors.New("limits.burst must be positive when limits.rps is set"))
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("limits.max_body_bytes must be positive"))
+	}
+	for route, limits := range cfg.Routes {
+		if !strings.HasPrefix(route, "/") {
+			errs = append(errs, fmt.Errorf("limits.routes %q: must be a path starting with /", route))
+		}
+		check(fmt.Sprintf("limits.routes[%q]", route), limits)
+	}
+	return errs
+}
+
+// tokenBucket — корзина токенов одного клиента.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketKey определяет корзину: клиент и маршрут с собственными ограничениями
+// (пустой для общей корзины клиента).
+type bucketKey struct {
+	client string
+	route  string
+}
+
+// RateLimiter ограничивает частоту запросов клиентов алгоритмом token bucket.
+type RateLimiter struct {
+	limits LimitsConfig
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter создает RateLimiter с ограничениями limits.
+func NewRateLimiter(limits LimitsConfig) *RateLimiter {
+	return &RateLimiter{limits: limits, now: time.Now, buckets: make(map[bucketKey]*tokenBucket)}
+}
+
+// Allow расходует токен клиента для запроса к маршруту route. Если токенов нет,
+// возвращает false и время, через которое появится следующий.
+func (l *RateLimiter) Allow(client, route string) (bool, time.Duration) {
+	limits, own := l.limits.forRoute(route)
+	if limits.RPS == 0 {
+		return true, 0
+	}
+	key := bucketKey{client: client}
+	if own {
+		key.route = route
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limits.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limits.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*limits.RPS)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / limits.RPS * float64(time.Second))
+	return false, wait
+}
+
+// sweep удаляет корзины, которые успели заполниться: они не отличаются от
+// новых, а без удаления число корзин росло бы с числом клиентов.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		limits, _ := l.limits.forRoute(key.route)
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limits.RPS >= float64(limits.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey определяет клиента запроса: аутентифицированного пользователя
+// или IP адрес.
+func clientKey(r *http.Request) string {
+	if userID, ok := authUserFromContext(r.Context()); ok {
+		return "user:" + strconv.Itoa(userID)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// routeOf возвращает шаблон маршрута mux, обрабатывающего запрос, или
+// unmatchedRoute.
+func routeOf(mux *http.ServeMux, r *http.Request) string {
+	if _, pattern := mux.Handler(r); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
+
+// rateLimitMiddleware отвечает 429 с заголовком Retry-After клиентам,
+// превысившим ограничение частоты запросов. Middleware ставится после
+// authMiddleware, чтобы ограничивать пользователей, а не адреса.
+func rateLimitMiddleware(limiter *RateLimiter, mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := limiter.Allow(clientKey(r), routeOf(mux, r))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: "rate limit exceeded"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimitMiddleware ограничивает размер тела запроса. Запросы с заведомо
+// большим Content-Length отклоняются сразу, остальные читаются через
+// http.MaxBytesReader, и обработчик получает *http.MaxBytesError.
+func bodyLimitMiddleware(limits LimitsConfig, mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, _ := limits.forRoute(routeOf(mux, r))
+			if r.ContentLength > route.MaxBodyBytes {
+				writeError(w, &http.MaxBytesError{Limit: route.MaxBodyBytes})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, route.MaxBodyBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isBodyTooLarge сообщает, что чтение тела запроса прервано ограничением размера.
+func isBodyTooLarge(err error) bool {
+	var mErr *http.MaxBytesError
+	return errors.As(err, &mErr)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(LimitsConfig{
+		RouteLimits: RouteLimits{RPS: 1, Burst: 2},
+		Routes:      map[string]RouteLimits{"/import_ics": {RPS: 0.5}, "/search": {MaxBodyBytes: 10}},
+	})
+	now := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("ip:1", "/events_for_day"); !ok {
+			t.Fatalf("Request %d within burst was rejected", i)
+		}
+	}
+	if ok, wait := limiter.Allow("ip:1", "/events_for_week"); ok || wait != time.Second {
+		t.Errorf("Expected rejection with 1s wait, got %v, %v", ok, wait)
+	}
+	if ok, _ := limiter.Allow("ip:2", "/events_for_day"); !ok {
+		t.Error("Another client shares the bucket")
+	}
+
+	// Маршрут с собственными ограничениями расходует свою корзину.
+	for i := 0; i < 2; i++ {
+		limiter.Allow("ip:1", "/import_ics")
+	}
+	if ok, wait := limiter.Allow("ip:1", "/import_ics"); ok || wait != 2*time.Second {
+		t.Errorf("Expected route limit with 2s wait, got %v, %v", ok, wait)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, wait := limiter.Allow("ip:1", "/events_for_day"); ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected rejection with 500ms wait, got %v, %v", ok, wait)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := limiter.Allow("ip:1", "/events_for_day"); !ok {
+		t.Error("Token was not refilled")
+	}
+
+	now = now.Add(bucketSweepInterval)
+	limiter.Allow("ip:3", "/events_for_day")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be swept, got %d buckets", len(limiter.buckets))
+	}
+
+	unlimited := NewRateLimiter(LimitsConfig{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := unlimited.Allow("ip:1", "/"); !ok {
+			t.Fatal("Zero rps should disable rate limiting")
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events_for_day", func(w http.ResponseWriter, r *http.Request) {})
+	handler := chain(mux, rateLimitMiddleware(NewRateLimiter(LimitsConfig{RouteLimits: RouteLimits{RPS: 0.1, Burst: 1}}), mux))
+
+	request := func(userID int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/events_for_day", nil)
+		if userID != 0 {
+			r = r.WithContext(context.WithValue(r.Context(), authUserKey{}, userID))
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, r)
+		return response
+	}
+
+	if response := request(0); response.Code != http.StatusOK {
+		t.Fatalf("First request was rejected: %d", response.Code)
+	}
+	response := request(0)
+	if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected 429 with Retry-After 10, got %d %v", response.Code, response.Header())
+	}
+	if body := strings.TrimSpace(response.Body.String()); body != `{"error":"rate limit exceeded"}` {
+		t.Errorf("Unexpected 429 body: %s", body)
+	}
+	// Аутентифицированный пользователь ограничивается отдельно от своего адреса.
+	if response := request(1); response.Code != http.StatusOK {
+		t.Errorf("Expected separate bucket for user, got %d", response.Code)
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	store := NewEventStore()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/create_event", createEventFormHandler(store))
+	mux.HandleFunc("/events/create", createEventHandler(store))
+	mux.HandleFunc("/import_ics", importICalHandler(store))
+	limits := LimitsConfig{
+		RouteLimits: RouteLimits{MaxBodyBytes: 64},
+		Routes:      map[string]RouteLimits{"/import_ics": {MaxBodyBytes: 1 << 10}},
+	}
+	handler := chain(mux, bodyLimitMiddleware(limits, mux))
+
+	post := func(path, contentType, body string, chunked bool) *httptest.ResponseRecorder {
+		var reader io.Reader = strings.NewReader(body)
+		if chunked {
+			// Без Content-Length размер тела становится известен только при чтении.
+			reader = io.MultiReader(reader)
+		}
+		r := httptest.NewRequest(http.MethodPost, path, reader)
+		r.Header.Set("Content-Type", contentType)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, r)
+		return response
+	}
+
+	form := "user_id=1&date=2019-09-09&name=" + strings.Repeat("x", 100)
+	for _, chunked := range []bool{false, true} {
+		response := post("/create_event", "application/x-www-form-urlencoded", form, chunked)
+		if response.Code != http.StatusRequestEntityTooLarge || !strings.Contains(response.Body.String(), `"error":"request body exceeds 64 bytes"`) {
+			t.Errorf("chunked=%v: expected 413 with JSON error, got %d %s", chunked, response.Code, response.Body)
+		}
+	}
+	if response := post("/events/create", "application/json", `{"userId": 1, "event": {"name": "`+strings.Repeat("x", 100)+`"}}`, true); response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for legacy JSON handler, got %d %s", response.Code, response.Body)
+	}
+	if response := post("/create_event", "application/x-www-form-urlencoded", "user_id=1&date=2019-09-09&name=x", false); response.Code != http.StatusOK {
+		t.Errorf("Small body was rejected: %d %s", response.Code, response.Body)
+	}
+
+	calendar := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a@example.com\r\nDTSTART:20190909T100000Z\r\nSUMMARY:" + strings.Repeat("x", 200) + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	if response := post("/import_ics?user_id=1", "text/calendar", calendar, true); response.Code != http.StatusOK {
+		t.Errorf("Route limit was not applied to import: %d %s", response.Code, response.Body)
+	}
+	if response := post("/import_ics?user_id=1", "text/calendar", strings.Repeat(calendar, 10), true); response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for large import, got %d %s", response.Code, response.Body)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets — верхние границы корзин гистограммы длительности запросов, в секундах.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unmatchedRoute — метка маршрута для запросов, не попавших ни в один обработчик.
+const unmatchedRoute = "unmatched"
+
+// requestLabels — метки счетчика запросов.
+type requestLabels struct {
+	route  string
+	method string
+	code   int
+}
+
+// histogram — гистограмма в формате Prometheus: counts[i] — число наблюдений
+// не больше latencyBuckets[i] без учета меньших корзин.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// observe добавляет наблюдение.
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(latencyBuckets, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Metrics собирает метрики HTTP сервера и хранилища и отдает их в
+// текстовом формате Prometheus.
+type Metrics struct {
+	store    Storage
+	inFlight atomic.Int64
+
+	mu        sync.Mutex
+	requests  map[requestLabels]uint64
+	latencies map[string]*histogram
+}
+
+// NewMetrics создает сборщик метрик; размеры хранилища читаются из store
+// при каждом запросе /metrics.
+func NewMetrics(store Storage) *Metrics {
+	return &Metrics{
+		store:     store,
+		requests:  make(map[requestLabels]uint64),
+		latencies: make(map[string]*histogram),
+	}
+}
+
+// observe учитывает обработанный запрос.
+func (m *Metrics) observe(route, method string, code int, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{route: route, method: method, code: code}]++
+	h, ok := m.latencies[route]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latencies[route] = h
+	}
+	h.observe(latency.Seconds())
+}
+
+// middleware учитывает каждый запрос к mux. Маршрут определяется по шаблону
+// обработчика в mux, чтобы число меток не зависело от присланных путей.
+func (m *Metrics) middleware(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			m.inFlight.Add(1)
+			defer m.inFlight.Add(-1)
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			m.observe(routeOf(mux, r), metricMethod(r.Method), rec.status, time.Since(start))
+		})
+	}
+}
+
+// metricMethod ограничивает метку метода стандартными методами HTTP.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// WriteTo записывает метрики в текстовом формате Prometheus.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	m.mu.Lock()
+	labels := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	fmt.Fprintln(cw, "# HELP calendar_http_requests_total Number of handled HTTP requests.")
+	fmt.Fprintln(cw, "# TYPE calendar_http_requests_total counter")
+	for _, l := range labels {
+		fmt.Fprintf(cw, "calendar_http_requests_total{route=%s,method=%s,code=\"%d\"} %d\n",
+			quoteLabel(l.route), quoteLabel(l.method), l.code, m.requests[l])
+	}
+
+	routes := make([]string, 0, len(m.latencies))
+	for route := range m.latencies {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	fmt.Fprintln(cw, "# HELP calendar_http_request_duration_seconds HTTP request latency.")
+	fmt.Fprintln(cw, "# TYPE calendar_http_request_duration_seconds histogram")
+	for _, route := range routes {
+		h := m.latencies[route]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(cw, "calendar_http_request_duration_seconds_bucket{route=%s,le=\"%s\"} %d\n",
+				quoteLabel(route), strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(cw, "calendar_http_request_duration_seconds_bucket{route=%s,le=\"+Inf\"} %d\n", quoteLabel(route), h.count)
+		fmt.Fprintf(cw, "calendar_http_request_duration_seconds_sum{route=%s} %s\n", quoteLabel(route), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(cw, "calendar_http_request_duration_seconds_count{route=%s} %d\n", quoteLabel(route), h.count)
+	}
+	m.mu.Unlock()
+
+	fmt.Fprintln(cw, "# HELP calendar_http_requests_in_flight Number of HTTP requests being handled.")
+	fmt.Fprintln(cw, "# TYPE calendar_http_requests_in_flight gauge")
+	fmt.Fprintf(cw, "calendar_http_requests_in_flight %d\n", m.inFlight.Load())
+
+	stats := m.store.Stats()
+	gauges := []struct {
+		name, help string
+		value      int
+	}{
+		{"calendar_store_users", "Number of registered users.", stats.Users},
+		{"calendar_store_events", "Number of stored events (recurring events count once).", stats.Events},
+		{"calendar_store_shares", "Number of calendar shares.", stats.Shares},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.value)
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// quoteLabel экранирует значение метки по правилам текстового формата Prometheus.
+func quoteLabel(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// countingWriter считает записанные байты и запоминает первую ошибку.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// metricsHandler обрабатывает GET /metrics.
+func metricsHandler(m *Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !methodAllowed(r, http.MethodGet) {
+			writeError(w, &paramError{name: "method", reason: "must be GET"})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteTo(w)
+	}
+}
+
+// Health хранит состояние готовности сервера принимать запросы.
+type Health struct {
+	ready atomic.Bool
+}
+
+// SetReady отмечает сервер готовым или неготовым к приему запросов.
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// healthzHandler обрабатывает GET /healthz: процесс жив и обслуживает запросы.
+func healthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, "ok")
+	}
+}
+
+// readyzHandler обрабатывает GET /readyz: 200, пока сервер принимает запросы,
+// и 503 после начала остановки, чтобы балансировщик перестал направлять трафик.
+func readyzHandler(h *Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.ready.Load() {
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "not ready"})
+			return
+		}
+		writeResult(w, "ready")
+	}
+}
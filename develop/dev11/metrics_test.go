@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	store := NewEventStore()
+	store.CreateEvent(1, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)})
+	store.ShareCalendar(1, 2, AccessRead)
+
+	metrics := NewMetrics(store)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events_for_day", eventsForPeriodHandler(store, dayPeriod))
+	mux.HandleFunc("/metrics", metricsHandler(metrics))
+	handler := chain(mux, metrics.middleware(mux))
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/events_for_day?user_id=1&date=2019-09-09", nil),
+		httptest.NewRequest(http.MethodGet, "/events_for_day?user_id=x", nil),
+		httptest.NewRequest(http.MethodGet, "/missing/1", nil),
+		httptest.NewRequest("BREW", "/missing/2", nil),
+	}
+	for _, request := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if response.Code != http.StatusOK || !strings.HasPrefix(response.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Unexpected /metrics response: %d %v", response.Code, response.Header())
+	}
+	body := response.Body.String()
+	for _, want := range []string{
+		`calendar_http_requests_total{route="/events_for_day",method="GET",code="200"} 1`,
+		`calendar_http_requests_total{route="/events_for_day",method="GET",code="400"} 1`,
+		`calendar_http_requests_total{route="unmatched",method="GET",code="404"} 1`,
+		`calendar_http_requests_total{route="unmatched",method="OTHER",code="404"} 1`,
+		`calendar_http_request_duration_seconds_bucket{route="/events_for_day",le="+Inf"} 2`,
+		`calendar_http_request_duration_seconds_count{route="unmatched"} 2`,
+		"# TYPE calendar_http_request_duration_seconds histogram",
+		"calendar_http_requests_in_flight 1",
+		"calendar_store_users 1",
+		"calendar_store_events 1",
+		"calendar_store_shares 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics do not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestHistogram_Buckets(t *testing.T) {
+	h := &histogram{counts: make([]uint64, len(latencyBuckets))}
+	for _, v := range []float64{0.001, 0.005, 0.3, 60} {
+		h.observe(v)
+	}
+	if h.counts[0] != 2 || h.counts[6] != 1 || h.count != 4 {
+		t.Errorf("Unexpected histogram: %+v", h)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	auth := NewAuthenticator(testSecret, time.Hour)
+	health := &Health{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler())
+	mux.HandleFunc("/readyz", readyzHandler(health))
+	handler := chain(mux, authMiddleware(auth, "/healthz", "/readyz"))
+
+	get := func(path string) int {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		return response.Code
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz without token to return %d, got %d", http.StatusOK, code)
+	}
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz before start to return %d, got %d", http.StatusServiceUnavailable, code)
+	}
+	health.SetReady(true)
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected /readyz to return %d, got %d", http.StatusOK, code)
+	}
+	if code := get("/readyz/"); code != http.StatusUnauthorized {
+		t.Errorf("Expected only exact public paths to skip auth, got %d", code)
+	}
+}
+
+func TestShutdown_DrainsRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})}
+	go server.Serve(listener)
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		results <- result{string(body), err}
+	}()
+	<-started
+
+	health := &Health{}
+	health.SetReady(true)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	stopped := make(chan struct{})
+	go func() {
+		shutdown(server, health, 0, time.Minute, logger)
+		close(stopped)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if health.ready.Load() {
+		t.Error("Server is still ready after shutdown started")
+	}
+	select {
+	case <-stopped:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	default:
+	}
+	close(release)
+	if res := <-results; res.err != nil || res.body != "done" {
+		t.Errorf("In-flight request was dropped: %q, %v", res.body, res.err)
+	}
+	<-stopped
+
+	if _, err := http.Get("http://" + listener.Addr().String()); err == nil {
+		t.Error("Expected connection error after shutdown")
+	}
+}
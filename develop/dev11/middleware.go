@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader — заголовок с идентификатором запроса.
+const requestIDHeader = "X-Request-ID"
+
+// Middleware оборачивает обработчик дополнительной логикой.
+type Middleware func(http.Handler) http.Handler
+
+// chain оборачивает обработчик в middleware. Первая middleware в списке
+// оказывается внешней, т.е. первой получает запрос.
+func chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// requestIDKey — ключ идентификатора запроса в контексте.
+type requestIDKey struct{}
+
+// requestIDFromContext возвращает идентификатор запроса из контекста.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID генерирует случайный идентификатор запроса.
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestIDMiddleware присваивает запросу идентификатор: берет его из заголовка
+// X-Request-ID или генерирует новый. Идентификатор кладется в контекст запроса
+// и возвращается клиенту в заголовке ответа.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// responseRecorder запоминает код ответа, число записанных байт и
+// внутреннюю ошибку, которую обработчик не показал клиенту.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	err    error
+}
+
+// WriteHeader запоминает код ответа.
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write считает записанные байты.
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Flush пробрасывает сброс буфера, если его поддерживает исходный writer.
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap возвращает исходный writer для http.ResponseController.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// recordError передает внутреннюю ошибку обработчика в лог запроса: она
+// запоминается во всех responseRecorder, которыми обернут w, и loggingMiddleware
+// выводит ее вместе с request_id. Если w не обернут, ошибка пишется в логгер
+// по умолчанию.
+func recordError(w http.ResponseWriter, err error) {
+	recorded := false
+	for w != nil {
+		if rec, ok := w.(*responseRecorder); ok {
+			rec.err = err
+			recorded = true
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = unwrapper.Unwrap()
+	}
+	if !recorded {
+		slog.Error("Internal error", slog.Any("error", err))
+	}
+}
+
+// loggingMiddleware пишет в лог каждый обработанный запрос.
+func loggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+			if rec.status >= http.StatusInternalServerError || rec.err != nil {
+				level = slog.LevelError
+			}
+			attrs := []slog.Attr{
+				slog.String("request_id", requestIDFromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Int("bytes", rec.bytes),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			}
+			if rec.err != nil {
+				attrs = append(attrs, slog.String("error", rec.err.Error()))
+			}
+			logger.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
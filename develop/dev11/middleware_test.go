@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := chain(http.NotFoundHandler(), mark("first"), mark("second"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("Unexpected middleware order: %v", order)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}), requestIDMiddleware, loggingMiddleware(logger))
+
+	request := httptest.NewRequest(http.MethodGet, "/events_for_day?user_id=1", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	requestID := response.Header().Get(requestIDHeader)
+	if len(requestID) != 32 {
+		t.Errorf("Expected generated request ID, got %q", requestID)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Access log is not JSON: %v: %s", err, buf.String())
+	}
+	want := map[string]interface{}{
+		"request_id":  requestID,
+		"method":      "GET",
+		"path":        "/events_for_day",
+		"status":      float64(http.StatusTeapot),
+		"bytes":       float64(len("short and stout")),
+		"remote_addr": "10.0.0.1:1234",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("Expected %s=%v in access log, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Errorf("Access log has no latency")
+	}
+}
+
+func TestRequestIDMiddleware_KeepsIncomingID(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(requestIDHeader, "abc-123")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if seen != "abc-123" || response.Header().Get(requestIDHeader) != "abc-123" {
+		t.Errorf("Incoming request ID was not propagated: context %q, header %q", seen, response.Header().Get(requestIDHeader))
+	}
+}
+
+func TestLoggingMiddleware_InternalError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	mux := http.NewServeMux()
+	// Ошибка проходит через вложенный recorder метрик до лога запроса.
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, errors.New("disk on fire"))
+	}), requestIDMiddleware, loggingMiddleware(logger), NewMetrics(NewEventStore()).middleware(mux))
+
+	request := httptest.NewRequest(http.MethodGet, "/events_for_day", nil)
+	request.Header.Set(requestIDHeader, "abc-123")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if body := strings.TrimSpace(response.Body.String()); body != `{"error":"internal server error"}` {
+		t.Errorf("Internal error leaked to the client: %s", body)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Access log is not a single JSON entry: %v: %s", err, buf.String())
+	}
+	if entry["level"] != "ERROR" || entry["request_id"] != "abc-123" || entry["error"] != "disk on fire" {
+		t.Errorf("Internal error is not logged with the request: %v", entry)
+	}
+}
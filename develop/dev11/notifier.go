@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Способы доставки напоминаний.
+const (
+	notifierNone    = "none"
+	notifierLog     = "log"
+	notifierWebhook = "webhook"
+	notifierEmail   = "email"
+)
+
+// Notifier доставляет напоминание пользователю. Реализации должны соблюдать
+// отмену ctx и быть безопасны для одновременного использования.
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// LogNotifier записывает напоминания в лог.
+type LogNotifier struct {
+	Logger *slog.Logger
+}
+
+// Notify записывает напоминание в лог.
+func (n *LogNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	n.Logger.InfoContext(ctx, "Reminder",
+		"user_id", reminder.UserID,
+		"event_id", reminder.EventID,
+		"event", reminder.EventName,
+		"start", reminder.Start,
+		"minutes_before", reminder.MinutesBefore,
+	)
+	return nil
+}
+
+// WebhookNotifier отправляет напоминание POST запросом с JSON телом
+// на заданный URL. Ответ с кодом вне диапазона 2xx считается ошибкой.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify отправляет напоминание на URL вебхука.
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return fmt.Errorf("encode reminder: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// EmailNotifier отправляет напоминание письмом через SMTP сервер без
+// аутентификации (например, локальный ретранслятор). To — шаблон адреса
+// получателя, в котором %d заменяется ID пользователя.
+type EmailNotifier struct {
+	Addr string
+	From string
+	To   string
+}
+
+// Notify отправляет письмо с напоминанием.
+func (n *EmailNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	to := fmt.Sprintf(n.To, reminder.UserID)
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(reminderMessage(n.From, to, reminder)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// reminderMessage формирует письмо с напоминанием в формате RFC 5322.
+func reminderMessage(from, to string, reminder Reminder) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Напоминание: "+reminder.EventName))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	fmt.Fprintf(&b, "Событие %q начнется %s.\r\n", reminder.EventName, reminder.Start.Format("2006-01-02 15:04 MST"))
+	return []byte(b.String())
+}
+
+// newNotifier создает способ доставки напоминаний согласно настройкам.
+// Для notifier "none" возвращается nil: напоминания не отправляются.
+func newNotifier(cfg ReminderConfig, logger *slog.Logger) Notifier {
+	switch cfg.Notifier {
+	case notifierLog:
+		return &LogNotifier{Logger: logger}
+	case notifierWebhook:
+		return &WebhookNotifier{URL: cfg.WebhookURL, Client: &http.Client{}}
+	case notifierEmail:
+		return &EmailNotifier{Addr: cfg.SMTPAddr, From: cfg.MailFrom, To: cfg.MailTo}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testReminder = Reminder{
+	UserID:        7,
+	EventID:       3,
+	EventName:     "Планерка",
+	Start:         time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC),
+	MinutesBefore: 10,
+	FireAt:        time.Date(2019, 9, 9, 9, 50, 0, 0, time.UTC),
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Reminder
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{URL: server.URL}
+	if err := notifier.Notify(context.Background(), testReminder); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if received.EventID != 3 || received.EventName != "Планерка" || !received.Start.Equal(testReminder.Start) {
+		t.Errorf("Unexpected webhook payload: %+v", received)
+	}
+
+	status = http.StatusBadGateway
+	if err := notifier.Notify(context.Background(), testReminder); err == nil {
+		t.Error("Expected error for non-2xx response")
+	}
+}
+
+// serveSMTP принимает одно SMTP соединение и возвращает конверт и текст письма.
+func serveSMTP(listener net.Listener) <-chan []string {
+	result := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			result <- nil
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		var lines []string
+		reply("220 localhost ESMTP")
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if inData {
+				if line == "." {
+					inData = false
+					reply("250 OK")
+					continue
+				}
+				lines = append(lines, line)
+				continue
+			}
+			switch command := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); command {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				lines = append(lines, line)
+				reply("250 OK")
+			case "DATA":
+				inData = true
+				reply("354 go ahead")
+			case "QUIT":
+				reply("221 bye")
+				result <- lines
+				return
+			default:
+				reply("502 unknown command")
+			}
+		}
+		result <- lines
+	}()
+	return result
+}
+
+func TestEmailNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	session := serveSMTP(listener)
+
+	notifier := &EmailNotifier{Addr: listener.Addr().String(), From: "calendar@localhost", To: "user%d@localhost"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, testReminder); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	transcript := strings.Join(<-session, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<calendar@localhost>",
+		"RCPT TO:<user7@localhost>",
+		"To: user7@localhost",
+		"Subject: =?utf-8?q?",
+		"2019-09-09 10:00 UTC",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("SMTP transcript does not contain %q:\n%s", want, transcript)
+		}
+	}
+}
+
+func TestEmailNotifier_Unavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	notifier := &EmailNotifier{Addr: addr, From: "calendar@localhost", To: "user%d@localhost"}
+	if err := notifier.Notify(context.Background(), testReminder); err == nil {
+		t.Error("Expected error when SMTP server is unavailable")
+	}
+}
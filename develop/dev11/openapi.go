@@ -0,0 +1,593 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// openAPIVersion — версия спецификации OpenAPI, которой соответствует /openapi.json.
+const openAPIVersion = "3.0.3"
+
+// Форматы строковых параметров запросов.
+const (
+	formatDate     = "date"      // YYYY-MM-DD
+	formatClock    = "clock"     // HH:MM
+	formatDuration = "duration"  // длительность Go: 30m, 1h30m
+	formatTimeZone = "time-zone" // часовой пояс IANA
+	formatTag      = "tag"       // тег события
+)
+
+// Расположение параметров запроса.
+const (
+	inQuery  = "query"
+	inForm   = "form"
+	inHeader = "header"
+)
+
+// jsonObject — объект JSON документа спецификации.
+type jsonObject = map[string]interface{}
+
+// paramSchema описывает допустимые значения параметра запроса. По схеме
+// строится описание параметра в спецификации и проверяются запросы.
+type paramSchema struct {
+	// Type — integer, string, boolean или array. Элементы array передаются
+	// через запятую.
+	Type string
+	// Format — формат строки, см. formatDate и соседние константы.
+	Format  string
+	Minimum *int
+	Maximum *int
+	Enum    []string
+	// Items — схема элементов array.
+	Items    *paramSchema
+	MaxItems int
+	// Reason — сообщение об ошибке для недопустимого значения; по умолчанию
+	// строится по типу и формату.
+	Reason string
+}
+
+// param описывает параметр запроса.
+type param struct {
+	Name string
+	// In — расположение параметра; пустое значение означает query для GET
+	// и тело формы для POST.
+	In          string
+	Required    bool
+	Description string
+	Schema      paramSchema
+}
+
+// content описывает тело запроса или ответа.
+type content struct {
+	Status    int
+	MediaType string
+	// Schema — значение, по типу которого строится схема тела; nil означает
+	// произвольный объект JSON или строку для остальных типов содержимого.
+	Schema interface{}
+	// Envelope — значение обернуто в {"result": ...}.
+	Envelope bool
+}
+
+// route описывает метод API: по нему регистрируется обработчик, проверяются
+// параметры запросов и строится спецификация OpenAPI.
+type route struct {
+	Path    string
+	Method  string
+	Summary string
+	// Public — метод доступен без bearer токена.
+	Public bool
+	Params []param
+	// Body — тело запроса, если параметры передаются не формой.
+	Body     *content
+	Response content
+	Handler  http.Handler
+}
+
+// intPtr возвращает указатель на n для границ paramSchema.
+func intPtr(n int) *int {
+	return &n
+}
+
+// result описывает успешный ответ {"result": v}.
+func result(v interface{}) content {
+	return content{Status: http.StatusOK, MediaType: "application/json", Schema: v, Envelope: true}
+}
+
+// in возвращает расположение параметра p в запросах к маршруту.
+func (rt route) in(p param) string {
+	if p.In != "" {
+		return p.In
+	}
+	if rt.Method == http.MethodGet {
+		return inQuery
+	}
+	return inForm
+}
+
+// validate проверяет метод и параметры запроса по описанию маршрута.
+func (rt route) validate(r *http.Request) error {
+	if !methodAllowed(r, rt.Method) {
+		return &paramError{name: "method", reason: "must be " + rt.Method}
+	}
+	query := r.URL.Query()
+	var form url.Values
+	for _, p := range rt.Params {
+		var raw string
+		switch rt.in(p) {
+		case inQuery:
+			raw = query.Get(p.Name)
+		case inHeader:
+			raw = r.Header.Get(p.Name)
+		case inForm:
+			if form == nil {
+				var err error
+				if form, err = parseForm(r, rt.Method); err != nil {
+					return err
+				}
+			}
+			raw = form.Get(p.Name)
+		}
+		if raw == "" {
+			if p.Required {
+				return &paramError{name: p.Name, reason: "is required"}
+			}
+			continue
+		}
+		if reason := p.Schema.check(p.Name, raw); reason != "" {
+			return &paramError{name: p.Name, reason: reason}
+		}
+	}
+	return nil
+}
+
+// handler возвращает обработчик маршрута, который отвечает 400 на запросы,
+// не прошедшие проверку.
+func (rt route) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := rt.validate(r); err != nil {
+			writeError(w, err)
+			return
+		}
+		rt.Handler.ServeHTTP(w, r)
+	})
+}
+
+// check проверяет значение raw параметра name и возвращает причину ошибки
+// или пустую строку.
+func (s paramSchema) check(name, raw string) string {
+	if s.Type == "array" {
+		items := strings.Split(raw, ",")
+		for _, item := range items {
+			item = strings.TrimSpace(item)
+			if reason := s.Items.check(name, item); reason != "" {
+				return s.reason(fmt.Sprintf("item %q %s", item, reason))
+			}
+		}
+		if s.MaxItems > 0 && len(items) > s.MaxItems {
+			return fmt.Sprintf("at most %d %s are allowed", s.MaxItems, name)
+		}
+		return ""
+	}
+
+	switch s.Type {
+	case "integer":
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return s.reason("must be an integer")
+		}
+		switch {
+		case s.Minimum != nil && s.Maximum != nil && (n < *s.Minimum || n > *s.Maximum):
+			return s.reason(fmt.Sprintf("must be an integer from %d to %d", *s.Minimum, *s.Maximum))
+		case s.Minimum != nil && n < *s.Minimum && *s.Minimum == 1:
+			return s.reason("must be positive")
+		case s.Minimum != nil && n < *s.Minimum:
+			return s.reason(fmt.Sprintf("must be at least %d", *s.Minimum))
+		case s.Maximum != nil && n > *s.Maximum:
+			return s.reason(fmt.Sprintf("must be at most %d", *s.Maximum))
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return s.reason("must be true or false")
+		}
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, raw) {
+		return s.reason("must be " + alternatives(s.Enum))
+	}
+
+	switch s.Format {
+	case formatDate:
+		if _, err := time.Parse(dateLayout, raw); err != nil {
+			return s.reason("must be a date in YYYY-MM-DD format")
+		}
+	case formatClock:
+		if _, err := time.Parse(clockLayout, raw); err != nil {
+			return s.reason("must be a time in HH:MM format")
+		}
+	case formatDuration:
+		if d, err := time.ParseDuration(raw); err != nil || d < 0 {
+			return s.reason("must be a non-negative duration like 30m or 1h30m")
+		}
+	case formatTimeZone:
+		if _, err := time.LoadLocation(raw); err != nil || raw == "Local" {
+			return s.reason("must be an IANA time zone name")
+		}
+	case formatTag:
+		if _, ok := normalizeTag(raw); !ok {
+			return s.reason(fmt.Sprintf("must be a tag of 1 to %d letters, digits, '-' or '_'", maxTagLength))
+		}
+	}
+	return ""
+}
+
+// reason возвращает Reason схемы или сообщение по умолчанию.
+func (s paramSchema) reason(fallback string) string {
+	if s.Reason != "" {
+		return s.Reason
+	}
+	return fallback
+}
+
+// contains сообщает, есть ли s среди values.
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// alternatives перечисляет допустимые значения: "a, b or c".
+func alternatives(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
+
+// example возвращает пример допустимого значения параметра.
+func (s paramSchema) example() string {
+	switch {
+	case s.Type == "array":
+		return s.Items.example()
+	case len(s.Enum) > 0:
+		return s.Enum[0]
+	case s.Type == "integer" && s.Minimum != nil:
+		return strconv.Itoa(*s.Minimum)
+	case s.Type == "integer":
+		return "1"
+	case s.Type == "boolean":
+		return "false"
+	}
+	switch s.Format {
+	case formatDate:
+		return "2019-09-09"
+	case formatClock:
+		return "10:00"
+	case formatDuration:
+		return "1h30m"
+	case formatTimeZone:
+		return "Europe/Moscow"
+	case formatTag:
+		return "work"
+	}
+	return "example"
+}
+
+// spec возвращает схему параметра в формате OpenAPI.
+func (s paramSchema) spec() jsonObject {
+	out := jsonObject{"type": s.Type}
+	switch s.Format {
+	case formatClock:
+		out["pattern"] = `^\d{1,2}:\d{2}$`
+	case formatTag:
+		out["pattern"] = `^[\p{L}\p{N}_-]+$`
+		out["maxLength"] = maxTagLength
+	case "":
+	default:
+		out["format"] = s.Format
+	}
+	if s.Minimum != nil {
+		out["minimum"] = *s.Minimum
+	}
+	if s.Maximum != nil {
+		out["maximum"] = *s.Maximum
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Items != nil {
+		out["items"] = s.Items.spec()
+	}
+	if s.MaxItems > 0 {
+		out["maxItems"] = s.MaxItems
+	}
+	switch s.Type {
+	case "array":
+	case "integer":
+		out["example"], _ = strconv.Atoi(s.example())
+	default:
+		out["example"] = s.example()
+	}
+	return out
+}
+
+// schemaBuilder строит схемы JSON по типам Go с учетом тегов json.
+// Именованные структуры попадают в components/schemas.
+type schemaBuilder struct {
+	schemas jsonObject
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema возвращает схему значений типа t.
+func (b *schemaBuilder) schema(t reflect.Type) jsonObject {
+	if t == timeType {
+		return jsonObject{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return jsonObject{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return jsonObject{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return jsonObject{"type": "number"}
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return jsonObject{"type": "string", "format": "byte"}
+		}
+		return jsonObject{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return jsonObject{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := exportedName(t.Name())
+		if _, ok := b.schemas[name]; !ok {
+			// Заглушка прерывает рекурсию для типов, ссылающихся на себя.
+			b.schemas[name] = jsonObject{}
+			b.schemas[name] = b.structSchema(t)
+		}
+		return jsonObject{"$ref": "#/components/schemas/" + name}
+	default:
+		return jsonObject{}
+	}
+}
+
+// structSchema возвращает схему объекта с полями структуры t. Поля без
+// omitempty обязательны; поля встроенных структур поднимаются на уровень
+// объекта, как при сериализации encoding/json.
+func (b *schemaBuilder) structSchema(t reflect.Type) jsonObject {
+	properties := jsonObject{}
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = b.schema(field.Type)
+			if !strings.Contains(","+options+",", ",omitempty,") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	out := jsonObject{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// exportedName делает первую букву имени типа заглавной.
+func exportedName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// content возвращает описание тела запроса или ответа в формате OpenAPI.
+func (b *schemaBuilder) content(c content) jsonObject {
+	var schema jsonObject
+	switch {
+	case c.Schema != nil:
+		schema = b.schema(reflect.TypeOf(c.Schema))
+	case c.MediaType == "application/json":
+		schema = jsonObject{"type": "object"}
+	default:
+		schema = jsonObject{"type": "string"}
+	}
+	if c.Envelope {
+		schema = jsonObject{
+			"type":       "object",
+			"properties": jsonObject{"result": schema},
+			"required":   []string{"result"},
+		}
+	}
+	return jsonObject{c.MediaType: jsonObject{"schema": schema}}
+}
+
+// operationID строит идентификатор операции из пути: /events_for_day — eventsForDay.
+func operationID(path string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range strings.TrimPrefix(path, "/") {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = sb.Len() > 0
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// openAPISpec строит спецификацию OpenAPI методов routes.
+func openAPISpec(routes []route) jsonObject {
+	b := &schemaBuilder{schemas: jsonObject{}}
+	errorSchema := b.schema(reflect.TypeOf(errorResponse{}))
+
+	paths := jsonObject{}
+	for _, rt := range routes {
+		op := jsonObject{
+			"operationId": operationID(rt.Path),
+			"summary":     rt.Summary,
+		}
+		if rt.Public {
+			op["security"] = []jsonObject{}
+		}
+
+		var parameters []jsonObject
+		formProperties := jsonObject{}
+		encoding := jsonObject{}
+		var formRequired []string
+		for _, p := range rt.Params {
+			schema := p.Schema.spec()
+			if in := rt.in(p); in != inForm {
+				parameter := jsonObject{
+					"name":        p.Name,
+					"in":          in,
+					"required":    p.Required,
+					"description": p.Description,
+					"schema":      schema,
+				}
+				if p.Schema.Type == "array" {
+					parameter["style"] = "form"
+					parameter["explode"] = false
+				}
+				parameters = append(parameters, parameter)
+				continue
+			}
+			schema["description"] = p.Description
+			formProperties[p.Name] = schema
+			if p.Required {
+				formRequired = append(formRequired, p.Name)
+			}
+			if p.Schema.Type == "array" {
+				encoding[p.Name] = jsonObject{"style": "form", "explode": false}
+			}
+		}
+		if len(parameters) > 0 {
+			op["parameters"] = parameters
+		}
+		switch {
+		case rt.Body != nil:
+			op["requestBody"] = jsonObject{"required": true, "content": b.content(*rt.Body)}
+		case len(formProperties) > 0:
+			form := jsonObject{"type": "object", "properties": formProperties}
+			if len(formRequired) > 0 {
+				form["required"] = formRequired
+			}
+			media := jsonObject{"schema": form}
+			if len(encoding) > 0 {
+				media["encoding"] = encoding
+			}
+			op["requestBody"] = jsonObject{
+				"required": len(formRequired) > 0,
+				"content":  jsonObject{"application/x-www-form-urlencoded": media},
+			}
+		}
+
+		success := jsonObject{"description": http.StatusText(rt.Response.Status)}
+		if rt.Response.MediaType != "" {
+			success["content"] = b.content(rt.Response)
+		}
+		op["responses"] = jsonObject{
+			strconv.Itoa(rt.Response.Status): success,
+			"default": jsonObject{
+				"description": "Ошибка: 400 — неверные параметры, 401 и 403 — нет доступа, 413 — слишком большое тело запроса, 429 — превышена частота запросов, 503 — ошибка бизнес-логики, 500 — внутренняя ошибка.",
+				"content":     jsonObject{"application/json": jsonObject{"schema": errorSchema}},
+			},
+		}
+
+		item, ok := paths[rt.Path].(jsonObject)
+		if !ok {
+			item = jsonObject{}
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return jsonObject{
+		"openapi": openAPIVersion,
+		"info": jsonObject{
+			"title":       "Calendar API",
+			"version":     "1.0.0",
+			"description": `HTTP сервер календаря. Успешные ответы имеют вид {"result": ...}, ошибки — {"error": "..."}.`,
+		},
+		"paths": paths,
+		"components": jsonObject{
+			"schemas": b.schemas,
+			"securitySchemes": jsonObject{
+				"bearerAuth": jsonObject{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Токен выдает команда token; подписывается ключом auth.secret и проверяется всегда, кроме режима auth.disabled.",
+				},
+			},
+		},
+		"security": []jsonObject{{"bearerAuth": []string{}}},
+	}
+}
+
+// openAPIHandler обрабатывает GET /openapi.json.
+func openAPIHandler(spec jsonObject) http.HandlerFunc {
+	body, err := json.Marshal(spec)
+	if err != nil {
+		panic(fmt.Sprintf("openapi: %v", err))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+// registerRoutes регистрирует обработчики маршрутов в mux.
+func registerRoutes(mux *http.ServeMux, routes []route) {
+	for _, rt := range routes {
+		mux.Handle(rt.Path, rt.handler())
+	}
+}
+
+// publicPaths возвращает пути методов, доступных без bearer токена.
+func publicPaths(routes []route) []string {
+	var paths []string
+	for _, rt := range routes {
+		if rt.Public {
+			paths = append(paths, rt.Path)
+		}
+	}
+	return paths
+}
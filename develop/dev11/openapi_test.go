@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRoutes возвращает маршруты API поверх пустого хранилища.
+func testRoutes() ([]route, *EventStore) {
+	store := NewEventStore()
+	scheduler := NewScheduler(store, &fakeNotifier{}, ReminderConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return apiRoutes(routeDeps{
+		store:     store,
+		scheduler: scheduler,
+		broker:    NewChangeBroker(store),
+		metrics:   NewMetrics(store),
+		health:    &Health{},
+	}), store
+}
+
+// errorParam извлекает имя параметра из ответа {"error": "invalid parameter ..."}.
+var errorParam = regexp.MustCompile(`invalid parameter \\?"([^"\\]+)\\?"`)
+
+func TestRoutes_Registered(t *testing.T) {
+	routes, _ := testRoutes()
+	mux := http.NewServeMux()
+	registerRoutes(mux, routes)
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if err := json.Unmarshal(response.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Invalid spec: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, rt := range routes {
+		if seen[rt.Path] {
+			t.Errorf("Route %s is declared twice", rt.Path)
+		}
+		seen[rt.Path] = true
+		if rt.Handler == nil {
+			t.Errorf("Route %s has no handler", rt.Path)
+		}
+		if _, pattern := mux.Handler(httptest.NewRequest(rt.Method, rt.Path, nil)); pattern != rt.Path {
+			t.Errorf("Route %s is not registered, got pattern %q", rt.Path, pattern)
+		}
+		if _, ok := spec.Paths[rt.Path][strings.ToLower(rt.Method)]; !ok {
+			t.Errorf("Route %s %s is missing from the spec", rt.Method, rt.Path)
+		}
+	}
+	if len(spec.Paths) != len(routes) {
+		t.Errorf("Expected %d paths in the spec, got %d", len(routes), len(spec.Paths))
+	}
+}
+
+// TestRoutes_DeclareParams проверяет, что обработчики не читают параметров,
+// которых нет в описании маршрута: запрос с примерами обязательных параметров
+// может завершиться ошибкой только по объявленным параметрам.
+func TestRoutes_DeclareParams(t *testing.T) {
+	routes, _ := testRoutes()
+	// Отмененный контекст сразу завершает поток /events/stream.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, rt := range routes {
+		query, form := url.Values{}, url.Values{}
+		headers := http.Header{}
+		declared := map[string]bool{"method": true, "body": true}
+		for _, p := range rt.Params {
+			declared[p.Name] = true
+			if !p.Required {
+				continue
+			}
+			switch rt.in(p) {
+			case inQuery:
+				query.Set(p.Name, p.Schema.example())
+			case inForm:
+				form.Set(p.Name, p.Schema.example())
+			case inHeader:
+				headers.Set(p.Name, p.Schema.example())
+			}
+		}
+		r := httptest.NewRequest(rt.Method, rt.Path+"?"+query.Encode(), strings.NewReader(form.Encode())).WithContext(ctx)
+		r.Header = headers
+		if rt.in(param{}) == inForm {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		response := httptest.NewRecorder()
+		rt.handler().ServeHTTP(response, r)
+
+		if m := errorParam.FindStringSubmatch(response.Body.String()); m != nil && !declared[m[1]] {
+			t.Errorf("%s reads undeclared parameter %q: %s", rt.Path, m[1], response.Body)
+		}
+	}
+}
+
+func TestRoutes_Head(t *testing.T) {
+	routes, _ := testRoutes()
+	mux := http.NewServeMux()
+	registerRoutes(mux, routes)
+
+	for _, rt := range routes {
+		if rt.Method != http.MethodGet {
+			continue
+		}
+		query, headers := url.Values{}, http.Header{}
+		for _, p := range rt.Params {
+			if !p.Required {
+				continue
+			}
+			if rt.in(p) == inHeader {
+				headers.Set(p.Name, p.Schema.example())
+			} else {
+				query.Set(p.Name, p.Schema.example())
+			}
+		}
+		r := httptest.NewRequest(http.MethodHead, rt.Path+"?"+query.Encode(), nil)
+		r.Header = headers
+		response := httptest.NewRecorder()
+		mux.ServeHTTP(response, r)
+		if response.Code == http.StatusBadRequest {
+			t.Errorf("HEAD %s is rejected: %s", rt.Path, response.Body)
+		}
+	}
+}
+
+func TestRoute_Validate(t *testing.T) {
+	routes, store := testRoutes()
+	mux := http.NewServeMux()
+	registerRoutes(mux, routes)
+	store.CreateEvent(1, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)})
+
+	tests := []struct {
+		method, target, body string
+		want                 string
+	}{
+		{http.MethodPost, "/events_for_day?user_id=1&date=2019-09-09", "", `invalid parameter "method": must be GET`},
+		{http.MethodGet, "/events_for_day?date=2019-09-09", "", `invalid parameter "user_id": is required`},
+		{http.MethodGet, "/events_for_day?user_id=x&date=2019-09-09", "", `invalid parameter "user_id": must be an integer`},
+		{http.MethodGet, "/events_for_day?user_id=0&date=2019-09-09", "", `invalid parameter "user_id": must be positive`},
+		{http.MethodGet, "/events_for_day?user_id=1&date=09.09.2019", "", `invalid parameter "date": must be a date in YYYY-MM-DD format`},
+		{http.MethodGet, "/events_for_day?user_id=1&date=2019-09-09&tz=Mars", "", `invalid parameter "tz": must be an IANA time zone name`},
+		{http.MethodGet, "/search?user_id=1&sort=size", "", `invalid parameter "sort": must be date, -date, name or -name`},
+		{http.MethodGet, "/search?user_id=1&limit=1000", "", `invalid parameter "limit": must be an integer from 1 to 200`},
+		{http.MethodGet, "/free_busy?user_id=1&date=2019-09-09&min_duration=-1h", "", `invalid parameter "min_duration": must be a non-negative duration like 30m or 1h30m`},
+		{http.MethodPost, "/create_event", "user_id=1&date=2019-09-09&name=x&time=25:00", `invalid parameter "time": must be a time in HH:MM format`},
+		{http.MethodPost, "/create_event", "user_id=1&date=2019-09-09&name=x&all_day=maybe", `invalid parameter "all_day": must be true or false`},
+		{http.MethodPost, "/create_event", "user_id=1&date=2019-09-09&name=x&reminders=10,99999", `invalid parameter "reminders": must be comma-separated minutes from 0 to 10080`},
+		{http.MethodPost, "/create_event", "user_id=1&date=2019-09-09&name=x&reminders=1,2,3,4,5,6", `invalid parameter "reminders": at most 5 reminders are allowed`},
+		{http.MethodPost, "/create_event", "user_id=1&date=2019-09-09&name=x&tags=a+b", `invalid parameter "tags": must be comma-separated tags of 1 to 32 letters, digits, '-' or '_'`},
+		{http.MethodPost, "/create_event", "user_id=1&date=2019-09-09&name=x&on_conflict=ignore", `invalid parameter "on_conflict": must be warn or reject`},
+		{http.MethodPost, "/share_calendar", "user_id=1&grantee_id=2&access=admin", `invalid parameter "access": must be read, write or none`},
+		{http.MethodGet, "/events/get?userId=me", "", `invalid parameter "userId": must be an integer`},
+		{http.MethodGet, "/events_for_day?user_id=1&date=2019-09-09", "", `"name":"Standup"`},
+		{http.MethodPost, "/create_event", "user_id=1&date=2019-09-10&name=Retro&tags=Work", `"tags":["work"]`},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		mux.ServeHTTP(response, r)
+		if !strings.HasPrefix(test.want, "invalid parameter") {
+			if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), test.want) {
+				t.Errorf("%s %s %s: expected %s, got %d %s", test.method, test.target, test.body, test.want, response.Code, response.Body)
+			}
+			continue
+		}
+		var body errorResponse
+		json.Unmarshal(response.Body.Bytes(), &body)
+		if response.Code != http.StatusBadRequest || body.Error != test.want {
+			t.Errorf("%s %s %s: expected 400 %s, got %d %s", test.method, test.target, test.body, test.want, response.Code, response.Body)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	routes, _ := testRoutes()
+	data, err := json.Marshal(openAPISpec(routes))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var spec map[string]interface{}
+	json.Unmarshal(data, &spec)
+	if spec["openapi"] != openAPIVersion {
+		t.Errorf("Unexpected openapi version: %v", spec["openapi"])
+	}
+
+	// lookup проходит по вложенным объектам документа.
+	lookup := func(path ...string) interface{} {
+		var v interface{} = spec
+		for _, key := range path {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("No object at %v", path)
+			}
+			v = obj[key]
+		}
+		return v
+	}
+
+	form := lookup("paths", "/create_event", "post", "requestBody", "content", "application/x-www-form-urlencoded", "schema").(map[string]interface{})
+	if got := form["required"]; len(got.([]interface{})) != 3 {
+		t.Errorf("Expected user_id, date and name to be required, got %v", got)
+	}
+	if got := lookup("paths", "/events_for_day", "get", "parameters").([]interface{}); len(got) != 3 {
+		t.Errorf("Expected 3 query parameters, got %v", got)
+	}
+	if got := lookup("components", "schemas", "Event", "properties", "date", "format"); got != "date-time" {
+		t.Errorf("Expected Event.date to be date-time, got %v", got)
+	}
+	if got := lookup("components", "schemas", "Event", "required").([]interface{}); len(got) != 5 {
+		t.Errorf("Expected id, name, date, end and version to be required, got %v", got)
+	}
+	// Поля встроенного Reminder поднимаются на уровень Delivery.
+	if lookup("components", "schemas", "Delivery", "properties", "event_name") == nil {
+		t.Error("Embedded Reminder fields are missing from Delivery")
+	}
+	if lookup("paths", "/healthz", "get", "security") == nil {
+		t.Error("Public route requires authentication")
+	}
+
+	// Все ссылки на схемы разрешаются.
+	for _, ref := range regexp.MustCompile(`"\$ref":"#/components/schemas/(\w+)"`).FindAllStringSubmatch(string(data), -1) {
+		if lookup("components", "schemas", ref[1]) == nil {
+			t.Errorf("Unresolved reference %s", ref[0])
+		}
+	}
+}
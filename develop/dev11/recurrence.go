@@ -0,0 +1,420 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Частоты повторения событий.
+const (
+	freqDaily   = "DAILY"
+	freqWeekly  = "WEEKLY"
+	freqMonthly = "MONTHLY"
+	freqYearly  = "YEARLY"
+)
+
+// weekdayCodes — коды дней недели в нотации RRULE.
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Recurrence описывает правило повторения события в духе RRULE из RFC 5545.
+type Recurrence struct {
+	// Freq — частота: DAILY, WEEKLY, MONTHLY или YEARLY.
+	Freq string `json:"freq"`
+	// Interval — шаг повторения в единицах Freq, по умолчанию 1.
+	Interval int `json:"interval,omitempty"`
+	// ByDay — дни недели (MO, TU, ...). Для MONTHLY допускается порядковый
+	// номер дня в месяце: 1MO — первый понедельник, -1FR — последняя пятница.
+	ByDay []string `json:"by_day,omitempty"`
+	// Count — общее число повторений, включая первое.
+	Count int `json:"count,omitempty"`
+	// Until — последний момент, в который может начаться повторение.
+	Until *time.Time `json:"until,omitempty"`
+	// ExDates — даты, в которые повторение пропускается.
+	ExDates []time.Time `json:"exdates,omitempty"`
+}
+
+// byDay — разобранный элемент BYDAY.
+type byDay struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+// ParseRRule разбирает правило вида "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10".
+func ParseRRule(s string) (*Recurrence, error) {
+	rule := &Recurrence{}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(s), "RRULE:"), ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("INTERVAL must be an integer")
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("COUNT must be an integer")
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseRRuleTime(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			rule.ByDay = strings.Split(strings.ToUpper(value), ",")
+		case "WKST":
+			if strings.ToUpper(value) != "MO" {
+				return nil, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// parseRRuleTime разбирает значение UNTIL: дату или дату со временем в UTC.
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102", dateLayout} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if len(value) == len("20060102") || len(value) == len(dateLayout) {
+				// Дата без времени включает весь день.
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL %q must be YYYYMMDD or YYYYMMDDTHHMMSSZ", value)
+}
+
+// String возвращает правило в нотации RRULE (без EXDATE).
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		parts = append(parts, "BYDAY="+strings.Join(r.ByDay, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Validate проверяет корректность правила.
+func (r *Recurrence) Validate() error {
+	switch r.Freq {
+	case freqDaily, freqWeekly, freqMonthly, freqYearly:
+	case "":
+		return errors.New("FREQ is required")
+	default:
+		return fmt.Errorf("unsupported FREQ %q", r.Freq)
+	}
+	if r.Interval < 0 {
+		return errors.New("INTERVAL must be positive")
+	}
+	if r.Count < 0 {
+		return errors.New("COUNT must be positive")
+	}
+	if r.Count > maxExpansionSteps {
+		return fmt.Errorf("COUNT must be at most %d", maxExpansionSteps)
+	}
+	if r.Count > 0 && r.Until != nil {
+		return errors.New("COUNT and UNTIL are mutually exclusive")
+	}
+	if len(r.ByDay) > 0 && r.Freq == freqYearly {
+		return errors.New("BYDAY is not supported for YEARLY rules")
+	}
+	for _, code := range r.ByDay {
+		day, err := parseByDay(code)
+		if err != nil {
+			return err
+		}
+		if day.ordinal != 0 && r.Freq != freqMonthly {
+			return fmt.Errorf("BYDAY %q: ordinal days are supported only for MONTHLY rules", code)
+		}
+	}
+	return nil
+}
+
+// parseByDay разбирает элемент BYDAY вида MO, 1MO или -1FR.
+func parseByDay(code string) (byDay, error) {
+	if len(code) < 2 {
+		return byDay{}, fmt.Errorf("invalid BYDAY %q", code)
+	}
+	weekday, ok := weekdayCodes[code[len(code)-2:]]
+	if !ok {
+		return byDay{}, fmt.Errorf("invalid BYDAY %q", code)
+	}
+	day := byDay{weekday: weekday}
+	if prefix := code[:len(code)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return byDay{}, fmt.Errorf("invalid BYDAY %q", code)
+		}
+		day.ordinal = n
+	}
+	return day, nil
+}
+
+// interval возвращает шаг повторения с учетом значения по умолчанию.
+func (r *Recurrence) interval() int {
+	if r.Interval <= 0 {
+		return 1
+	}
+	return r.Interval
+}
+
+// byDays возвращает разобранные BYDAY; правило должно быть валидным.
+func (r *Recurrence) byDays() []byDay {
+	days := make([]byDay, 0, len(r.ByDay))
+	for _, code := range r.ByDay {
+		if day, err := parseByDay(code); err == nil {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// excluded проверяет, попадает ли момент на одну из дат-исключений.
+// Дата-исключение сравнивается с календарной датой повторения в его часовом поясе.
+func (r *Recurrence) excluded(t time.Time) bool {
+	for _, ex := range r.ExDates {
+		if ex.Year() == t.Year() && ex.YearDay() == t.YearDay() {
+			return true
+		}
+	}
+	return false
+}
+
+// maxExpansionSteps ограничивает число кандидатов, перебираемых за один вызов
+// Occurrences, и COUNT правила. Правила без COUNT перебираются с периода,
+// содержащего from, поэтому предел достижим только для очень длинного
+// интервала [from, to) или правила, сохраненного в обход Validate.
+const maxExpansionSteps = 100000
+
+// errExpansionLimit возвращается, если развертка правила превысила maxExpansionSteps.
+var errExpansionLimit = errors.New("recurrence expansion limit exceeded")
+
+// Occurrences возвращает моменты начала повторений, попадающие в полуинтервал
+// [from, to). start — начало первого повторения. COUNT отсчитывается от start
+// независимо от from; даты из ExDates пропускаются, но учитываются в COUNT.
+func (r *Recurrence) Occurrences(start, from, to time.Time) ([]time.Time, error) {
+	var result []time.Time
+	var err error
+	generated := 0
+	skipTo := from
+	if r.Count > 0 {
+		// Для COUNT нужно знать все повторения с начала правила.
+		skipTo = start
+	}
+	r.expand(start, skipTo, func(t time.Time) bool {
+		if !t.Before(to) || (r.Until != nil && t.After(*r.Until)) {
+			return false
+		}
+		generated++
+		if r.Count > 0 && generated > r.Count {
+			return false
+		}
+		if generated > maxExpansionSteps {
+			err = errExpansionLimit
+			return false
+		}
+		if !t.Before(from) && !r.excluded(t) {
+			result = append(result, t)
+		}
+		return true
+	})
+	return result, err
+}
+
+// expand перебирает кандидатов в хронологическом порядке, пока yield
+// возвращает true. Перебор начинается с периода правила, предшествующего
+// периоду, в который попадает skipTo, но не раньше start: пропущенные
+// периоды вычисляются арифметически, а не перебором.
+func (r *Recurrence) expand(start, skipTo time.Time, yield func(time.Time) bool) {
+	loc := start.Location()
+	hour, minute, sec := start.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, sec, start.Nanosecond(), loc)
+	}
+	step := r.interval()
+	days := r.byDays()
+	// skipped возвращает индекс периода, с которого начинается перебор,
+	// если от start до skipTo прошло elapsed периодов.
+	skipped := func(elapsed int) int {
+		if elapsed/step < 1 {
+			return 0
+		}
+		return (elapsed/step - 1) * step
+	}
+	base := start
+	if skipTo.After(start) {
+		base = skipTo
+	}
+	skipTo = skipTo.In(loc)
+
+	switch r.Freq {
+	case freqDaily:
+		for i := skipped(daysBetween(start, skipTo)); ; i += step {
+			t := at(start.Year(), start.Month(), start.Day()+i)
+			if len(days) > 0 && !matchesWeekday(days, t.Weekday()) {
+				continue
+			}
+			if !yield(t) {
+				return
+			}
+		}
+
+	case freqWeekly:
+		if len(days) == 0 {
+			days = []byDay{{weekday: start.Weekday()}}
+		}
+		// Недели начинаются с понедельника (WKST=MO).
+		weekStart := start.Day() - (int(start.Weekday())+6)%7
+		firstWeek := at(start.Year(), start.Month(), weekStart)
+		for week := skipped(daysBetween(firstWeek, skipTo) / 7); ; week += step {
+			for offset := 0; offset < 7; offset++ {
+				t := at(start.Year(), start.Month(), weekStart+week*7+offset)
+				if t.Before(start) || !matchesWeekday(days, t.Weekday()) {
+					continue
+				}
+				if !yield(t) {
+					return
+				}
+			}
+		}
+
+	case freqMonthly:
+		months := (skipTo.Year()-start.Year())*12 + int(skipTo.Month()-start.Month())
+		for i := skipped(months); ; i += step {
+			year, month := start.Year(), start.Month()+time.Month(i)
+			if len(days) == 0 {
+				t := at(year, month, start.Day())
+				if t.Day() != start.Day() {
+					// В месяце нет такого числа — повторение пропускается.
+					if !r.withinLimits(base, t) {
+						return
+					}
+					continue
+				}
+				if !yield(t) {
+					return
+				}
+				continue
+			}
+			first := at(year, month, 1)
+			for day := 1; day <= daysIn(first); day++ {
+				t := at(year, month, day)
+				if t.Before(start) || !matchesMonthDay(days, t) {
+					continue
+				}
+				if !yield(t) {
+					return
+				}
+			}
+			if !r.withinLimits(base, first) {
+				return
+			}
+		}
+
+	case freqYearly:
+		for i := skipped(skipTo.Year() - start.Year()); ; i += step {
+			t := at(start.Year()+i, start.Month(), start.Day())
+			if t.Day() != start.Day() {
+				// 29 февраля в невисокосный год пропускается.
+				if !r.withinLimits(base, t) {
+					return
+				}
+				continue
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// maxExpansion ограничивает перебор кандидатов, которые ни разу не совпали
+// с правилом, чтобы некорректное правило не зациклило развертку.
+const maxExpansion = 100 * 365 * 24 * time.Hour
+
+// withinLimits сообщает, имеет ли смысл продолжать перебор после
+// пропущенного периода; base — момент, с которого начат перебор.
+func (r *Recurrence) withinLimits(base, t time.Time) bool {
+	if r.Until != nil && t.After(*r.Until) {
+		return false
+	}
+	return t.Sub(base) <= maxExpansion
+}
+
+// daysBetween возвращает число календарных дней от даты a до даты b; время
+// суток не учитывается.
+func daysBetween(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	// Разность в секундах, а не time.Duration, которая ограничена ~292 годами.
+	return int((db.Unix() - da.Unix()) / (24 * 60 * 60))
+}
+
+// matchesWeekday проверяет, входит ли день недели в BYDAY.
+func matchesWeekday(days []byDay, weekday time.Weekday) bool {
+	for _, day := range days {
+		if day.weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay проверяет, подходит ли дата под BYDAY с учетом порядковых номеров.
+func matchesMonthDay(days []byDay, t time.Time) bool {
+	for _, day := range days {
+		if day.weekday != t.Weekday() {
+			continue
+		}
+		switch {
+		case day.ordinal == 0:
+			return true
+		case day.ordinal > 0 && (t.Day()-1)/7+1 == day.ordinal:
+			return true
+		case day.ordinal < 0 && (daysIn(t)-t.Day())/7+1 == -day.ordinal:
+			return true
+		}
+	}
+	return false
+}
+
+// daysIn возвращает число дней в месяце даты t.
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dates форматирует моменты как YYYY-MM-DD для сравнения в тестах.
+func dates(times []time.Time) []string {
+	out := make([]string, len(times))
+	for i, t := range times {
+		out[i] = t.Format(dateLayout)
+	}
+	return out
+}
+
+// occurrences разворачивает правило и завершает тест при ошибке развертки.
+func occurrences(t *testing.T, rule *Recurrence, start, from, to time.Time) []time.Time {
+	t.Helper()
+	got, err := rule.Occurrences(start, from, to)
+	if err != nil {
+		t.Fatalf("Occurrences(%s): %v", rule, err)
+	}
+	return got
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRecurrence_Occurrences(t *testing.T) {
+	// 2019-09-02 — понедельник.
+	start := time.Date(2019, 9, 2, 10, 0, 0, 0, time.UTC)
+	from := time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule  string
+		start time.Time
+		want  []string
+	}{
+		{"FREQ=DAILY;COUNT=3", start, []string{"2019-09-02", "2019-09-03", "2019-09-04"}},
+		{"FREQ=DAILY;INTERVAL=10", start, []string{"2019-09-02", "2019-09-12", "2019-09-22"}},
+		{"FREQ=DAILY;BYDAY=SA,SU;UNTIL=20190910", start, []string{"2019-09-07", "2019-09-08"}},
+		{"FREQ=WEEKLY", start, []string{"2019-09-02", "2019-09-09", "2019-09-16", "2019-09-23", "2019-09-30"}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=5", start, []string{"2019-09-02", "2019-09-05", "2019-09-16", "2019-09-19", "2019-09-30"}},
+		{"FREQ=MONTHLY;COUNT=2", start, []string{"2019-09-02"}},
+		{"FREQ=MONTHLY;BYDAY=-1FR", start, []string{"2019-09-27"}},
+		{"FREQ=MONTHLY;BYDAY=1MO,3MO", start, []string{"2019-09-02", "2019-09-16"}},
+		{"FREQ=YEARLY", start.AddDate(-3, 0, 0), []string{"2019-09-02"}},
+	}
+	for _, test := range tests {
+		rule, err := ParseRRule(test.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", test.rule, err)
+		}
+		got := dates(occurrences(t, rule, test.start, from, to))
+		if !equalStrings(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.rule, test.want, got)
+		}
+	}
+}
+
+func TestRecurrence_SkipsMissingDays(t *testing.T) {
+	rule, _ := ParseRRule("FREQ=MONTHLY;COUNT=4")
+	start := time.Date(2019, 1, 31, 9, 0, 0, 0, time.UTC)
+	got := dates(occurrences(t, rule, start, start, start.AddDate(1, 0, 0)))
+	want := []string{"2019-01-31", "2019-03-31", "2019-05-31", "2019-07-31"}
+	if !equalStrings(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	rule, _ = ParseRRule("FREQ=YEARLY;COUNT=2")
+	start = time.Date(2020, 2, 29, 9, 0, 0, 0, time.UTC)
+	got = dates(occurrences(t, rule, start, start, start.AddDate(10, 0, 0)))
+	want = []string{"2020-02-29", "2024-02-29"}
+	if !equalStrings(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestRecurrence_CountBeforeRange(t *testing.T) {
+	rule, _ := ParseRRule("FREQ=WEEKLY;COUNT=3")
+	start := time.Date(2019, 9, 2, 10, 0, 0, 0, time.UTC)
+	from := time.Date(2019, 9, 15, 0, 0, 0, 0, time.UTC)
+
+	got := dates(occurrences(t, rule, start, from, from.AddDate(0, 1, 0)))
+	if !equalStrings(got, []string{"2019-09-16"}) {
+		t.Errorf("COUNT must be counted from the first occurrence, got %v", got)
+	}
+}
+
+func TestRecurrence_ExDates(t *testing.T) {
+	rule, _ := ParseRRule("FREQ=DAILY;COUNT=3")
+	rule.ExDates = []time.Time{time.Date(2019, 9, 3, 0, 0, 0, 0, time.UTC)}
+	loc := time.FixedZone("UTC-5", -5*3600)
+	start := time.Date(2019, 9, 2, 22, 0, 0, 0, loc)
+
+	got := occurrences(t, rule, start, start, start.AddDate(0, 1, 0))
+	if len(got) != 2 || got[0].Day() != 2 || got[1].Day() != 4 {
+		t.Errorf("Expected 2 and 4 September, got %v", got)
+	}
+}
+
+func TestParseRRule_Invalid(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=x",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=DAILY;COUNT=2;UNTIL=20190101",
+		"FREQ=DAILY;BYSETPOS=1",
+	} {
+		if _, err := ParseRRule(rule); err == nil {
+			t.Errorf("%q: expected error", rule)
+		}
+	}
+}
+
+func TestEventsForPeriodHandler_Recurring(t *testing.T) {
+	store := NewEventStore()
+	handler := createEventFormHandler(store)
+	response := postForm(handler, "/create_event", url.Values{
+		"user_id": {"3"},
+		"name":    {"Standup"},
+		"date":    {"2019-09-02"},
+		"rrule":   {"FREQ=WEEKLY;BYDAY=MO,WE,FR"},
+		"exdate":  {"2019-09-11"},
+	})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, response.Code, response.Body)
+	}
+
+	week := time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC)
+	from, to := weekPeriod(week)
+	events, _ := store.EventsBetween(3, from, to)
+	var got []time.Time
+	for _, event := range events {
+		got = append(got, event.Date)
+	}
+	if want := []string{"2019-09-09", "2019-09-13"}; !equalStrings(dates(got), want) {
+		t.Errorf("Expected %v, got %v", want, dates(got))
+	}
+
+	response = postForm(handler, "/create_event", url.Values{
+		"user_id": {"3"},
+		"name":    {"Broken"},
+		"date":    {"2019-09-02"},
+		"rrule":   {"FREQ=SECONDLY"},
+	})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for invalid rrule, but got %d", http.StatusBadRequest, response.Code)
+	}
+}
+
+func TestRecurrence_SkipAhead(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	start := time.Date(2015, 1, 31, 23, 30, 0, 0, loc)
+	for _, rrule := range []string{
+		"FREQ=DAILY",
+		"FREQ=DAILY;INTERVAL=3;BYDAY=MO,FR",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU",
+		"FREQ=MONTHLY",
+		"FREQ=MONTHLY;INTERVAL=5;BYDAY=-1FR,2MO",
+		"FREQ=YEARLY;INTERVAL=3",
+		"FREQ=WEEKLY;UNTIL=20190315",
+	} {
+		rule, _ := ParseRRule(rrule)
+		for _, from := range []time.Time{
+			start.AddDate(0, 0, -3),
+			start.AddDate(0, 0, 1),
+			time.Date(2019, 3, 10, 12, 0, 0, 0, time.UTC),
+			time.Date(2019, 11, 3, 0, 0, 0, 0, loc),
+			time.Date(2024, 2, 29, 3, 0, 0, 0, time.FixedZone("UTC+14", 14*3600)),
+		} {
+			to := from.AddDate(0, 2, 0)
+			// Перебор с первого повторения — эталон для развертки с пропуском периодов.
+			var want []time.Time
+			for _, occurrence := range occurrences(t, rule, start, start, to) {
+				if !occurrence.Before(from) {
+					want = append(want, occurrence)
+				}
+			}
+			got := occurrences(t, rule, start, from, to)
+			if !equalStrings(dates(got), dates(want)) || (len(got) > 0 && !got[0].Equal(want[0])) {
+				t.Errorf("%s from %v: expected %v, got %v", rrule, from, dates(want), dates(got))
+			}
+		}
+	}
+}
+
+func TestRecurrence_ExpansionLimit(t *testing.T) {
+	start := time.Date(2019, 9, 2, 10, 0, 0, 0, time.UTC)
+	far := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	// Правило без COUNT разворачивается с периода, содержащего from.
+	rule, _ := ParseRRule("FREQ=DAILY")
+	if got := occurrences(t, rule, start, far, far.Add(24*time.Hour)); len(got) != 1 {
+		t.Errorf("Expected one occurrence, got %v", got)
+	}
+
+	if _, err := ParseRRule("FREQ=DAILY;COUNT=100001"); err == nil {
+		t.Error("Expected error for COUNT above the expansion limit")
+	}
+
+	// Правило, сохраненное в обход Validate, не разворачивается дальше предела.
+	rule = &Recurrence{Freq: freqDaily, Count: 1000000000}
+	if _, err := rule.Occurrences(start, far, far.Add(24*time.Hour)); err != errExpansionLimit {
+		t.Errorf("Expected expansion limit error, got %v", err)
+	}
+
+	// Такое событие пропускается, а остальные события запроса возвращаются.
+	store := NewEventStore()
+	store.CreateEvent(3, Event{Name: "Standup", Date: start, Recurrence: rule})
+	store.CreateEvent(3, Event{Name: "Party", Date: far.Add(20 * time.Hour)})
+	response := getQuery(eventsForPeriodHandler(store, dayPeriod), "/events_for_day", url.Values{
+		"user_id": {"3"},
+		"date":    {"9999-12-31"},
+	})
+	if response.Code != http.StatusOK || strings.Contains(response.Body.String(), "Standup") || !strings.Contains(response.Body.String(), "Party") {
+		t.Errorf("Expected only the non-recurring event, got %d: %s", response.Code, response.Body)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// notifyTimeout ограничивает одну попытку доставки напоминания.
+const notifyTimeout = 10 * time.Second
+
+// deliveryRetention — сколько хранится состояние завершенной доставки.
+const deliveryRetention = 24 * time.Hour
+
+// Reminder — напоминание о предстоящем экземпляре события.
+type Reminder struct {
+	UserID        int       `json:"user_id"`
+	EventID       int       `json:"event_id"`
+	EventName     string    `json:"event_name"`
+	Start         time.Time `json:"start"`
+	MinutesBefore int       `json:"minutes_before"`
+	FireAt        time.Time `json:"fire_at"`
+}
+
+// Состояния доставки напоминания.
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// Delivery описывает состояние доставки напоминания.
+type Delivery struct {
+	Reminder
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	nextAttempt time.Time
+}
+
+// reminderKey однозначно определяет напоминание об экземпляре события.
+type reminderKey struct {
+	userID        int
+	eventID       int
+	start         int64
+	minutesBefore int
+}
+
+// Scheduler периодически находит напоминания, время которых наступило,
+// и доставляет их через Notifier. Неудачная доставка повторяется с
+// экспоненциальной задержкой, пока не исчерпано число попыток.
+//
+// Состояние доставок хранится в памяти: напоминания, время которых пришлось
+// на остановку сервера, не отправляются.
+type Scheduler struct {
+	store        Storage
+	notifier     Notifier
+	logger       *slog.Logger
+	pollInterval time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+
+	mu         sync.Mutex
+	last       time.Time
+	deliveries map[reminderKey]*Delivery
+}
+
+// NewScheduler создает планировщик напоминаний для событий из store.
+func NewScheduler(store Storage, notifier Notifier, cfg ReminderConfig, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		store:        store,
+		notifier:     notifier,
+		logger:       logger,
+		pollInterval: time.Duration(cfg.PollInterval),
+		maxAttempts:  cfg.MaxAttempts,
+		retryBackoff: time.Duration(cfg.RetryBackoff),
+		deliveries:   make(map[reminderKey]*Delivery),
+	}
+}
+
+// Run проверяет напоминания каждые pollInterval, пока не отменен ctx.
+// Напоминания, время которых наступило до запуска, не отправляются.
+// Run возвращается после завершения текущей проверки.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.last = time.Now()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.tick(ctx, now)
+		}
+	}
+}
+
+// tick ставит в очередь напоминания со временем в (last, now] и доставляет
+// все напоминания, для которых наступило время очередной попытки.
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	from := s.last
+	s.last = now
+	s.mu.Unlock()
+
+	due := s.dueReminders(from, now)
+
+	s.mu.Lock()
+	for _, reminder := range due {
+		key := reminderKey{reminder.UserID, reminder.EventID, reminder.Start.UnixNano(), reminder.MinutesBefore}
+		if _, ok := s.deliveries[key]; !ok {
+			s.deliveries[key] = &Delivery{Reminder: reminder, State: DeliveryPending, UpdatedAt: now, nextAttempt: now}
+		}
+	}
+	var pending []*Delivery
+	for key, delivery := range s.deliveries {
+		switch {
+		case delivery.State == DeliveryPending && !delivery.nextAttempt.After(now):
+			pending = append(pending, delivery)
+		case delivery.State != DeliveryPending && now.Sub(delivery.UpdatedAt) > deliveryRetention:
+			delete(s.deliveries, key)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].FireAt.Before(pending[j].FireAt) })
+
+	for _, delivery := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		s.deliver(ctx, delivery, now)
+	}
+}
+
+// dueReminders возвращает напоминания, время которых попадает в (from, to].
+func (s *Scheduler) dueReminders(from, to time.Time) []Reminder {
+	var due []Reminder
+	// Экземпляр, о котором пора напомнить, начинается не позже чем через
+	// максимальное время напоминания.
+	until := to.Add(maxReminderMinutes*time.Minute + time.Nanosecond)
+	for _, userID := range s.store.Users() {
+		events, err := s.store.EventsBetween(userID, from, until)
+		if err != nil {
+			s.logger.Error("Failed to load events for reminders", "user_id", userID, "err", err)
+			continue
+		}
+		for _, event := range events {
+			for _, minutes := range event.Reminders {
+				fireAt := event.Date.Add(-time.Duration(minutes) * time.Minute)
+				if fireAt.After(from) && !fireAt.After(to) {
+					due = append(due, Reminder{
+						UserID:        userID,
+						EventID:       event.ID,
+						EventName:     event.Name,
+						Start:         event.Date,
+						MinutesBefore: minutes,
+						FireAt:        fireAt,
+					})
+				}
+			}
+		}
+	}
+	return due
+}
+
+// deliver делает одну попытку доставки и обновляет ее состояние.
+func (s *Scheduler) deliver(ctx context.Context, delivery *Delivery, now time.Time) {
+	s.mu.Lock()
+	reminder := delivery.Reminder
+	s.mu.Unlock()
+
+	notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	err := s.notifier.Notify(notifyCtx, reminder)
+	cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+	if err == nil {
+		delivery.State, delivery.LastError = DeliverySent, ""
+		return
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.maxAttempts {
+		delivery.State = DeliveryFailed
+		s.logger.Error("Reminder delivery failed", "user_id", reminder.UserID, "event_id", reminder.EventID, "attempts", delivery.Attempts, "err", err)
+		return
+	}
+	delivery.nextAttempt = now.Add(s.retryDelay(delivery.Attempts))
+	s.logger.Warn("Reminder delivery will be retried", "user_id", reminder.UserID, "event_id", reminder.EventID, "attempts", delivery.Attempts, "err", err)
+}
+
+// maxRetryDelay ограничивает задержку перед повторной доставкой, сколько бы
+// попыток ни было сделано.
+const maxRetryDelay = time.Hour
+
+// retryDelay возвращает задержку перед попыткой, следующей за attempts
+// неудачными: retryBackoff, удваиваемую после каждой попытки, но не больше
+// maxRetryDelay (или самой retryBackoff, если она больше). Удвоение
+// останавливается на пределе, поэтому большое число попыток не переполняет
+// длительность.
+func (s *Scheduler) retryDelay(attempts int) time.Duration {
+	limit := maxRetryDelay
+	if s.retryBackoff > limit {
+		limit = s.retryBackoff
+	}
+	delay := s.retryBackoff
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// Deliveries возвращает состояние доставок напоминаний пользователя,
+// упорядоченное по времени напоминания.
+func (s *Scheduler) Deliveries(userID int) []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := make([]Delivery, 0)
+	for _, delivery := range s.deliveries {
+		if delivery.UserID == userID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].FireAt.Equal(deliveries[j].FireAt) {
+			return deliveries[i].EventID < deliveries[j].EventID
+		}
+		return deliveries[i].FireAt.Before(deliveries[j].FireAt)
+	})
+	return deliveries
+}
+
+// remindersHandler обрабатывает GET /reminders: возвращает состояние доставок
+// напоминаний пользователя за последние сутки. Доступно только самому пользователю.
+func remindersHandler(scheduler *Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodGet)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := authorizeOwner(r, userID); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, scheduler.Deliveries(userID))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNotifier запоминает доставленные напоминания и может отвечать ошибкой.
+type fakeNotifier struct {
+	mu        sync.Mutex
+	delivered []Reminder
+	fail      int
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail > 0 {
+		n.fail--
+		return errors.New("notifier unavailable")
+	}
+	n.delivered = append(n.delivered, reminder)
+	return nil
+}
+
+func newTestScheduler(store Storage, notifier Notifier, start time.Time) *Scheduler {
+	cfg := defaultConfig().Reminders
+	cfg.MaxAttempts = 3
+	cfg.RetryBackoff = Duration(time.Minute)
+	scheduler := NewScheduler(store, notifier, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	scheduler.last = start
+	return scheduler
+}
+
+func TestScheduler_FiresReminders(t *testing.T) {
+	store := NewEventStore()
+	start := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	standup := Event{Name: "Standup", Date: start, End: start.Add(15 * time.Minute), Reminders: []int{60, 10}}
+	standup.Recurrence = &Recurrence{Freq: freqDaily, Count: 2}
+	store.CreateEvent(1, standup)
+	store.CreateEvent(2, Event{Name: "Retro", Date: start.Add(time.Hour)})
+
+	notifier := &fakeNotifier{}
+	now := start.Add(-2 * time.Hour)
+	scheduler := newTestScheduler(store, notifier, now)
+	ctx := context.Background()
+
+	var fired []time.Time
+	for i := 0; i < 30*24*60/5; i++ {
+		now = now.Add(5 * time.Minute)
+		scheduler.tick(ctx, now)
+		if len(notifier.delivered) > len(fired) {
+			fired = append(fired, now)
+		}
+	}
+
+	expected := []time.Time{
+		start.Add(-time.Hour),
+		start.Add(-10 * time.Minute),
+		start.Add(23 * time.Hour),
+		start.Add(23*time.Hour + 50*time.Minute),
+	}
+	if len(notifier.delivered) != len(expected) {
+		t.Fatalf("Expected %d reminders, got %+v", len(expected), notifier.delivered)
+	}
+	for i, reminder := range notifier.delivered {
+		if !reminder.FireAt.Equal(expected[i]) || !fired[i].Equal(expected[i]) || reminder.UserID != 1 {
+			t.Errorf("Reminder %d: expected at %v, got %+v fired at %v", i, expected[i], reminder, fired[i])
+		}
+	}
+	deliveries := scheduler.Deliveries(1)
+	if len(deliveries) != 0 {
+		t.Errorf("Expected sent deliveries to expire, got %+v", deliveries)
+	}
+}
+
+func TestScheduler_Retries(t *testing.T) {
+	store := NewEventStore()
+	start := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	store.CreateEvent(1, Event{Name: "Standup", Date: start, Reminders: []int{0}})
+	store.CreateEvent(1, Event{Name: "Retro", Date: start.Add(time.Hour), Reminders: []int{0}})
+
+	notifier := &fakeNotifier{fail: 4}
+	scheduler := newTestScheduler(store, notifier, start.Add(-time.Minute))
+	ctx := context.Background()
+
+	// Первое напоминание: попытки в 10:00, 10:01 и 10:03 (задержка удваивается),
+	// после третьей неудачи доставка считается проваленной.
+	for _, at := range []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		scheduler.tick(ctx, start.Add(at))
+	}
+	deliveries := scheduler.Deliveries(1)
+	if len(deliveries) != 1 || deliveries[0].State != DeliveryFailed || deliveries[0].Attempts != 3 || deliveries[0].LastError == "" {
+		t.Fatalf("Unexpected deliveries: %+v", deliveries)
+	}
+
+	// Второе: одна неудача, затем доставка при повторе.
+	scheduler.tick(ctx, start.Add(time.Hour))
+	scheduler.tick(ctx, start.Add(time.Hour+time.Minute))
+	deliveries = scheduler.Deliveries(1)
+	if len(deliveries) != 2 || deliveries[1].State != DeliverySent || deliveries[1].Attempts != 2 {
+		t.Fatalf("Unexpected deliveries: %+v", deliveries)
+	}
+	if len(notifier.delivered) != 1 || notifier.delivered[0].EventName != "Retro" {
+		t.Errorf("Unexpected delivered reminders: %+v", notifier.delivered)
+	}
+}
+
+func TestScheduler_RetryDelay(t *testing.T) {
+	s := &Scheduler{retryBackoff: time.Minute}
+	for attempts, want := range map[int]time.Duration{
+		1:    time.Minute,
+		2:    2 * time.Minute,
+		6:    32 * time.Minute,
+		7:    maxRetryDelay,
+		64:   maxRetryDelay,
+		1000: maxRetryDelay,
+	} {
+		if got := s.retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+
+	// Задержка, заданная больше предела, не сокращается.
+	s.retryBackoff = 2 * time.Hour
+	if got := s.retryDelay(100); got != 2*time.Hour {
+		t.Errorf("retryDelay with long backoff = %v, want 2h", got)
+	}
+}
+
+func TestScheduler_RunStopsOnCancel(t *testing.T) {
+	cfg := defaultConfig().Reminders
+	cfg.PollInterval = Duration(time.Millisecond)
+	scheduler := NewScheduler(NewEventStore(), &fakeNotifier{}, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Scheduler did not stop after cancel")
+	}
+}
+
+func TestRemindersHandler(t *testing.T) {
+	store := NewEventStore()
+	start := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	store.CreateEvent(1, Event{Name: "Standup", Date: start, Reminders: []int{5}})
+	scheduler := newTestScheduler(store, &fakeNotifier{}, start.Add(-time.Hour))
+	scheduler.tick(context.Background(), start)
+
+	response := getQuery(remindersHandler(scheduler), "/reminders", url.Values{"user_id": {"1"}})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, response.Code)
+	}
+	var body struct {
+		Result []Delivery `json:"result"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Result) != 1 || body.Result[0].State != DeliverySent || body.Result[0].MinutesBefore != 5 {
+		t.Errorf("Unexpected deliveries: %s", response.Body)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Схемы часто встречающихся параметров.
+var (
+	idSchema       = paramSchema{Type: "integer", Minimum: intPtr(1)}
+	dateSchema     = paramSchema{Type: "string", Format: formatDate}
+	clockSchema    = paramSchema{Type: "string", Format: formatClock}
+	durationSchema = paramSchema{Type: "string", Format: formatDuration}
+	tzSchema       = paramSchema{Type: "string", Format: formatTimeZone}
+	boolSchema     = paramSchema{Type: "boolean"}
+	stringSchema   = paramSchema{Type: "string"}
+	tagsSchema     = paramSchema{
+		Type:     "array",
+		Items:    &paramSchema{Type: "string", Format: formatTag},
+		MaxItems: maxTags,
+		Reason:   fmt.Sprintf("must be comma-separated tags of 1 to %d letters, digits, '-' or '_'", maxTagLength),
+	}
+)
+
+// userParam — пользователь, с календарем которого выполняется операция.
+var userParam = param{Name: "user_id", Required: true, Schema: idSchema, Description: "ID пользователя, с календарем которого выполняется операция."}
+
+// tzParam — часовой пояс, в котором заданы даты запроса.
+var tzParam = param{Name: "tz", Schema: tzSchema, Description: "Часовой пояс IANA, в котором заданы даты; по умолчанию UTC."}
+
+// eventFormParams возвращает параметры /create_event и /update_event.
+func eventFormParams(update bool) []param {
+	params := []param{userParam}
+	if update {
+		params = append(params,
+			param{Name: "event_id", Required: true, Schema: idSchema, Description: "ID изменяемого события."},
+			param{Name: "version", Schema: idSchema, Description: "Ожидаемая версия события; обязательна, если не передан заголовок If-Match."},
+			param{Name: "If-Match", In: inHeader, Schema: stringSchema, Description: "ETag события, полученный при его чтении или изменении."},
+		)
+	}
+	return append(params,
+		param{Name: "date", Required: true, Schema: dateSchema, Description: "Дата начала события."},
+		param{Name: "end_date", Schema: dateSchema, Description: "Дата окончания события (для события на весь день — последний день включительно)."},
+		param{Name: "all_day", Schema: boolSchema, Description: "Событие на весь день."},
+		tzParam,
+		param{Name: "time", Schema: clockSchema, Description: "Время начала; по умолчанию 00:00."},
+		param{Name: "end_time", Schema: clockSchema, Description: "Время окончания."},
+		param{Name: "duration", Schema: durationSchema, Description: "Длительность события; исключает end_time."},
+		param{Name: "name", Required: true, Schema: stringSchema, Description: "Название события."},
+		param{Name: "rrule", Schema: stringSchema, Description: "Правило повторения RRULE, например FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10."},
+		param{Name: "exdate", Schema: paramSchema{
+			Type:   "array",
+			Items:  &dateSchema,
+			Reason: "must be comma-separated dates in YYYY-MM-DD format",
+		}, Description: "Даты, в которые повторение пропускается; требует rrule."},
+		param{Name: "reminders", Schema: paramSchema{
+			Type:     "array",
+			Items:    &paramSchema{Type: "integer", Minimum: intPtr(0), Maximum: intPtr(maxReminderMinutes)},
+			MaxItems: maxReminders,
+			Reason:   fmt.Sprintf("must be comma-separated minutes from 0 to %d", maxReminderMinutes),
+		}, Description: "За сколько минут до начала напомнить о событии."},
+		param{Name: "attendees", Schema: paramSchema{
+			Type:     "array",
+			Items:    &idSchema,
+			MaxItems: maxAttendees,
+			Reason:   "must be comma-separated user IDs",
+		}, Description: "ID приглашенных пользователей."},
+		param{Name: "tags", Schema: tagsSchema, Description: "Теги события."},
+		param{Name: "on_conflict", Schema: paramSchema{Type: "string", Enum: []string{"warn", "reject"}}, Description: "Что делать при пересечении с другими событиями: сохранить и перечислить пересечения (warn) или отклонить (reject)."},
+	)
+}
+
+// periodParams возвращает параметры /events_for_day, /events_for_week и /events_for_month.
+func periodParams() []param {
+	return []param{
+		userParam,
+		param{Name: "date", Required: true, Schema: dateSchema, Description: "Любая дата периода."},
+		tzParam,
+	}
+}
+
+// routeDeps — зависимости обработчиков API.
+type routeDeps struct {
+	store     Storage
+	scheduler *Scheduler
+	broker    *ChangeBroker
+	metrics   *Metrics
+	health    *Health
+}
+
+// apiRoutes возвращает описание всех методов API, включая /openapi.json.
+func apiRoutes(d routeDeps) []route {
+	routes := []route{
+		{
+			Path: "/users/create", Method: http.MethodPost, Summary: "Создать пользователя (устаревший метод)",
+			Body:     &content{MediaType: "application/json", Schema: 0},
+			Response: content{Status: http.StatusCreated},
+			Handler:  createUserEventHandler(d.store),
+		},
+		{
+			Path: "/events/create", Method: http.MethodPost, Summary: "Создать событие из JSON (устаревший метод)",
+			Body: &content{MediaType: "application/json", Schema: struct {
+				UserID int   `json:"userId"`
+				Event  Event `json:"event"`
+			}{}},
+			Response: content{Status: http.StatusCreated, MediaType: "application/json", Schema: Event{}},
+			Handler:  createEventHandler(d.store),
+		},
+		{
+			Path: "/events/get", Method: http.MethodGet, Summary: "Все события пользователя (устаревший метод)",
+			Params: []param{
+				{Name: "userId", Required: true, Schema: paramSchema{Type: "integer"}, Description: "ID пользователя."},
+			},
+			Response: content{Status: http.StatusOK, MediaType: "application/json", Schema: []Event{}},
+			Handler:  getUserEventsHandler(d.store),
+		},
+		{
+			Path: "/events/contains", Method: http.MethodGet, Summary: "Есть ли событие у пользователя (устаревший метод)",
+			Params: []param{
+				{Name: "userId", Required: true, Schema: paramSchema{Type: "integer"}, Description: "ID пользователя."},
+				{Name: "eventId", Required: true, Schema: paramSchema{Type: "integer"}, Description: "ID события."},
+			},
+			Response: content{Status: http.StatusOK, MediaType: "application/json", Schema: false},
+			Handler:  containsEventHandler(d.store),
+		},
+		{
+			Path: "/events/stream", Method: http.MethodGet, Summary: "Поток изменений календаря (server-sent events)",
+			Params: []param{
+				userParam,
+				{Name: "Last-Event-ID", In: inHeader, Schema: paramSchema{Type: "integer", Minimum: intPtr(0), Reason: "must be a change number"}, Description: "Номер последнего полученного изменения для продолжения потока."},
+			},
+			Response: content{Status: http.StatusOK, MediaType: "text/event-stream"},
+			Handler:  streamEventsHandler(d.store, d.broker),
+		},
+		{
+			Path: "/create_event", Method: http.MethodPost, Summary: "Создать событие",
+			Params:   eventFormParams(false),
+			Response: content{Status: http.StatusOK, MediaType: "application/json", Schema: eventResponse{}},
+			Handler:  createEventFormHandler(d.store),
+		},
+		{
+			Path: "/update_event", Method: http.MethodPost, Summary: "Изменить событие",
+			Params:   eventFormParams(true),
+			Response: content{Status: http.StatusOK, MediaType: "application/json", Schema: eventResponse{}},
+			Handler:  updateEventFormHandler(d.store),
+		},
+		{
+			Path: "/delete_event", Method: http.MethodPost, Summary: "Удалить событие",
+			Params: []param{
+				userParam,
+				{Name: "event_id", Required: true, Schema: idSchema, Description: "ID удаляемого события."},
+				{Name: "version", Schema: idSchema, Description: "Ожидаемая версия события; обязательна, если не передан заголовок If-Match."},
+				{Name: "If-Match", In: inHeader, Schema: stringSchema, Description: "ETag события."},
+			},
+			Response: result(""),
+			Handler:  deleteEventFormHandler(d.store),
+		},
+		{
+			Path: "/events_for_day", Method: http.MethodGet, Summary: "События за день",
+			Params: periodParams(), Response: result([]Event{}),
+			Handler: eventsForPeriodHandler(d.store, dayPeriod),
+		},
+		{
+			Path: "/events_for_week", Method: http.MethodGet, Summary: "События за неделю (с понедельника)",
+			Params: periodParams(), Response: result([]Event{}),
+			Handler: eventsForPeriodHandler(d.store, weekPeriod),
+		},
+		{
+			Path: "/events_for_month", Method: http.MethodGet, Summary: "События за месяц",
+			Params: periodParams(), Response: result([]Event{}),
+			Handler: eventsForPeriodHandler(d.store, monthPeriod),
+		},
+		{
+			Path: "/free_busy", Method: http.MethodGet, Summary: "Занятые и свободные интервалы",
+			Params: []param{
+				userParam,
+				{Name: "date", Required: true, Schema: dateSchema, Description: "Первый день диапазона."},
+				{Name: "end_date", Schema: dateSchema, Description: fmt.Sprintf("Последний день диапазона включительно, не дальше %d дней от date.", maxRangeDays)},
+				tzParam,
+				{Name: "min_duration", Schema: durationSchema, Description: "Наименьшая длительность свободного промежутка."},
+			},
+			Response: result(FreeBusy{}),
+			Handler:  freeBusyHandler(d.store),
+		},
+		{
+			Path: "/search", Method: http.MethodGet, Summary: "Поиск событий",
+			Params: []param{
+				userParam,
+				{Name: "q", Schema: stringSchema, Description: "Слова, которые должны встречаться в названии события."},
+				{Name: "name", Schema: stringSchema, Description: "Подстрока названия события без учета регистра."},
+				{Name: "tags", Schema: tagsSchema, Description: "Теги, которые должны быть у события."},
+				{Name: "date", Schema: dateSchema, Description: "Первый день диапазона; без него ищутся события за все время."},
+				{Name: "end_date", Schema: dateSchema, Description: "Последний день диапазона включительно."},
+				tzParam,
+				{Name: "sort", Schema: paramSchema{Type: "string", Enum: []string{"date", "-date", "name", "-name"}}, Description: "Порядок результатов; по умолчанию date."},
+				{Name: "limit", Schema: paramSchema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(maxSearchLimit)}, Description: fmt.Sprintf("Размер страницы; по умолчанию %d.", defaultSearchLimit)},
+				{Name: "cursor", Schema: stringSchema, Description: "Курсор следующей страницы из next_cursor."},
+			},
+			Response: result(SearchPage{}),
+			Handler:  searchHandler(d.store),
+		},
+		{
+			Path: "/export_ics", Method: http.MethodGet, Summary: "Экспорт календаря в iCalendar",
+			Params: []param{
+				userParam,
+				{Name: "event_id", Schema: idSchema, Description: "Экспортировать только это событие."},
+			},
+			Response: content{Status: http.StatusOK, MediaType: "text/calendar"},
+			Handler:  exportICalHandler(d.store),
+		},
+		{
+			Path: "/import_ics", Method: http.MethodPost, Summary: "Импорт календаря iCalendar",
+			Params: []param{
+				{Name: "user_id", In: inQuery, Required: true, Schema: idSchema, Description: userParam.Description},
+			},
+			Body:     &content{MediaType: "text/calendar"},
+			Response: result(ImportResult{}),
+			Handler:  importICalHandler(d.store),
+		},
+		{
+			Path: "/reminders", Method: http.MethodGet, Summary: "Состояние доставки напоминаний",
+			Params:   []param{userParam},
+			Response: result([]Delivery{}),
+			Handler:  remindersHandler(d.scheduler),
+		},
+		{
+			Path: "/rsvp", Method: http.MethodPost, Summary: "Ответить на приглашение",
+			Params: []param{
+				{Name: "user_id", Required: true, Schema: idSchema, Description: "ID приглашенного пользователя."},
+				{Name: "organizer_id", Required: true, Schema: idSchema, Description: "ID организатора события."},
+				{Name: "event_id", Required: true, Schema: idSchema, Description: "ID события в календаре организатора."},
+				{Name: "status", Required: true, Schema: paramSchema{Type: "string", Enum: []string{StatusAccepted, StatusDeclined}}, Description: "Ответ на приглашение."},
+			},
+			Response: result(Event{}),
+			Handler:  rsvpHandler(d.store),
+		},
+		{
+			Path: "/share_calendar", Method: http.MethodPost, Summary: "Открыть или закрыть доступ к календарю",
+			Params: []param{
+				{Name: "user_id", Required: true, Schema: idSchema, Description: "ID владельца календаря."},
+				{Name: "grantee_id", Required: true, Schema: idSchema, Description: "ID пользователя, получающего доступ."},
+				{Name: "access", Required: true, Schema: paramSchema{Type: "string", Enum: []string{string(AccessRead), string(AccessWrite), "none"}}, Description: "Уровень доступа; none отзывает доступ."},
+			},
+			Response: result([]Share{}),
+			Handler:  shareCalendarHandler(d.store),
+		},
+		{
+			Path: "/calendar_shares", Method: http.MethodGet, Summary: "Кому открыт календарь",
+			Params:   []param{userParam},
+			Response: result([]Share{}),
+			Handler:  calendarSharesHandler(d.store),
+		},
+		{
+			Path: "/healthz", Method: http.MethodGet, Summary: "Процесс жив", Public: true,
+			Response: result(""),
+			Handler:  healthzHandler(),
+		},
+		{
+			Path: "/readyz", Method: http.MethodGet, Summary: "Сервер готов принимать запросы", Public: true,
+			Response: result(""),
+			Handler:  readyzHandler(d.health),
+		},
+		{
+			Path: "/metrics", Method: http.MethodGet, Summary: "Метрики в текстовом формате Prometheus", Public: true,
+			Response: content{Status: http.StatusOK, MediaType: "text/plain"},
+			Handler:  metricsHandler(d.metrics),
+		},
+		{
+			Path: "/openapi.json", Method: http.MethodGet, Summary: "Спецификация OpenAPI", Public: true,
+			Response: content{Status: http.StatusOK, MediaType: "application/json"},
+		},
+	}
+	// Спецификация описывает и сам /openapi.json, поэтому строится по
+	// готовому списку маршрутов.
+	routes[len(routes)-1].Handler = openAPIHandler(openAPISpec(routes))
+	return routes
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Размер страницы результатов /search.
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// tokenize разбивает текст на слова в нижнем регистре.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// postings — множество ID событий одного владельца.
+type postings map[int]struct{}
+
+// eventIndex — инвертированный индекс событий одного владельца: слова
+// названия и теги отображаются в ID событий, которые их содержат.
+type eventIndex struct {
+	words map[string]postings
+	tags  map[string]postings
+}
+
+// newEventIndex создает пустой индекс.
+func newEventIndex() *eventIndex {
+	return &eventIndex{words: make(map[string]postings), tags: make(map[string]postings)}
+}
+
+// add добавляет событие в индекс.
+func (idx *eventIndex) add(event Event) {
+	for _, word := range tokenize(event.Name) {
+		addPosting(idx.words, word, event.ID)
+	}
+	for _, tag := range event.Tags {
+		addPosting(idx.tags, tag, event.ID)
+	}
+}
+
+// remove удаляет событие из индекса.
+func (idx *eventIndex) remove(event Event) {
+	for _, word := range tokenize(event.Name) {
+		removePosting(idx.words, word, event.ID)
+	}
+	for _, tag := range event.Tags {
+		removePosting(idx.tags, tag, event.ID)
+	}
+}
+
+func addPosting(index map[string]postings, key string, eventID int) {
+	if index[key] == nil {
+		index[key] = make(postings)
+	}
+	index[key][eventID] = struct{}{}
+}
+
+func removePosting(index map[string]postings, key string, eventID int) {
+	delete(index[key], eventID)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// lookup возвращает ID событий, содержащих все слова words и все теги tags.
+// ok равно false, если условий нет и индекс не сужает поиск. Индекс
+// пользователя без событий — nil.
+func (idx *eventIndex) lookup(words, tags []string) (ids postings, ok bool) {
+	if len(words) == 0 && len(tags) == 0 {
+		return nil, false
+	}
+	if idx == nil {
+		return postings{}, true
+	}
+	var sets []postings
+	for _, word := range words {
+		sets = append(sets, idx.words[word])
+	}
+	for _, tag := range tags {
+		sets = append(sets, idx.tags[tag])
+	}
+	// Пересечение начинается с самого короткого списка.
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	ids = make(postings, len(sets[0]))
+	for id := range sets[0] {
+		ids[id] = struct{}{}
+	}
+	for _, set := range sets[1:] {
+		for id := range ids {
+			if _, found := set[id]; !found {
+				delete(ids, id)
+			}
+		}
+	}
+	return ids, true
+}
+
+// SearchQuery — условия поиска событий. Пустые условия не ограничивают поиск.
+type SearchQuery struct {
+	// Words — слова, которые все должны встречаться в названии события.
+	Words []string
+	// Name — подстрока названия без учета регистра.
+	Name string
+	// Tags — теги, которые все должны быть у события.
+	Tags []string
+	// From и To ограничивают поиск событиями, хотя бы один экземпляр которых
+	// пересекается с [From, To); нулевой To отключает ограничение.
+	From, To time.Time
+}
+
+// matches проверяет событие на соответствие всем условиям запроса.
+func (q SearchQuery) matches(event Event) bool {
+	if len(q.Words) > 0 {
+		words := make(map[string]bool)
+		for _, word := range tokenize(event.Name) {
+			words[word] = true
+		}
+		for _, word := range q.Words {
+			if !words[word] {
+				return false
+			}
+		}
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(event.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		i := sort.SearchStrings(event.Tags, tag)
+		if i == len(event.Tags) || event.Tags[i] != tag {
+			return false
+		}
+	}
+	if !q.To.IsZero() && len(event.occurrencesBetween(q.From, q.To)) == 0 {
+		return false
+	}
+	return true
+}
+
+// searchOrder — порядок результатов поиска.
+type searchOrder struct {
+	field string
+	desc  bool
+}
+
+// parseSearchOrder разбирает параметр sort: date, -date, name или -name.
+func parseSearchOrder(s string) (searchOrder, error) {
+	order := searchOrder{field: strings.TrimPrefix(s, "-"), desc: strings.HasPrefix(s, "-")}
+	switch order.field {
+	case "":
+		return searchOrder{field: "date"}, nil
+	case "date", "name":
+		return order, nil
+	default:
+		return order, &paramError{name: "sort", reason: "must be date, -date, name or -name"}
+	}
+}
+
+func (o searchOrder) String() string {
+	if o.desc {
+		return "-" + o.field
+	}
+	return o.field
+}
+
+// less задает строгий порядок результатов: при равенстве ключа сортировки
+// события упорядочиваются по организатору и ID.
+func (o searchOrder) less(a, b Event) bool {
+	if o.desc {
+		a, b = b, a
+	}
+	if o.field == "name" {
+		if an, bn := strings.ToLower(a.Name), strings.ToLower(b.Name); an != bn {
+			return an < bn
+		}
+	}
+	if !a.Date.Equal(b.Date) {
+		return a.Date.Before(b.Date)
+	}
+	if a.Organizer != b.Organizer {
+		return a.Organizer < b.Organizer
+	}
+	return a.ID < b.ID
+}
+
+// searchCursor — позиция последнего события страницы.
+type searchCursor struct {
+	Sort      string    `json:"s"`
+	Date      time.Time `json:"d"`
+	Name      string    `json:"n,omitempty"`
+	Organizer int       `json:"o"`
+	ID        int       `json:"i"`
+}
+
+// encodeCursor возвращает непрозрачный курсор, указывающий на событие.
+func encodeCursor(order searchOrder, event Event) string {
+	cursor := searchCursor{Sort: order.String(), Date: event.Date, Organizer: event.Organizer, ID: event.ID}
+	if order.field == "name" {
+		cursor.Name = event.Name
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор, выданный для того же порядка сортировки.
+func decodeCursor(s string, order searchOrder) (Event, error) {
+	invalid := &paramError{name: "cursor", reason: "is invalid or was issued for another sort order"}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Event{}, invalid
+	}
+	var cursor searchCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != order.String() {
+		return Event{}, invalid
+	}
+	return Event{Date: cursor.Date, Name: cursor.Name, Organizer: cursor.Organizer, ID: cursor.ID}, nil
+}
+
+// SearchPage — страница результатов поиска.
+type SearchPage struct {
+	Events []Event `json:"events"`
+	// NextCursor передается в параметре cursor для получения следующей
+	// страницы; пустой, если страница последняя.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// paginate упорядочивает события и возвращает не больше limit событий,
+// следующих за after (если after не nil).
+func paginate(events []Event, order searchOrder, after *Event, limit int) SearchPage {
+	sort.Slice(events, func(i, j int) bool { return order.less(events[i], events[j]) })
+	if after != nil {
+		start := sort.Search(len(events), func(i int) bool { return order.less(*after, events[i]) })
+		events = events[start:]
+	}
+	page := SearchPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = encodeCursor(order, page.Events[limit-1])
+	}
+	return page
+}
+
+// searchHandler обрабатывает GET /search: поиск событий в календаре user_id.
+// Параметры: q — слова названия, name — подстрока названия, tags — теги через
+// запятую, date и end_date — диапазон дат (end_date включительно) в поясе tz,
+// sort — date, -date, name или -name, limit и cursor — постраничный вывод.
+func searchHandler(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodGet)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		query := SearchQuery{Words: tokenize(values.Get("q")), Name: strings.TrimSpace(values.Get("name"))}
+		if query.Tags, err = parseTagsParam(values, "tags"); err != nil {
+			writeError(w, err)
+			return
+		}
+		if query.From, query.To, err = parseSearchRange(values); err != nil {
+			writeError(w, err)
+			return
+		}
+		order, err := parseSearchOrder(values.Get("sort"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		limit := defaultSearchLimit
+		if raw := values.Get("limit"); raw != "" {
+			if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxSearchLimit {
+				writeError(w, &paramError{name: "limit", reason: fmt.Sprintf("must be an integer from 1 to %d", maxSearchLimit)})
+				return
+			}
+		}
+		var after *Event
+		if raw := values.Get("cursor"); raw != "" {
+			event, err := decodeCursor(raw, order)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			after = &event
+		}
+		if err := authorize(r, store, userID, AccessRead); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		events, err := store.SearchEvents(userID, query)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResult(w, paginate(events, order, after, limit))
+	}
+}
+
+// parseSearchRange читает необязательный диапазон дат поиска: date и
+// end_date (включительно, по умолчанию равна date) в часовом поясе tz.
+func parseSearchRange(values url.Values) (from, to time.Time, err error) {
+	if values.Get("date") == "" {
+		if values.Get("end_date") != "" {
+			return from, to, &paramError{name: "date", reason: "is required with end_date"}
+		}
+		return from, to, nil
+	}
+	loc, err := parseLocationParam(values, "tz")
+	if err != nil {
+		return from, to, err
+	}
+	if from, err = parseDateParam(values, "date", loc); err != nil {
+		return from, to, err
+	}
+	last := from
+	if values.Get("end_date") != "" {
+		if last, err = parseDateParam(values, "end_date", loc); err != nil {
+			return from, to, err
+		}
+	}
+	if last.Before(from) {
+		return from, to, &paramError{name: "end_date", reason: "must not be before date"}
+	}
+	to = last.AddDate(0, 0, 1)
+	if to.After(from.AddDate(0, 0, maxRangeDays)) {
+		return from, to, &paramError{name: "end_date", reason: fmt.Sprintf("range must not exceed %d days", maxRangeDays)}
+	}
+	return from, to, nil
+}
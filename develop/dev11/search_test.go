@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestEvent_NormalizeTags(t *testing.T) {
+	event := Event{Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC), Tags: []string{" Work", "1-on-1", "work", "личное"}}
+	if err := event.normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if len(event.Tags) != 3 || event.Tags[0] != "1-on-1" || event.Tags[1] != "work" || event.Tags[2] != "личное" {
+		t.Errorf("Unexpected tags: %q", event.Tags)
+	}
+	for _, tags := range [][]string{{""}, {"two words"}, {"a,b"}, {"x123456789012345678901234567890123"}} {
+		event.Tags = tags
+		if err := event.normalize(); err == nil {
+			t.Errorf("Expected error for tags %q", tags)
+		}
+	}
+}
+
+// searchNames возвращает названия найденных событий.
+func searchNames(t *testing.T, store Storage, userID int, query SearchQuery) []string {
+	t.Helper()
+	events, err := store.SearchEvents(userID, query)
+	if err != nil {
+		t.Fatalf("SearchEvents: %v", err)
+	}
+	page := paginate(events, searchOrder{field: "name"}, nil, maxSearchLimit)
+	names := make([]string, 0, len(page.Events))
+	for _, event := range page.Events {
+		names = append(names, event.Name)
+	}
+	return names
+}
+
+func TestEventStore_SearchEvents(t *testing.T) {
+	store := NewEventStore()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	weekly, _ := ParseRRule("FREQ=WEEKLY;COUNT=10")
+	store.CreateEvent(1, Event{Name: "Team standup", Date: date, Tags: []string{"work"}, Recurrence: weekly})
+	store.CreateEvent(1, Event{Name: "Dentist", Date: date.AddDate(0, 0, 1), Tags: []string{"personal", "health"}})
+	retro, _ := store.CreateEvent(1, Event{Name: "Team retro", Date: date.AddDate(0, 1, 0), Tags: []string{"work"}})
+	store.CreateEvent(2, Event{Name: "Team offsite", Date: date, Tags: []string{"work"}, Attendees: []Attendee{{UserID: 1}}})
+	store.CreateEvent(3, Event{Name: "Team secret", Date: date, Tags: []string{"work"}})
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  string
+	}{
+		{"all", SearchQuery{}, "[Dentist Team offsite Team retro Team standup]"},
+		{"word", SearchQuery{Words: tokenize("TEAM")}, "[Team offsite Team retro Team standup]"},
+		{"words", SearchQuery{Words: tokenize("team, retro")}, "[Team retro]"},
+		{"unknown word", SearchQuery{Words: []string{"lunch"}}, "[]"},
+		{"substring", SearchQuery{Name: "STAND"}, "[Team standup]"},
+		{"tags", SearchQuery{Tags: []string{"work"}}, "[Team offsite Team retro Team standup]"},
+		{"tags and words", SearchQuery{Words: []string{"dentist"}, Tags: []string{"health", "personal"}}, "[Dentist]"},
+		// Восьмое повторение еженедельного события приходится на 28 октября.
+		{"recurring in range", SearchQuery{From: date.AddDate(0, 0, 49), To: date.AddDate(0, 0, 50)}, "[Team standup]"},
+		{"range", SearchQuery{From: date.AddDate(0, 0, 1), To: date.AddDate(0, 0, 2)}, "[Dentist]"},
+	}
+	for _, test := range tests {
+		if got := searchNames(t, store, 1, test.query); fmt.Sprint(got) != test.want {
+			t.Errorf("%s: expected %s, got %v", test.name, test.want, got)
+		}
+	}
+
+	// Индекс обновляется при изменении и удалении событий.
+	store.UpdateEvent(1, Event{ID: retro.ID, Name: "Team review", Date: retro.Date})
+	if got := searchNames(t, store, 1, SearchQuery{Words: []string{"retro"}}); len(got) != 0 {
+		t.Errorf("Renamed event is still found by its old name: %v", got)
+	}
+	if got := searchNames(t, store, 1, SearchQuery{Words: []string{"review"}, Tags: []string{"work"}}); len(got) != 0 {
+		t.Errorf("Event is still found by a removed tag: %v", got)
+	}
+	store.DeleteEvent(1, retro.ID, 0)
+	if got := searchNames(t, store, 1, SearchQuery{Words: []string{"review"}}); len(got) != 0 {
+		t.Errorf("Deleted event is still found: %v", got)
+	}
+	if got := searchNames(t, store, 4, SearchQuery{Words: []string{"team"}}); len(got) != 0 {
+		t.Errorf("Unknown user has results: %v", got)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	var events []Event
+	for i := 1; i <= 7; i++ {
+		events = append(events, Event{ID: i, Organizer: 1 + i%2, Name: string(rune('a' + i%3)), Date: date.Add(time.Duration(i%4) * time.Hour)})
+	}
+
+	for _, sort := range []string{"date", "-date", "name", "-name"} {
+		order, _ := parseSearchOrder(sort)
+		full := paginate(append([]Event(nil), events...), order, nil, len(events))
+		var walked []Event
+		var after *Event
+		for pages := 0; pages < len(events); pages++ {
+			page := paginate(append([]Event(nil), events...), order, after, 3)
+			walked = append(walked, page.Events...)
+			if page.NextCursor == "" {
+				break
+			}
+			cursor, err := decodeCursor(page.NextCursor, order)
+			if err != nil {
+				t.Fatalf("%s: decodeCursor: %v", sort, err)
+			}
+			after = &cursor
+		}
+		if len(walked) != len(full.Events) {
+			t.Fatalf("%s: expected %d events across pages, got %d", sort, len(full.Events), len(walked))
+		}
+		for i := range walked {
+			if walked[i].ID != full.Events[i].ID {
+				t.Errorf("%s: page walk differs from full order at %d: %d != %d", sort, i, walked[i].ID, full.Events[i].ID)
+			}
+		}
+	}
+
+	cursor := encodeCursor(searchOrder{field: "date"}, events[0])
+	if _, err := decodeCursor(cursor, searchOrder{field: "name"}); err == nil {
+		t.Error("Expected error for cursor issued for another sort order")
+	}
+	if _, err := decodeCursor("!!!", searchOrder{field: "date"}); err == nil {
+		t.Error("Expected error for malformed cursor")
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	store := NewEventStore()
+	for day := 1; day <= 3; day++ {
+		store.CreateEvent(1, Event{Name: "Standup", Date: time.Date(2019, 9, day, 10, 0, 0, 0, time.UTC), Tags: []string{"work"}})
+	}
+	handler := searchHandler(store)
+
+	search := func(values url.Values) (int, SearchPage) {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/search?"+values.Encode(), nil))
+		var body struct {
+			Result SearchPage `json:"result"`
+		}
+		json.Unmarshal(response.Body.Bytes(), &body)
+		return response.Code, body.Result
+	}
+
+	values := url.Values{"user_id": {"1"}, "q": {"standup"}, "tags": {"Work"}, "sort": {"-date"}, "limit": {"2"}}
+	code, page := search(values)
+	if code != http.StatusOK || len(page.Events) != 2 || page.Events[0].Date.Day() != 3 || page.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %d %+v", code, page)
+	}
+	values.Set("cursor", page.NextCursor)
+	if code, page = search(values); code != http.StatusOK || len(page.Events) != 1 || page.Events[0].Date.Day() != 1 || page.NextCursor != "" {
+		t.Errorf("Unexpected last page: %d %+v", code, page)
+	}
+
+	if code, page = search(url.Values{"user_id": {"1"}, "date": {"2019-09-02"}, "end_date": {"2019-09-03"}}); code != http.StatusOK || len(page.Events) != 2 {
+		t.Errorf("Unexpected date range result: %d %+v", code, page)
+	}
+
+	for _, bad := range []url.Values{
+		{"user_id": {"1"}, "sort": {"size"}},
+		{"user_id": {"1"}, "limit": {"0"}},
+		{"user_id": {"1"}, "limit": {"1000"}},
+		{"user_id": {"1"}, "tags": {"a b"}},
+		{"user_id": {"1"}, "end_date": {"2019-09-03"}},
+		{"user_id": {"1"}, "date": {"2019-09-03"}, "end_date": {"2019-09-01"}},
+		{"user_id": {"1"}, "cursor": {"garbage"}},
+	} {
+		if code, _ := search(bad); code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %v, but got %d", http.StatusBadRequest, bad, code)
+		}
+	}
+}
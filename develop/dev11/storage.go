@@ -0,0 +1,634 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BusinessError описывает ошибку бизнес-логики календаря.
+type BusinessError struct {
+	msg string
+}
+
+func (e *BusinessError) Error() string {
+	return e.msg
+}
+
+// ErrEventNotFound возвращается, если у пользователя нет события с указанным ID.
+var ErrEventNotFound = &BusinessError{msg: "event not found"}
+
+// ErrVersionConflict возвращается, если событие было изменено после того,
+// как клиент получил указанную им версию.
+var ErrVersionConflict = &BusinessError{msg: "event version conflict"}
+
+// Storage описывает хранилище событий календаря. Реализации должны быть
+// безопасны для одновременного использования из нескольких горутин.
+type Storage interface {
+	// CreateUser регистрирует пользователя без событий.
+	CreateUser(userID int) error
+	// HasUser проверяет, зарегистрирован ли пользователь.
+	HasUser(userID int) bool
+	// Users возвращает ID зарегистрированных пользователей по возрастанию.
+	Users() []int
+	// CreateEvent создает событие для указанного пользователя, присваивая ему
+	// новый ID и версию 1, и возвращает сохраненное событие.
+	CreateEvent(userID int, event Event) (Event, error)
+	// UpdateEvent заменяет существующее событие пользователя и возвращает его
+	// с увеличенной версией. Если event.Version не равна нулю, она должна
+	// совпадать с текущей версией события, иначе возвращается ErrVersionConflict.
+	UpdateEvent(userID int, event Event) (Event, error)
+	// DeleteEvent удаляет событие пользователя. Ненулевая version должна
+	// совпадать с текущей версией события.
+	DeleteEvent(userID, eventID, version int) error
+	// ScheduleEvent создает (event.ID == 0) или изменяет событие, проверяя его
+	// пересечения с другими событиями пользователя и принятыми им приглашениями
+	// согласно policy. Возвращает
+	// сохраненное событие и пересекающиеся с ним экземпляры других событий;
+	// при ConflictReject и наличии пересечений возвращается *ConflictError.
+	ScheduleEvent(userID int, event Event, policy ConflictPolicy) (Event, []Event, error)
+	// RespondToInvitation сохраняет ответ приглашенного attendeeID на событие
+	// организатора и возвращает событие с увеличенной версией.
+	RespondToInvitation(organizerID, eventID, attendeeID int, status string) (Event, error)
+	// GetUserEvents возвращает все события пользователя, включая события
+	// других пользователей, на которые он приглашен и не отказался.
+	GetUserEvents(userID int) ([]Event, error)
+	// ContainsEvent проверяет наличие события у пользователя.
+	ContainsEvent(userID, eventID int) bool
+	// SearchEvents возвращает события пользователя (как GetUserEvents),
+	// удовлетворяющие запросу, в произвольном порядке.
+	SearchEvents(userID int, query SearchQuery) ([]Event, error)
+	// EventsBetween возвращает события пользователя (как GetUserEvents),
+	// пересекающиеся с полуинтервалом [from, to), разворачивая повторяющиеся события.
+	EventsBetween(userID int, from, to time.Time) ([]Event, error)
+	// ShareCalendar открывает календарь владельца другому пользователю;
+	// AccessNone отзывает доступ.
+	ShareCalendar(ownerID, granteeID int, access Access) error
+	// CalendarAccess возвращает уровень доступа пользователя к чужому календарю.
+	CalendarAccess(ownerID, granteeID int) Access
+	// CalendarShares возвращает пользователей, которым открыт календарь
+	// владельца, по возрастанию ID.
+	CalendarShares(ownerID int) []Share
+	// Stats возвращает размеры хранилища.
+	Stats() StoreStats
+	// OnChange регистрирует hook, вызываемый после каждого изменения событий,
+	// и возвращает номер последнего уже примененного изменения.
+	OnChange(hook ChangeHook) uint64
+}
+
+// ChangeNotification описывает примененное изменение события.
+type ChangeNotification struct {
+	Seq     uint64 `json:"seq"`
+	Op      string `json:"op"`
+	OwnerID int    `json:"owner_id"`
+	EventID int    `json:"event_id"`
+	// Event — событие после изменения, nil для удаления.
+	Event *Event `json:"event,omitempty"`
+	// Users — пользователи, в календарях которых изменение видно: владелец
+	// и приглашенные до и после изменения, по возрастанию ID.
+	Users []int `json:"-"`
+}
+
+// ChangeHook получает уведомления об изменениях в порядке их применения.
+// Hook вызывается под блокировкой хранилища, поэтому не должен блокироваться
+// и обращаться к хранилищу.
+type ChangeHook func(ChangeNotification)
+
+// StoreStats — размеры хранилища для метрик.
+type StoreStats struct {
+	Users  int `json:"users"`
+	Events int `json:"events"`
+	Shares int `json:"shares"`
+}
+
+// Share описывает доступ пользователя к чужому календарю.
+type Share struct {
+	UserID int    `json:"user_id"`
+	Access Access `json:"access"`
+}
+
+// Виды изменений хранилища.
+const (
+	opCreateUser  = "create_user"
+	opCreateEvent = "create"
+	opUpdateEvent = "update"
+	opDeleteEvent = "delete"
+	opShare       = "share"
+)
+
+// change описывает одно изменение состояния хранилища.
+type change struct {
+	Seq     uint64 `json:"seq"`
+	Op      string `json:"op"`
+	UserID  int    `json:"user_id"`
+	EventID int    `json:"event_id,omitempty"`
+	Event   *Event `json:"event,omitempty"`
+	Share   *Share `json:"share,omitempty"`
+}
+
+// changeLog получает каждое изменение до его применения к хранилищу.
+// Если запись в журнал не удалась, изменение не применяется.
+type changeLog interface {
+	append(c change) error
+}
+
+// EventStore представляет хранилище событий пользователя в памяти.
+type EventStore struct {
+	mu     sync.RWMutex
+	events map[int]map[int]Event
+	shares map[int]map[int]Access
+	// invites — события других пользователей, на которые приглашен пользователь.
+	invites map[int]map[eventRef]struct{}
+	// index — поисковые индексы событий по владельцам.
+	index  map[int]*eventIndex
+	nextID int
+	seq    uint64
+	log    changeLog
+	hooks  []ChangeHook
+}
+
+var _ Storage = (*EventStore)(nil)
+
+// NewEventStore создает новый экземпляр EventStore.
+func NewEventStore() *EventStore {
+	return &EventStore{
+		events:  make(map[int]map[int]Event),
+		shares:  make(map[int]map[int]Access),
+		invites: make(map[int]map[eventRef]struct{}),
+		index:   make(map[int]*eventIndex),
+		nextID:  1,
+	}
+}
+
+// CreateUser регистрирует пользователя, если он еще не зарегистрирован.
+func (store *EventStore) CreateUser(userID int) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.events[userID]; ok {
+		return nil
+	}
+	return store.commit(change{Op: opCreateUser, UserID: userID})
+}
+
+// HasUser проверяет, зарегистрирован ли пользователь.
+func (store *EventStore) HasUser(userID int) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	_, ok := store.events[userID]
+	return ok
+}
+
+// Users возвращает ID зарегистрированных пользователей по возрастанию.
+func (store *EventStore) Users() []int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	users := make([]int, 0, len(store.events))
+	for userID := range store.events {
+		users = append(users, userID)
+	}
+	sort.Ints(users)
+	return users
+}
+
+// Stats возвращает число пользователей, событий и открытых календарей.
+// Повторяющееся событие считается один раз.
+func (store *EventStore) Stats() StoreStats {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	stats := StoreStats{Users: len(store.events)}
+	for _, events := range store.events {
+		stats.Events += len(events)
+	}
+	for _, shares := range store.shares {
+		stats.Shares += len(shares)
+	}
+	return stats
+}
+
+// CreateEvent создает событие для указанного пользователя. ID и версию
+// события назначает хранилище; переданные значения игнорируются.
+func (store *EventStore) CreateEvent(userID int, event Event) (Event, error) {
+	event.ID = 0
+	event, _, err := store.ScheduleEvent(userID, event, ConflictIgnore)
+	return event, err
+}
+
+// UpdateEvent заменяет существующее событие указанного пользователя.
+// UID события сохраняется, если в новом значении он не задан.
+func (store *EventStore) UpdateEvent(userID int, event Event) (Event, error) {
+	if event.ID == 0 {
+		return Event{}, ErrEventNotFound
+	}
+	event, _, err := store.ScheduleEvent(userID, event, ConflictIgnore)
+	return event, err
+}
+
+// ScheduleEvent создает или изменяет событие, проверяя пересечения согласно
+// policy. Проверка и запись выполняются под одной блокировкой, поэтому два
+// одновременных запроса с ConflictReject не займут одно и то же время.
+func (store *EventStore) ScheduleEvent(userID int, event Event, policy ConflictPolicy) (Event, []Event, error) {
+	if err := event.normalize(); err != nil {
+		return Event{}, nil, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	op := opCreateEvent
+	var current Event
+	if event.ID != 0 {
+		var err error
+		if current, err = store.checkVersion(userID, event.ID, event.Version); err != nil {
+			return Event{}, nil, err
+		}
+		if event.UID == "" {
+			event.UID = current.UID
+		}
+		op, event.Version = opUpdateEvent, current.Version+1
+	} else {
+		event.ID, event.Version = store.nextID, 1
+	}
+	event.Organizer = userID
+	attendees, err := mergeAttendees(userID, event.Attendees, current.Attendees)
+	if err != nil {
+		return Event{}, nil, err
+	}
+	event.Attendees = attendees
+
+	var conflicts []Event
+	if policy != ConflictIgnore {
+		others := make([]Event, 0, len(store.events[userID]))
+		for _, other := range store.events[userID] {
+			others = append(others, other)
+		}
+		// Принятое приглашение занимает время так же, как собственное событие.
+		for _, invited := range store.invitedEvents(userID) {
+			if status, _ := invited.attendeeStatus(userID); status == StatusAccepted {
+				others = append(others, invited)
+			}
+		}
+		conflicts = conflictsWith(event, others)
+		if len(conflicts) > 0 && policy == ConflictReject {
+			return Event{}, conflicts, &ConflictError{Conflicts: conflicts}
+		}
+	}
+
+	if err := store.commit(change{Op: op, UserID: userID, Event: &event}); err != nil {
+		return Event{}, nil, err
+	}
+	return event, conflicts, nil
+}
+
+// DeleteEvent удаляет событие указанного пользователя.
+func (store *EventStore) DeleteEvent(userID, eventID, version int) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, err := store.checkVersion(userID, eventID, version); err != nil {
+		return err
+	}
+	return store.commit(change{Op: opDeleteEvent, UserID: userID, EventID: eventID})
+}
+
+// RespondToInvitation сохраняет ответ приглашенного на событие организатора.
+func (store *EventStore) RespondToInvitation(organizerID, eventID, attendeeID int, status string) (Event, error) {
+	switch status {
+	case StatusPending, StatusAccepted, StatusDeclined:
+	default:
+		return Event{}, &BusinessError{msg: fmt.Sprintf("unknown invitation status %q", status)}
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	event, err := store.checkVersion(organizerID, eventID, 0)
+	if err != nil {
+		return Event{}, err
+	}
+	if _, ok := event.attendeeStatus(attendeeID); !ok {
+		return Event{}, ErrNotInvited
+	}
+	attendees := make([]Attendee, len(event.Attendees))
+	for i, attendee := range event.Attendees {
+		if attendee.UserID == attendeeID {
+			attendee.Status = status
+		}
+		attendees[i] = attendee
+	}
+	event.Attendees = attendees
+	event.Version++
+	if err := store.commit(change{Op: opUpdateEvent, UserID: organizerID, Event: &event}); err != nil {
+		return Event{}, err
+	}
+	return event, nil
+}
+
+// checkVersion возвращает текущее событие, проверяя, что его версия равна
+// version (ноль отключает проверку). Вызывающий должен удерживать блокировку.
+func (store *EventStore) checkVersion(userID, eventID, version int) (Event, error) {
+	current, ok := store.events[userID][eventID]
+	if !ok {
+		return Event{}, ErrEventNotFound
+	}
+	if version != 0 && version != current.Version {
+		return Event{}, fmt.Errorf("%w: expected version %d, current version is %d", ErrVersionConflict, version, current.Version)
+	}
+	return current, nil
+}
+
+// GetUserEvents возвращает все события указанного пользователя.
+func (store *EventStore) GetUserEvents(userID int) ([]Event, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	userEvents, ok := store.events[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	events := make([]Event, 0, len(userEvents))
+	for _, event := range userEvents {
+		events = append(events, event)
+	}
+	events = append(events, store.invitedEvents(userID)...)
+	sortEvents(events)
+
+	return events, nil
+}
+
+// invitedEvents возвращает события других пользователей, на которые приглашен
+// пользователь, кроме отклоненных. Вызывающий должен удерживать блокировку.
+func (store *EventStore) invitedEvents(userID int) []Event {
+	var events []Event
+	for ref := range store.invites[userID] {
+		event := store.events[ref.ownerID][ref.eventID]
+		if status, _ := event.attendeeStatus(userID); status != StatusDeclined {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// ContainsEvent проверяет, содержится ли указанное событие у указанного пользователя.
+func (store *EventStore) ContainsEvent(userID, eventID int) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	if userEvents, ok := store.events[userID]; ok {
+		_, ok := userEvents[eventID]
+		return ok
+	}
+	return false
+}
+
+// SearchEvents возвращает события пользователя, удовлетворяющие запросу.
+// Собственные события сужаются по индексу слов и тегов, события, на которые
+// пользователь приглашен, проверяются полностью.
+func (store *EventStore) SearchEvents(userID int, query SearchQuery) ([]Event, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events := make([]Event, 0)
+	own := store.events[userID]
+	if ids, ok := store.index[userID].lookup(query.Words, query.Tags); ok {
+		for id := range ids {
+			if event := own[id]; query.matches(event) {
+				events = append(events, event)
+			}
+		}
+	} else {
+		for _, event := range own {
+			if query.matches(event) {
+				events = append(events, event)
+			}
+		}
+	}
+	for _, event := range store.invitedEvents(userID) {
+		if query.matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// EventsBetween возвращает события пользователя, пересекающиеся с полуинтервалом
+// [from, to), отсортированные по дате начала. Повторяющиеся события разворачиваются в отдельные
+// экземпляры для каждого повторения в интервале.
+func (store *EventStore) EventsBetween(userID int, from, to time.Time) ([]Event, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events := make([]Event, 0)
+	for _, event := range store.events[userID] {
+		events = append(events, event.occurrencesBetween(from, to)...)
+	}
+	for _, event := range store.invitedEvents(userID) {
+		events = append(events, event.occurrencesBetween(from, to)...)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// ShareCalendar открывает календарь владельца пользователю granteeID
+// с уровнем доступа access или отзывает доступ (AccessNone).
+func (store *EventStore) ShareCalendar(ownerID, granteeID int, access Access) error {
+	switch access {
+	case AccessNone, AccessRead, AccessWrite:
+	default:
+		return &BusinessError{msg: fmt.Sprintf("unknown access level %q", access)}
+	}
+	if ownerID == granteeID {
+		return &BusinessError{msg: "calendar cannot be shared with its owner"}
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.shares[ownerID][granteeID] == access {
+		return nil
+	}
+	return store.commit(change{Op: opShare, UserID: ownerID, Share: &Share{UserID: granteeID, Access: access}})
+}
+
+// CalendarAccess возвращает уровень доступа пользователя granteeID
+// к календарю владельца; владельцу доступна запись.
+func (store *EventStore) CalendarAccess(ownerID, granteeID int) Access {
+	if ownerID == granteeID {
+		return AccessWrite
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.shares[ownerID][granteeID]
+}
+
+// CalendarShares возвращает пользователей, которым открыт календарь владельца.
+func (store *EventStore) CalendarShares(ownerID int) []Share {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	shares := make([]Share, 0, len(store.shares[ownerID]))
+	for userID, access := range store.shares[ownerID] {
+		shares = append(shares, Share{UserID: userID, Access: access})
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].UserID < shares[j].UserID })
+	return shares
+}
+
+// commit записывает изменение в журнал, если он подключен, и применяет его.
+// Вызывающий должен удерживать блокировку на запись.
+func (store *EventStore) commit(c change) error {
+	c.Seq = store.seq + 1
+	if store.log != nil {
+		if err := store.log.append(c); err != nil {
+			return err
+		}
+	}
+	var previous Event
+	if c.Op == opUpdateEvent || c.Op == opDeleteEvent {
+		previous = store.events[c.UserID][c.eventID()]
+	}
+	store.apply(c)
+	if len(store.hooks) > 0 {
+		store.notify(c, previous)
+	}
+	return nil
+}
+
+// eventID возвращает ID события, которого касается изменение.
+func (c change) eventID() int {
+	if c.Event != nil {
+		return c.Event.ID
+	}
+	return c.EventID
+}
+
+// OnChange регистрирует hook, вызываемый после каждого изменения событий.
+// Изменения, восстановленные из журнала при запуске, hook не получает.
+func (store *EventStore) OnChange(hook ChangeHook) uint64 {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.hooks = append(store.hooks, hook)
+	return store.seq
+}
+
+// notify передает hook'ам примененное изменение события.
+func (store *EventStore) notify(c change, previous Event) {
+	if c.Op != opCreateEvent && c.Op != opUpdateEvent && c.Op != opDeleteEvent {
+		return
+	}
+	n := ChangeNotification{Seq: c.Seq, Op: c.Op, OwnerID: c.UserID, EventID: c.eventID()}
+	users := map[int]bool{c.UserID: true}
+	for _, attendee := range previous.Attendees {
+		users[attendee.UserID] = true
+	}
+	if c.Event != nil {
+		event := store.events[c.UserID][c.Event.ID]
+		n.Event = &event
+		for _, attendee := range event.Attendees {
+			users[attendee.UserID] = true
+		}
+	}
+	for userID := range users {
+		n.Users = append(n.Users, userID)
+	}
+	sort.Ints(n.Users)
+	for _, hook := range store.hooks {
+		hook(n)
+	}
+}
+
+// apply применяет изменение к состоянию хранилища без записи в журнал.
+// Вызывающий должен удерживать блокировку на запись.
+func (store *EventStore) apply(c change) {
+	switch c.Op {
+	case opCreateUser:
+		store.userEvents(c.UserID)
+	case opCreateEvent, opUpdateEvent:
+		store.putEvent(c.UserID, *c.Event)
+	case opDeleteEvent:
+		store.removeEvent(c.UserID, c.EventID)
+	case opShare:
+		store.userEvents(c.UserID)
+		store.applyShare(c.UserID, *c.Share)
+	}
+	store.seq = c.Seq
+}
+
+// putEvent сохраняет событие в календаре владельца и обновляет приглашения.
+// Вызывающий должен удерживать блокировку на запись.
+func (store *EventStore) putEvent(ownerID int, event Event) {
+	store.removeEvent(ownerID, event.ID)
+	event.Organizer = ownerID
+	store.userEvents(ownerID)[event.ID] = event
+	if store.index[ownerID] == nil {
+		store.index[ownerID] = newEventIndex()
+	}
+	store.index[ownerID].add(event)
+	if event.ID >= store.nextID {
+		store.nextID = event.ID + 1
+	}
+	for _, attendee := range event.Attendees {
+		// Приглашенный становится зарегистрированным пользователем.
+		store.userEvents(attendee.UserID)
+		if store.invites[attendee.UserID] == nil {
+			store.invites[attendee.UserID] = make(map[eventRef]struct{})
+		}
+		store.invites[attendee.UserID][eventRef{ownerID, event.ID}] = struct{}{}
+	}
+}
+
+// removeEvent удаляет событие из календаря владельца вместе с приглашениями.
+// Вызывающий должен удерживать блокировку на запись.
+func (store *EventStore) removeEvent(ownerID, eventID int) {
+	event, ok := store.events[ownerID][eventID]
+	if !ok {
+		return
+	}
+	for _, attendee := range event.Attendees {
+		delete(store.invites[attendee.UserID], eventRef{ownerID, eventID})
+	}
+	store.index[ownerID].remove(event)
+	delete(store.events[ownerID], eventID)
+}
+
+// applyShare изменяет доступ к календарю владельца.
+// Вызывающий должен удерживать блокировку на запись.
+func (store *EventStore) applyShare(ownerID int, share Share) {
+	if share.Access == AccessNone {
+		delete(store.shares[ownerID], share.UserID)
+		return
+	}
+	if store.shares[ownerID] == nil {
+		store.shares[ownerID] = make(map[int]Access)
+	}
+	store.shares[ownerID][share.UserID] = share.Access
+}
+
+// userEvents возвращает события пользователя, создавая для него запись при необходимости.
+// Вызывающий должен удерживать блокировку на запись.
+func (store *EventStore) userEvents(userID int) map[int]Event {
+	userEvents, ok := store.events[userID]
+	if !ok {
+		userEvents = make(map[int]Event)
+		store.events[userID] = userEvents
+	}
+	return userEvents
+}
+
+// sortEvents упорядочивает события по дате, а при равных датах — по ID.
+func sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Date.Equal(events[j].Date) {
+			return events[i].ID < events[j].ID
+		}
+		return events[i].Date.Before(events[j].Date)
+	})
+}
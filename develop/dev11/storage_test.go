@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventStore_CRUD(t *testing.T) {
+	store := NewEventStore()
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+
+	created, err := store.CreateEvent(1, Event{ID: 42, Version: 7, Name: "Standup", Date: date})
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	if created.ID != 1 || created.Version != 1 {
+		t.Errorf("Expected server-assigned ID 1 and version 1, got %d and %d", created.ID, created.Version)
+	}
+	updated, err := store.UpdateEvent(1, Event{ID: 1, Version: 1, Name: "Retro", Date: date})
+	if err != nil {
+		t.Fatalf("UpdateEvent: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("Expected version 2 after update, got %d", updated.Version)
+	}
+	events, _ := store.GetUserEvents(1)
+	if len(events) != 1 || events[0].Name != "Retro" {
+		t.Errorf("Unexpected events after update: %+v", events)
+	}
+
+	if _, err := store.UpdateEvent(1, Event{ID: 2}); err != ErrEventNotFound {
+		t.Errorf("Expected ErrEventNotFound, got %v", err)
+	}
+	if err := store.DeleteEvent(2, 1, 0); err != ErrEventNotFound {
+		t.Errorf("Expected ErrEventNotFound, got %v", err)
+	}
+	if _, err := store.UpdateEvent(1, Event{ID: 1, Version: 1, Name: "Stale", Date: date}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for stale update, got %v", err)
+	}
+	if err := store.DeleteEvent(1, 1, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for stale delete, got %v", err)
+	}
+	if err := store.DeleteEvent(1, 1, 2); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+	if store.ContainsEvent(1, 1) {
+		t.Errorf("Event was not deleted")
+	}
+	if !store.HasUser(1) {
+		t.Errorf("User should remain registered after deleting events")
+	}
+}
+
+func TestEventStore_EventsBetween(t *testing.T) {
+	store := NewEventStore()
+	base := time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		store.CreateEvent(1, Event{Date: base.AddDate(0, 0, 4-i)})
+	}
+
+	events, err := store.EventsBetween(1, base.AddDate(0, 0, 1), base.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("EventsBetween: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != 4 || events[1].ID != 3 {
+		t.Errorf("Unexpected events in range: %+v", events)
+	}
+}
+
+// Тест рассчитан на запуск с флагом -race.
+func TestEventStore_Concurrent(t *testing.T) {
+	store := NewEventStore()
+	date := time.Date(2019, 9, 9, 0, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				event, err := store.CreateEvent(worker%3, Event{Date: date})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				event.Name = "updated"
+				event, _ = store.UpdateEvent(worker%3, event)
+				store.EventsBetween(worker%3, date, date.AddDate(0, 0, 1))
+				store.ContainsEvent(worker%3, event.ID)
+				if i%2 == 0 {
+					store.DeleteEvent(worker%3, event.ID, event.Version)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	total := 0
+	for userID := 0; userID < 3; userID++ {
+		events, _ := store.GetUserEvents(userID)
+		total += len(events)
+	}
+	if total != 400 {
+		t.Errorf("Expected 400 events, got %d", total)
+	}
+}
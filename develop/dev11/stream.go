@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// streamHistory — число последних изменений, которые можно дослать
+	// клиенту, переподключившемуся с Last-Event-ID.
+	streamHistory = 1024
+	// streamBuffer — очередь уведомлений одного подписчика. Подписчик,
+	// не успевающий читать, отключается и переподключается с Last-Event-ID.
+	streamBuffer = 64
+	// streamHeartbeat — интервал комментариев, не дающих прокси закрыть
+	// простаивающее соединение.
+	streamHeartbeat = 15 * time.Second
+	// streamRetry — задержка переподключения, которую сообщают клиенту, в мс.
+	streamRetry = 3000
+)
+
+// subscription — подписка на изменения календаря пользователя.
+type subscription struct {
+	userID int
+	ch     chan ChangeNotification
+}
+
+// ChangeBroker раздает уведомления хранилища подписчикам потока
+// /events/stream и хранит последние изменения для возобновления потока.
+type ChangeBroker struct {
+	mu      sync.Mutex
+	history []ChangeNotification
+	lastSeq uint64
+	subs    map[*subscription]struct{}
+	closed  bool
+}
+
+// NewChangeBroker создает ChangeBroker и подписывает его на изменения store.
+func NewChangeBroker(store Storage) *ChangeBroker {
+	broker := &ChangeBroker{subs: make(map[*subscription]struct{})}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	broker.lastSeq = store.OnChange(broker.publish)
+	return broker
+}
+
+// publish сохраняет изменение в истории и рассылает его подписчикам,
+// в календарях которых оно видно.
+func (b *ChangeBroker) publish(n ChangeNotification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.history) == streamHistory {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:streamHistory-1]
+	}
+	b.history = append(b.history, n)
+	b.lastSeq = n.Seq
+
+	for sub := range b.subs {
+		if !n.affects(sub.userID) {
+			continue
+		}
+		select {
+		case sub.ch <- n:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// affects сообщает, видно ли изменение в календаре пользователя.
+func (n ChangeNotification) affects(userID int) bool {
+	for _, id := range n.Users {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe подписывает пользователя на изменения. Если resume равно true,
+// возвращаются изменения после lastID; ok равно false, если часть из них уже
+// вытеснена из истории или lastID неизвестен, — тогда клиент должен
+// перечитать календарь целиком.
+func (b *ChangeBroker) Subscribe(userID int, lastID uint64, resume bool) (sub *subscription, backlog []ChangeNotification, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &subscription{userID: userID, ch: make(chan ChangeNotification, streamBuffer)}
+	if b.closed {
+		close(sub.ch)
+		return sub, nil, true
+	}
+	b.subs[sub] = struct{}{}
+	if !resume {
+		return sub, nil, true
+	}
+
+	switch {
+	case lastID > b.lastSeq:
+		return sub, nil, false
+	case lastID == b.lastSeq:
+		return sub, nil, true
+	case len(b.history) == 0 || b.history[0].Seq > lastID+1:
+		return sub, nil, false
+	}
+	for _, n := range b.history {
+		if n.Seq > lastID && n.affects(userID) {
+			backlog = append(backlog, n)
+		}
+	}
+	return sub, backlog, true
+}
+
+// Unsubscribe отменяет подписку.
+func (b *ChangeBroker) Unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(sub)
+}
+
+// drop удаляет подписку и закрывает ее канал.
+func (b *ChangeBroker) drop(sub *subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Close завершает все потоки, например при остановке сервера, чтобы
+// Shutdown не ждал бесконечных ответов.
+func (b *ChangeBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
+
+// streamEventsHandler обрабатывает GET /events/stream: поток Server-Sent Events
+// с изменениями событий в календаре user_id. Каждое сообщение имеет id —
+// номер изменения, event — create, update или delete, и data — JSON
+// ChangeNotification. Клиент, переподключившийся с заголовком Last-Event-ID,
+// получает пропущенные изменения; если их уже нет в истории, приходит
+// сообщение reset, после которого календарь нужно перечитать.
+func streamEventsHandler(store Storage, broker *ChangeBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := parseForm(r, http.MethodGet)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		userID, err := parseIntParam(values, "user_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var lastID uint64
+		header := r.Header.Get("Last-Event-ID")
+		if header != "" {
+			if lastID, err = strconv.ParseUint(header, 10, 64); err != nil {
+				writeError(w, &paramError{name: "Last-Event-ID", reason: "must be a change number"})
+				return
+			}
+		}
+		if err := authorize(r, store, userID, AccessRead); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		// Поток живет дольше WriteTimeout сервера.
+		controller := http.NewResponseController(w)
+		controller.SetWriteDeadline(time.Time{})
+
+		sub, backlog, ok := broker.Subscribe(userID, lastID, header != "")
+		defer broker.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+		if !ok {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+		for _, n := range backlog {
+			writeChange(w, n)
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case n, ok := <-sub.ch:
+				if !ok {
+					return
+				}
+				writeChange(w, n)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeChange записывает уведомление в формате Server-Sent Events.
+func writeChange(w http.ResponseWriter, n ChangeNotification) {
+	data, _ := json.Marshal(n)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", n.Seq, n.Op, data)
+}
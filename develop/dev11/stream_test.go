@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStore_OnChange(t *testing.T) {
+	store := NewEventStore()
+	store.CreateUser(1)
+	var got []ChangeNotification
+	if seq := store.OnChange(func(n ChangeNotification) { got = append(got, n) }); seq != 1 {
+		t.Errorf("Expected OnChange to return applied seq 1, got %d", seq)
+	}
+
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	event, _ := store.CreateEvent(1, Event{Name: "Planning", Date: date, Attendees: []Attendee{{UserID: 2}}})
+	event, _ = store.UpdateEvent(1, Event{ID: event.ID, Name: "Planning", Date: date, Attendees: []Attendee{{UserID: 3}}})
+	store.ShareCalendar(1, 4, AccessRead)
+	store.DeleteEvent(1, event.ID, 0)
+
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 notifications, got %+v", got)
+	}
+	wantUsers := [][]int{{1, 2}, {1, 2, 3}, {1, 3}}
+	for i, op := range []string{opCreateEvent, opUpdateEvent, opDeleteEvent} {
+		n := got[i]
+		if n.Op != op || n.OwnerID != 1 || n.EventID != event.ID || fmt.Sprint(n.Users) != fmt.Sprint(wantUsers[i]) {
+			t.Errorf("Unexpected notification %d: %+v", i, n)
+		}
+	}
+	if got[1].Event == nil || got[1].Event.Version != 2 || got[2].Event != nil {
+		t.Errorf("Unexpected notification events: %+v, %+v", got[1].Event, got[2].Event)
+	}
+}
+
+func TestChangeBroker_Resume(t *testing.T) {
+	store := NewEventStore()
+	broker := NewChangeBroker(store)
+	date := time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)
+	first, _ := store.CreateEvent(1, Event{Name: "Planning", Date: date, Attendees: []Attendee{{UserID: 2}}})
+	store.CreateEvent(3, Event{Name: "Private", Date: date})
+	store.UpdateEvent(1, Event{ID: first.ID, Name: "Retro", Date: date, Attendees: []Attendee{{UserID: 2}}})
+
+	sub, backlog, ok := broker.Subscribe(2, 1, true)
+	defer broker.Unsubscribe(sub)
+	if !ok || len(backlog) != 1 || backlog[0].Seq != 3 || backlog[0].Event.Name != "Retro" {
+		t.Errorf("Unexpected backlog: %+v, %v", backlog, ok)
+	}
+	if _, _, ok := broker.Subscribe(2, 99, true); ok {
+		t.Error("Expected reset for unknown Last-Event-ID")
+	}
+
+	broker.history = broker.history[1:]
+	if _, _, ok := broker.Subscribe(2, 0, true); ok {
+		t.Error("Expected reset when history was truncated")
+	}
+}
+
+func TestChangeBroker_DropsSlowSubscriber(t *testing.T) {
+	store := NewEventStore()
+	broker := NewChangeBroker(store)
+	sub, _, _ := broker.Subscribe(1, 0, false)
+	for i := 0; i <= streamBuffer; i++ {
+		store.CreateEvent(1, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)})
+	}
+	n := 0
+	for range sub.ch {
+		n++
+	}
+	if n != streamBuffer {
+		t.Errorf("Expected %d buffered notifications before drop, got %d", streamBuffer, n)
+	}
+}
+
+// readSSE читает сообщения Server-Sent Events, пропуская комментарии.
+func readSSE(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	message := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if _, ok := message["retry"]; ok || len(message) == 0 {
+				message = make(map[string]string)
+				continue
+			}
+			return message
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		message[field] = value
+	}
+}
+
+func TestStreamEventsHandler(t *testing.T) {
+	store := NewEventStore()
+	broker := NewChangeBroker(store)
+	auth := NewAuthenticator(testSecret, time.Hour)
+	server := httptest.NewServer(chain(streamEventsHandler(store, broker), authMiddleware(auth)))
+	defer server.Close()
+
+	open := func(userID int, lastID string) *http.Response {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/events/stream?user_id=1", nil)
+		request.Header.Set("Authorization", "Bearer "+auth.IssueToken(userID))
+		if lastID != "" {
+			request.Header.Set("Last-Event-ID", lastID)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("open stream: %v", err)
+		}
+		return response
+	}
+
+	if response := open(2, ""); response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d for another user, but got %d", http.StatusForbidden, response.StatusCode)
+		response.Body.Close()
+	}
+
+	response := open(1, "")
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected stream response: %d %v", response.StatusCode, response.Header)
+	}
+	stream := bufio.NewReader(response.Body)
+	next := func() map[string]string { return readSSE(t, stream) }
+
+	// Подписка регистрируется до первого сброса ответа, поэтому после
+	// получения retry изменения уже не теряются.
+	if line, _ := stream.ReadString('\n'); !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("Expected retry field, got %q", line)
+	}
+	event, _ := store.CreateEvent(1, Event{Name: "Standup", Date: time.Date(2019, 9, 9, 10, 0, 0, 0, time.UTC)})
+	message := next()
+	var n ChangeNotification
+	if err := json.Unmarshal([]byte(message["data"]), &n); err != nil || message["event"] != "create" || message["id"] != "1" || n.Event == nil || n.Event.ID != event.ID {
+		t.Errorf("Unexpected create message: %v, %v", message, err)
+	}
+	store.DeleteEvent(1, event.ID, 0)
+	if message := next(); message["event"] != "delete" || message["id"] != "2" {
+		t.Errorf("Unexpected delete message: %v", message)
+	}
+	response.Body.Close()
+
+	// Переподключение досылает пропущенные изменения.
+	store.CreateEvent(1, Event{Name: "Retro", Date: time.Date(2019, 9, 10, 10, 0, 0, 0, time.UTC)})
+	response = open(1, "2")
+	defer response.Body.Close()
+	stream = bufio.NewReader(response.Body)
+	if message := next(); message["event"] != "create" || message["id"] != "3" {
+		t.Errorf("Unexpected resumed message: %v", message)
+	}
+
+	broker.Close()
+	if _, err := io.ReadAll(stream); err != nil {
+		t.Errorf("Expected stream to end after Close, got %v", err)
+	}
+}
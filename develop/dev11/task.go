@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -30,67 +38,56 @@ import (
 	4. Код должен проходить проверки go vet и golint.
 */
 
+// Event описывает событие календаря.
 type Event struct {
-	ID   int       `json:"id"`
-	Name string    `json:"name"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Organizer — ID пользователя, в календаре которого хранится событие.
+	Organizer int `json:"organizer,omitempty"`
+	// Date — начало события.
 	Date time.Time `json:"date"`
-}
-
-// EventStore представляет хранилище событий пользователя.
-type EventStore struct {
-	events map[int]map[int]Event
-}
-
-// NewEventStore создает новый экземпляр EventStore.
-func NewEventStore() *EventStore {
-	return &EventStore{
-		events: make(map[int]map[int]Event),
-	}
-}
-
-// CreateEvent создает событие для указанного пользователя.
-func (store *EventStore) CreateEvent(userID int, event Event) {
-	if _, ok := store.events[userID]; !ok {
-		store.events[userID] = make(map[int]Event)
-	}
-	store.events[userID][event.ID] = event
-}
-
-// GetUserEvents возвращает все события указанного пользователя.
-func (store *EventStore) GetUserEvents(userID int) ([]Event, error) {
-	userEvents, ok := store.events[userID]
-	if !ok {
-		return nil, nil
-	}
-
-	events := make([]Event, 0, len(userEvents))
-	for _, event := range userEvents {
-		events = append(events, event)
-	}
-
-	return events, nil
-}
-
-// ContainsEvent проверяет, содержится ли указанное событие у указанного пользователя.
-func (store *EventStore) ContainsEvent(userID, eventID int) bool {
-	if userEvents, ok := store.events[userID]; ok {
-		_, ok := userEvents[eventID]
-		return ok
-	}
-	return false
+	// End — конец события (не включительно); совпадает с Date у событий без длительности.
+	End time.Time `json:"end"`
+	// AllDay — событие на весь день: Date и End приходятся на полночь в часовом поясе события.
+	AllDay bool `json:"all_day,omitempty"`
+	// TimeZone — часовой пояс события из базы IANA; пустое значение означает UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+	// UID — внешний идентификатор события из импортированного календаря iCalendar.
+	UID string `json:"uid,omitempty"`
+	// Version увеличивается при каждом изменении события и используется для
+	// оптимистичной блокировки в update_event и delete_event.
+	Version int `json:"version"`
+	// Recurrence — правило повторения; nil для однократного события.
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	// Reminders — за сколько минут до начала каждого экземпляра события
+	// отправлять напоминания, по возрастанию.
+	Reminders []int `json:"reminders,omitempty"`
+	// Attendees — приглашенные пользователи по возрастанию ID.
+	Attendees []Attendee `json:"attendees,omitempty"`
+	// Tags — метки (категории) события в нижнем регистре, по алфавиту.
+	Tags []string `json:"tags,omitempty"`
 }
 
 // createUserEventHandler обрабатывает запрос на создание нового пользователя.
-func createUserEventHandler(store *EventStore) http.HandlerFunc {
+func createUserEventHandler(store Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var userID int
 		if err := json.NewDecoder(r.Body).Decode(&userID); err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			if isBodyTooLarge(err) {
+				writeError(w, err)
+				return
+			}
+			writeError(w, &paramError{name: "body", reason: "must be a JSON user ID"})
+			return
+		}
+		if err := authorizeOwner(r, userID); err != nil {
+			writeError(w, err)
 			return
 		}
 
-		if _, ok := store.events[userID]; !ok {
-			store.events[userID] = make(map[int]Event)
+		if err := store.CreateUser(userID); err != nil {
+			writeError(w, err)
+			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
@@ -98,7 +95,7 @@ func createUserEventHandler(store *EventStore) http.HandlerFunc {
 }
 
 // createEventHandler обрабатывает запрос на создание нового события.
-func createEventHandler(store *EventStore) http.HandlerFunc {
+func createEventHandler(store Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type CreateEventRequest struct {
 			UserID int   `json:"userId"`
@@ -107,28 +104,45 @@ func createEventHandler(store *EventStore) http.HandlerFunc {
 
 		var req CreateEventRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			if isBodyTooLarge(err) {
+				writeError(w, err)
+				return
+			}
+			writeError(w, &paramError{name: "body", reason: "must be a JSON object with userId and event"})
+			return
+		}
+		if err := authorize(r, store, req.UserID, AccessWrite); err != nil {
+			writeError(w, err)
 			return
 		}
 
-		store.CreateEvent(req.UserID, req.Event)
+		event, err := store.CreateEvent(req.UserID, req.Event)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(event)
 	}
 }
 
 // getUserEventsHandler обрабатывает запрос на получение событий пользователя.
-func getUserEventsHandler(store *EventStore) http.HandlerFunc {
+func getUserEventsHandler(store Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userIDStr := r.URL.Query().Get("userId")
-		userID, err := strconv.Atoi(userIDStr)
+		userID, err := legacyIntParam(r.URL.Query(), "userId")
 		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, userID, AccessRead); err != nil {
+			writeError(w, err)
 			return
 		}
 
 		events, err := store.GetUserEvents(userID)
 		if err != nil {
-			http.Error(w, "Failed to get user events", http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
 
@@ -137,19 +151,21 @@ func getUserEventsHandler(store *EventStore) http.HandlerFunc {
 }
 
 // containsEventHandler обрабатывает запрос на проверку наличия события у пользователя.
-func containsEventHandler(store *EventStore) http.HandlerFunc {
+func containsEventHandler(store Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userIDStr := r.URL.Query().Get("userId")
-		userID, err := strconv.Atoi(userIDStr)
+		query := r.URL.Query()
+		userID, err := legacyIntParam(query, "userId")
 		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			writeError(w, err)
 			return
 		}
-
-		eventIDStr := r.URL.Query().Get("eventId")
-		eventID, err := strconv.Atoi(eventIDStr)
+		eventID, err := legacyIntParam(query, "eventId")
 		if err != nil {
-			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			writeError(w, err)
+			return
+		}
+		if err := authorize(r, store, userID, AccessRead); err != nil {
+			writeError(w, err)
 			return
 		}
 
@@ -158,17 +174,117 @@ func containsEventHandler(store *EventStore) http.HandlerFunc {
 	}
 }
 
+// legacyIntParam читает обязательный целочисленный параметр устаревших
+// методов. В отличие от parseIntParam, ноль и отрицательные значения
+// допустимы, как и в описании этих маршрутов.
+func legacyIntParam(values url.Values, name string) (int, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return 0, &paramError{name: name, reason: "is required"}
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, &paramError{name: name, reason: "must be an integer"}
+	}
+	return n, nil
+}
+
 func main() {
-	store := NewEventStore()
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := runTokenCommand(os.Args[2:], os.Getenv, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger := newLogger(cfg.Log, os.Stderr)
+	slog.SetDefault(logger)
+
+	store, closeStore, err := openStorage(cfg.Storage)
+	if err != nil {
+		logger.Error("Failed to open storage", "err", err)
+		os.Exit(1)
+	}
+	defer closeStore()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheduler := NewScheduler(store, newNotifier(cfg.Reminders, logger), cfg.Reminders, logger)
+	var wg sync.WaitGroup
+	if scheduler.notifier != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.Run(ctx)
+		}()
+	}
+
+	broker := NewChangeBroker(store)
+	health := &Health{}
+	metrics := NewMetrics(store)
+	routes := apiRoutes(routeDeps{store: store, scheduler: scheduler, broker: broker, metrics: metrics, health: health})
 	mux := http.NewServeMux()
-	mux.HandleFunc("/users/create", createUserEventHandler(store))
-	mux.HandleFunc("/events/create", createEventHandler(store))
-	mux.HandleFunc("/events/get", getUserEventsHandler(store))
-	mux.HandleFunc("/events/contains", containsEventHandler(store))
-
-	log.Println("Server started")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		log.Fatal(err)
+	registerRoutes(mux, routes)
+
+	middlewares := []Middleware{requestIDMiddleware, loggingMiddleware(logger), metrics.middleware(mux), bodyLimitMiddleware(cfg.Limits, mux)}
+	if !cfg.Auth.Disabled {
+		auth := NewAuthenticator(cfg.Auth.Secret, time.Duration(cfg.Auth.TokenTTL))
+		middlewares = append(middlewares, authMiddleware(auth, publicPaths(routes)...))
+	} else {
+		logger.Warn("Authentication is disabled by auth.disabled: any client can access any calendar")
+	}
+	middlewares = append(middlewares, rateLimitMiddleware(NewRateLimiter(cfg.Limits), mux))
+
+	server := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      chain(mux, middlewares...),
+		ReadTimeout:  time.Duration(cfg.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.IdleTimeout),
+	}
+	server.RegisterOnShutdown(broker.Close)
+
+	// Shutdown ждет завершения обрабатываемых запросов, поэтому хранилище
+	// закрывается только после него.
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdown(server, health, time.Duration(cfg.ShutdownDelay), time.Duration(cfg.ShutdownTimeout), logger)
+	}()
+
+	health.SetReady(true)
+	logger.Info("Server started", "addr", cfg.Addr, "storage", cfg.Storage.Backend, "notifier", cfg.Reminders.Notifier)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Server stopped", "err", err)
+	}
+	// Планировщик останавливается вместе с сервером, в том числе если
+	// сервер не смог запуститься.
+	stop()
+	<-shutdownDone
+	wg.Wait()
+	logger.Info("Server stopped")
+}
+
+// shutdown останавливает сервер: /readyz начинает отвечать 503, через delay
+// сервер перестает принимать соединения и ждет завершения обрабатываемых
+// запросов не дольше timeout, после чего оставшиеся соединения закрываются.
+func shutdown(server *http.Server, health *Health, delay, timeout time.Duration, logger *slog.Logger) {
+	health.SetReady(false)
+	logger.Info("Shutting down", "delay", delay, "timeout", timeout)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Graceful shutdown timed out, closing connections", "err", err)
+		server.Close()
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -75,3 +76,34 @@ func TestCreateUserHandler_EmptyRequestBody(t *testing.T) {
 		t.Errorf("Unexpected user events in the store")
 	}
 }
+
+func TestLegacyHandlers_JSONErrors(t *testing.T) {
+	routes, _ := testRoutes()
+	mux := http.NewServeMux()
+	registerRoutes(mux, routes)
+	store := NewEventStore()
+
+	tests := []struct {
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		want    string
+	}{
+		{createUserEventHandler(store), http.MethodPost, "/users/create", `"invalid"`, `invalid parameter "body": must be a JSON user ID`},
+		{createEventHandler(store), http.MethodPost, "/events/create", `[]`, `invalid parameter "body": must be a JSON object with userId and event`},
+		{getUserEventsHandler(store), http.MethodGet, "/events/get?userId=abc", "", `invalid parameter "userId": must be an integer`},
+		{containsEventHandler(store), http.MethodGet, "/events/contains?userId=1", "", `invalid parameter "eventId": is required`},
+	}
+	for _, test := range tests {
+		// Обработчик и проверка маршрута отвечают в одном формате.
+		for name, handler := range map[string]http.Handler{"handler": test.handler, "route": mux} {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+			var body errorResponse
+			if response.Code != http.StatusBadRequest || json.Unmarshal(response.Body.Bytes(), &body) != nil || body.Error != test.want {
+				t.Errorf("%s %s: got %d %s, want 400 with error %q", name, test.target, response.Code, response.Body, test.want)
+			}
+		}
+	}
+}